@@ -0,0 +1,124 @@
+package apiclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/box/kube-applier/run"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	forceRunPath = "/api/v1/forceRun"
+	statusPath   = "/api/v1/status"
+	runsPath     = "/api/v1/runs/"
+)
+
+// ForceRunResponse is the body returned by the force run endpoint.
+// RunID identifies the queued run, and can be passed to Run once the run has completed.
+type ForceRunResponse struct {
+	Result  string `json:"result"`
+	Message string `json:"message"`
+	RunID   int    `json:"runID"`
+}
+
+// Error is an error response from the API.
+// Code is a machine-readable error code, such as "queue_full", "not_found" or "unauthorized".
+type Error struct {
+	StatusCode int
+	Code       string `json:"code"`
+	Message    string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("Error: API returned status %v (%v): %v", e.StatusCode, e.Code, e.Message)
+}
+
+// Client calls the kube-applier API, so that tools and CI jobs do not need to hand-roll HTTP requests.
+// BaseURL is the address of the kube-applier webserver (e.g. "http://kube-applier.kube-system:8080").
+// If Token is set, it is passed as a bearer token, for deployments behind an authenticating proxy.
+// If HTTPClient is nil, http.DefaultClient is used.
+type Client struct {
+	BaseURL    string
+	Token      string
+	HTTPClient *http.Client
+}
+
+// ForceRun requests a new full run, which starts upon completion of the current run.
+// If a full run is already queued, an *Error with Code "queue_full" is returned.
+func (c *Client) ForceRun() (*ForceRunResponse, error) {
+	return c.ForceRunWithReason("", "")
+}
+
+// ForceRunWithReason requests a new full run like ForceRun, recording the reason and correlation ID
+// (e.g. a CI pipeline or ticket ID) in the logs and in the run's result.
+func (c *Client) ForceRunWithReason(reason, correlationID string) (*ForceRunResponse, error) {
+	form := url.Values{}
+	if reason != "" {
+		form.Set("reason", reason)
+	}
+	if correlationID != "" {
+		form.Set("correlationId", correlationID)
+	}
+	resp := &ForceRunResponse{}
+	if err := c.do("POST", forceRunPath, form, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Run returns the result of the run with the given ID.
+// If the run has not completed yet, or is no longer retained, an *Error with Code "not_found" is returned.
+func (c *Client) Run(id int) (*run.Result, error) {
+	result := &run.Result{}
+	if err := c.do("GET", fmt.Sprintf("%v%d", runsPath, id), nil, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Status returns the result of the most recent run, including the diff stat of the applied revision.
+// RunID is -1 if no run has completed yet.
+func (c *Client) Status() (*run.Result, error) {
+	result := &run.Result{}
+	if err := c.do("GET", statusPath, nil, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// do sends a request to the API endpoint at path, with the form values as the body if any, and decodes the JSON response body into v.
+// Responses with a status other than 200 are decoded and returned as an *Error.
+func (c *Client) do(method, path string, form url.Values, v interface{}) error {
+	req, err := http.NewRequest(method, strings.TrimSuffix(c.BaseURL, "/")+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("Error creating request for %v: %v", path, err)
+	}
+	if len(form) > 0 {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("Error calling %v: %v", path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		apiErr := &Error{StatusCode: resp.StatusCode}
+		if err := json.NewDecoder(resp.Body).Decode(apiErr); err != nil {
+			return fmt.Errorf("Error decoding response from %v (status %v): %v", path, resp.StatusCode, err)
+		}
+		return apiErr
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("Error decoding response from %v (status %v): %v", path, resp.StatusCode, err)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package apiclient
+
+import (
+	"fmt"
+	"github.com/box/kube-applier/run"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientForceRun(t *testing.T) {
+	assert := assert.New(t)
+
+	var authorization, reason, correlationID string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		reason, correlationID = r.FormValue("reason"), r.FormValue("correlationId")
+		if r.Method != "POST" || r.URL.Path != forceRunPath {
+			w.WriteHeader(http.StatusConflict)
+			fmt.Fprint(w, `{"result":"error","message":"queue full","code":"queue_full"}`)
+			return
+		}
+		fmt.Fprint(w, `{"result":"success","message":"queued","runID":4}`)
+	}))
+	defer server.Close()
+
+	c := &Client{BaseURL: server.URL + "/", Token: "token"}
+	resp, err := c.ForceRun()
+	assert.Nil(err)
+	assert.Equal(&ForceRunResponse{Result: "success", Message: "queued", RunID: 4}, resp)
+	assert.Equal("Bearer token", authorization)
+	assert.Equal("", reason)
+	assert.Equal("", correlationID)
+
+	_, err = c.ForceRunWithReason("deploy", "build-42")
+	assert.Nil(err)
+	assert.Equal("deploy", reason)
+	assert.Equal("build-42", correlationID)
+
+	// Error responses are returned as errors
+	c = &Client{BaseURL: server.URL + "/wrong"}
+	resp, err = c.ForceRun()
+	assert.Nil(resp)
+	assert.Equal(&Error{StatusCode: http.StatusConflict, Code: "queue_full", Message: "queue full"}, err)
+	assert.Equal("", authorization)
+}
+
+func TestClientStatus(t *testing.T) {
+	assert := assert.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"RunID":2,"RunType":"QuickRun","CommitHash":"hash","DiffStat":"stat"}`)
+	}))
+	defer server.Close()
+
+	c := &Client{BaseURL: server.URL}
+	result, err := c.Status()
+	assert.Nil(err)
+	assert.Equal(&run.Result{RunID: 2, RunType: run.QuickRun, CommitHash: "hash", DiffStat: "stat"}, result)
+}
+
+func TestClientRun(t *testing.T) {
+	assert := assert.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != runsPath+"4" {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"result":"error","message":"not found","code":"not_found"}`)
+			return
+		}
+		fmt.Fprint(w, `{"RunID":4,"RunType":"FullRun","CommitHash":"hash"}`)
+	}))
+	defer server.Close()
+
+	c := &Client{BaseURL: server.URL}
+	result, err := c.Run(4)
+	assert.Nil(err)
+	assert.Equal(&run.Result{RunID: 4, RunType: run.FullRun, CommitHash: "hash"}, result)
+
+	result, err = c.Run(5)
+	assert.Nil(result)
+	assert.Equal(&Error{StatusCode: http.StatusNotFound, Code: "not_found", Message: "not found"}, err)
+}
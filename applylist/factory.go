@@ -2,8 +2,10 @@ package applylist
 
 import (
 	"github.com/box/kube-applier/sysutil"
+	"path"
 	"path/filepath"
 	"sort"
+	"strings"
 )
 
 // FactoryInterface allows for mocking out the functionality of Factory when testing the full process of an apply run.
@@ -12,15 +14,21 @@ type FactoryInterface interface {
 }
 
 // Factory handles constructing the list of files to apply and the blacklist.
+// ClusterResourcesPath is a directory relative to RepoPath holding shared cluster-scoped resources (e.g. CRDs, ClusterRoles).
+// If set, files under it are applied before all other files.
+// If TopLevelOnly is set, files in subdirectories of RepoPath are not applied, except for files directly in ClusterResourcesPath.
 type Factory struct {
-	RepoPath      string
-	BlacklistPath string
-	WhitelistPath string
-	FileSystem    sysutil.FileSystemInterface
+	RepoPath             string
+	BlacklistPath        string
+	WhitelistPath        string
+	FileSystem           sysutil.FileSystemInterface
+	ClusterResourcesPath string
+	TopLevelOnly         bool
 }
 
 // Create takes in a preliminary list of candidate files for applying, and filters against the blacklist and whitelist.
 // Three alphabetically sorted lists are returned: the final list of files to apply, the blacklist, and the whitelist.
+// If ClusterResourcesPath is set, the files under it are sorted ahead of all other files in the apply list.
 func (f *Factory) Create(rawList []string) (applyList, blacklist, whitelist []string, err error) {
 	blacklist, err = f.createBlacklist()
 	if err != nil {
@@ -31,10 +39,45 @@ func (f *Factory) Create(rawList []string) (applyList, blacklist, whitelist []st
 		return nil, nil, nil, err
 	}
 	applyList = filter(rawList, blacklist, whitelist)
+	if f.TopLevelOnly {
+		applyList = f.topLevelFiles(applyList)
+	}
 	sort.Strings(applyList)
+	if f.ClusterResourcesPath != "" {
+		applyList = clusterResourcesFirst(applyList, path.Join(f.RepoPath, f.ClusterResourcesPath))
+	}
 	return applyList, blacklist, whitelist, nil
 }
 
+// topLevelFiles returns the paths from list that are directly in RepoPath or, if set, directly in ClusterResourcesPath.
+func (f *Factory) topLevelFiles(list []string) []string {
+	dirs := map[string]struct{}{path.Clean(f.RepoPath): {}}
+	if f.ClusterResourcesPath != "" {
+		dirs[path.Join(f.RepoPath, f.ClusterResourcesPath)] = struct{}{}
+	}
+	topLevel := []string{}
+	for _, p := range list {
+		if _, ok := dirs[path.Dir(p)]; ok {
+			topLevel = append(topLevel, p)
+		}
+	}
+	return topLevel
+}
+
+// clusterResourcesFirst returns the list with the paths under dir moved ahead of all other paths, preserving their order otherwise.
+func clusterResourcesFirst(list []string, dir string) []string {
+	clusterResources := []string{}
+	others := []string{}
+	for _, p := range list {
+		if strings.HasPrefix(p, dir+"/") {
+			clusterResources = append(clusterResources, p)
+		} else {
+			others = append(others, p)
+		}
+	}
+	return append(clusterResources, others...)
+}
+
 // purgeCommentsFromList iterates over the list contents and deletes comment
 // lines. A comment is a line whose first non-space character is #
 func (f *Factory) purgeCommentsFromList(rawList []string) []string {
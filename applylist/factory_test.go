@@ -67,7 +67,7 @@ func TestPurgeComments(t *testing.T) {
 	assert := assert.New(t)
 	mockCtrl := gomock.NewController(t)
 	fs := sysutil.NewMockFileSystemInterface(mockCtrl)
-	f := &Factory{"", "", "", fs}
+	f := &Factory{FileSystem: fs}
 	for _, td := range testData {
 
 		rv := f.purgeCommentsFromList(td.rawList)
@@ -187,9 +187,43 @@ func TestFactoryCreate(t *testing.T) {
 
 func createAndAssert(t *testing.T, tc testCase) {
 	assert := assert.New(t)
-	f := &Factory{tc.repoPath, tc.blacklistPath, tc.whitelistPath, tc.fs}
+	f := &Factory{RepoPath: tc.repoPath, BlacklistPath: tc.blacklistPath, WhitelistPath: tc.whitelistPath, FileSystem: tc.fs}
 	applyList, blacklist, _, err := f.Create(tc.rawList)
 	assert.Equal(tc.expectedApplyList, applyList)
 	assert.Equal(tc.expectedBlacklist, blacklist)
 	assert.Equal(tc.expectedErr, err)
 }
+
+func TestFactoryCreateClusterResourcesFirst(t *testing.T) {
+	assert := assert.New(t)
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	fs := sysutil.NewMockFileSystemInterface(mockCtrl)
+	f := &Factory{RepoPath: "/repo", FileSystem: fs, ClusterResourcesPath: "cluster"}
+
+	rawList := []string{"/repo/a/b.json", "/repo/cluster/crd.yaml", "/repo/clusters.yaml", "/repo/cluster/rbac/role.yaml", "/repo/z.yaml"}
+	applyList, _, _, err := f.Create(rawList)
+	assert.Nil(err)
+	assert.Equal([]string{"/repo/cluster/crd.yaml", "/repo/cluster/rbac/role.yaml", "/repo/a/b.json", "/repo/clusters.yaml", "/repo/z.yaml"}, applyList)
+}
+
+func TestFactoryCreateTopLevelOnly(t *testing.T) {
+	assert := assert.New(t)
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	fs := sysutil.NewMockFileSystemInterface(mockCtrl)
+	rawList := []string{"/repo/a/b.json", "/repo/cluster/crd.yaml", "/repo/cluster/rbac/role.yaml", "/repo/z.yaml", "/repo/values/values.yaml"}
+
+	f := &Factory{RepoPath: "/repo/", FileSystem: fs, TopLevelOnly: true}
+	applyList, _, _, err := f.Create(rawList)
+	assert.Nil(err)
+	assert.Equal([]string{"/repo/z.yaml"}, applyList)
+
+	// Files directly in the cluster resources directory are still applied
+	f = &Factory{RepoPath: "/repo", FileSystem: fs, ClusterResourcesPath: "cluster", TopLevelOnly: true}
+	applyList, _, _, err = f.Create(rawList)
+	assert.Nil(err)
+	assert.Equal([]string{"/repo/cluster/crd.yaml", "/repo/z.yaml"}, applyList)
+}
@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// Authenticator verifies the identity of the client making a request to the webserver.
+// Authenticate returns the name of the authenticated user, or an error if the request could not be authenticated.
+type Authenticator interface {
+	Authenticate(*http.Request) (user string, err error)
+}
+
+// Handler wraps an http.Handler so that only requests accepted by the Authenticator are served.
+// Rejected requests receive a 401 response with a JSON error body.
+// If AllowAnonymousReads is set, GET requests are served without authentication, so that only requests that change state are protected.
+type Handler struct {
+	Authenticator       Authenticator
+	Handler             http.Handler
+	AllowAnonymousReads bool
+}
+
+// ServeHTTP authenticates the request and passes it on to the wrapped handler if it succeeds.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.AllowAnonymousReads && r.Method == "GET" {
+		h.Handler.ServeHTTP(w, r)
+		return
+	}
+	user, err := h.Authenticator.Authenticate(r)
+	if err != nil {
+		log.Printf("Rejected unauthenticated request to %v: %v", r.URL.Path, err)
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(struct {
+			Result  string `json:"result"`
+			Message string `json:"message"`
+			Code    string `json:"code"`
+		}{"error", "Error: unauthorized.", "unauthorized"})
+		return
+	}
+	log.Printf("Authenticated request to %v from %v", r.URL.Path, user)
+	h.Handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userKey{}, user)))
+}
+
+// userKey is the context key under which Handler stores the name of the authenticated user.
+type userKey struct{}
+
+// User returns the name of the user that the request was authenticated as, or an empty string if it was not authenticated.
+func User(r *http.Request) string {
+	user, _ := r.Context().Value(userKey{}).(string)
+	return user
+}
+
+// AllowedUsers wraps an http.Handler so that only requests authenticated as one of Users are served, e.g. to restrict an
+// endpoint that changes state to a few of the authenticated users. It must be wrapped by a Handler that authenticates the requests.
+// Rejected requests receive a 403 response with a JSON error body.
+type AllowedUsers struct {
+	Users   []string
+	Handler http.Handler
+}
+
+// ServeHTTP passes the request on to the wrapped handler if its user is allowed.
+func (a *AllowedUsers) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	user := User(r)
+	for _, allowed := range a.Users {
+		if user != "" && user == allowed {
+			a.Handler.ServeHTTP(w, r)
+			return
+		}
+	}
+	log.Printf("Rejected request to %v from %q, user is not allowed", r.URL.Path, user)
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusForbidden)
+	json.NewEncoder(w).Encode(struct {
+		Result  string `json:"result"`
+		Message string `json:"message"`
+		Code    string `json:"code"`
+	}{"error", "Error: forbidden.", "forbidden"})
+}
@@ -0,0 +1,161 @@
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"github.com/box/kube-applier/sysutil"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandlerServeHTTP(t *testing.T) {
+	assert := assert.New(t)
+	inner := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	})
+	h := &Handler{Authenticator: &TokenAuthenticator{map[string]string{"secret": "ci"}}, Handler: inner}
+
+	// Missing token
+	req, _ := http.NewRequest("POST", "/api/v1/forceRun", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	assert.Equal(http.StatusUnauthorized, w.Code)
+	assert.Equal("{\"result\":\"error\",\"message\":\"Error: unauthorized.\",\"code\":\"unauthorized\"}\n", w.Body.String())
+
+	// Valid token
+	req.Header.Set("Authorization", "Bearer secret")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal("ok", w.Body.String())
+
+	// Anonymous reads only skip authentication for GET requests
+	h.AllowAnonymousReads = true
+	req, _ = http.NewRequest("GET", "/api/v1/status", nil)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal("ok", w.Body.String())
+
+	req, _ = http.NewRequest("POST", "/api/v1/forceRun", nil)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	assert.Equal(http.StatusUnauthorized, w.Code)
+}
+
+func TestNewTokenAuthenticator(t *testing.T) {
+	assert := assert.New(t)
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	fs := sysutil.NewMockFileSystemInterface(mockCtrl)
+	gomock.InOrder(
+		fs.EXPECT().ReadLines("tokens").Times(1).Return([]string{"# comment", "", "token1", "token2, deployer"}, nil),
+		fs.EXPECT().ReadLines("empty").Times(1).Return([]string{"# comment"}, nil),
+		fs.EXPECT().ReadLines("missing").Times(1).Return(nil, fmt.Errorf("read error")),
+	)
+
+	a, err := NewTokenAuthenticator("tokens", fs)
+	assert.Nil(err)
+	assert.Equal(map[string]string{"token1": "token-3", "token2": "deployer"}, a.Tokens)
+
+	_, err = NewTokenAuthenticator("empty", fs)
+	assert.Equal(fmt.Errorf("Error: no tokens found in empty"), err)
+
+	_, err = NewTokenAuthenticator("missing", fs)
+	assert.Equal(fmt.Errorf("read error"), err)
+}
+
+func TestTokenAuthenticatorAuthenticate(t *testing.T) {
+	assert := assert.New(t)
+	a := &TokenAuthenticator{map[string]string{"secret": "ci"}}
+
+	for header, expectedUser := range map[string]string{
+		"":              "",
+		"secret":        "",
+		"Basic secret":  "",
+		"Bearer wrong":  "",
+		"Bearer secret": "ci",
+	} {
+		req, _ := http.NewRequest("GET", "", nil)
+		req.Header.Set("Authorization", header)
+		user, err := a.Authenticate(req)
+		assert.Equal(expectedUser, user, header)
+		assert.Equal(expectedUser == "", err != nil, header)
+	}
+}
+
+func TestClientCertAuthenticatorAuthenticate(t *testing.T) {
+	assert := assert.New(t)
+
+	withCert := func(cn string, orgs ...string) *http.Request {
+		req, _ := http.NewRequest("GET", "", nil)
+		cert := &x509.Certificate{Subject: pkix.Name{CommonName: cn, Organization: orgs}}
+		req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+		return req
+	}
+
+	// No TLS or unverified certificate
+	a := &ClientCertAuthenticator{}
+	req, _ := http.NewRequest("GET", "", nil)
+	_, err := a.Authenticate(req)
+	assert.NotNil(err)
+	req.TLS = &tls.ConnectionState{}
+	_, err = a.Authenticate(req)
+	assert.NotNil(err)
+
+	// Any verified certificate is allowed without restrictions
+	user, err := a.Authenticate(withCert("alice"))
+	assert.Nil(err)
+	assert.Equal("alice", user)
+
+	// Restricted by CN and Organization
+	a = &ClientCertAuthenticator{AllowedCNs: []string{"alice"}, AllowedOrgs: []string{"sre"}}
+	user, err = a.Authenticate(withCert("alice"))
+	assert.Nil(err)
+	assert.Equal("alice", user)
+	user, err = a.Authenticate(withCert("bob", "dev", "sre"))
+	assert.Nil(err)
+	assert.Equal("bob", user)
+	_, err = a.Authenticate(withCert("carol", "dev"))
+	assert.Equal(fmt.Errorf("client certificate \"carol\" is not allowed"), err)
+}
+
+func TestAllowedUsersServeHTTP(t *testing.T) {
+	assert := assert.New(t)
+	inner := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, User(r))
+	})
+	h := &Handler{
+		Authenticator: &TokenAuthenticator{map[string]string{"secret1": "oncall", "secret2": "ci"}},
+		Handler:       &AllowedUsers{Users: []string{"oncall"}, Handler: inner},
+	}
+
+	// Allowed user
+	req, _ := http.NewRequest("POST", "/api/v1/forceRun", nil)
+	req.Header.Set("Authorization", "Bearer secret1")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal("oncall", w.Body.String())
+
+	// Authenticated user that is not allowed
+	req.Header.Set("Authorization", "Bearer secret2")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	assert.Equal(http.StatusForbidden, w.Code)
+	assert.Equal("{\"result\":\"error\",\"message\":\"Error: forbidden.\",\"code\":\"forbidden\"}\n", w.Body.String())
+
+	// Unauthenticated requests have no user and are never allowed
+	h.AllowAnonymousReads = true
+	req, _ = http.NewRequest("GET", "/api/v1/forceRun", nil)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	assert.Equal(http.StatusForbidden, w.Code)
+	assert.Equal("", User(req))
+}
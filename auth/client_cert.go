@@ -0,0 +1,38 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// ClientCertAuthenticator authenticates requests with a TLS client certificate that was verified against the webserver's client CA.
+// A certificate is accepted if its Common Name is in AllowedCNs or one of its Organizations is in AllowedOrgs.
+// If both lists are empty, any verified certificate is accepted.
+type ClientCertAuthenticator struct {
+	AllowedCNs  []string
+	AllowedOrgs []string
+}
+
+// Authenticate accepts requests whose verified client certificate matches the allowed Common Names or Organizations.
+func (a *ClientCertAuthenticator) Authenticate(r *http.Request) (string, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return "", fmt.Errorf("missing verified client certificate")
+	}
+	subject := r.TLS.VerifiedChains[0][0].Subject
+	if len(a.AllowedCNs) == 0 && len(a.AllowedOrgs) == 0 {
+		return subject.CommonName, nil
+	}
+	for _, cn := range a.AllowedCNs {
+		if subject.CommonName == cn {
+			return subject.CommonName, nil
+		}
+	}
+	for _, allowed := range a.AllowedOrgs {
+		for _, org := range subject.Organization {
+			if org == allowed {
+				return subject.CommonName, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("client certificate %q is not allowed", subject.CommonName)
+}
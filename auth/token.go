@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"fmt"
+	"github.com/box/kube-applier/sysutil"
+	"net/http"
+	"strings"
+)
+
+// TokenAuthenticator authenticates requests with a static bearer token from a fixed list.
+type TokenAuthenticator struct {
+	// Tokens maps each accepted token to the name of its user.
+	Tokens map[string]string
+}
+
+// NewTokenAuthenticator reads the accepted tokens from the file located at path, usually mounted from a Secret.
+// Each line holds a token, optionally followed by a comma and the name of its user. Empty lines and lines starting with # are ignored.
+func NewTokenAuthenticator(path string, fs sysutil.FileSystemInterface) (*TokenAuthenticator, error) {
+	lines, err := fs.ReadLines(path)
+	if err != nil {
+		return nil, err
+	}
+	tokens := make(map[string]string)
+	for i, line := range lines {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, ",", 2)
+		token := strings.TrimSpace(parts[0])
+		user := fmt.Sprintf("token-%d", i+1)
+		if len(parts) == 2 && strings.TrimSpace(parts[1]) != "" {
+			user = strings.TrimSpace(parts[1])
+		}
+		tokens[token] = user
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("Error: no tokens found in %v", path)
+	}
+	return &TokenAuthenticator{tokens}, nil
+}
+
+// Authenticate accepts requests with an "Authorization: Bearer <token>" header holding a known token.
+func (a *TokenAuthenticator) Authenticate(r *http.Request) (string, error) {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return "", fmt.Errorf("missing bearer token")
+	}
+	user, ok := a.Tokens[strings.TrimPrefix(header, "Bearer ")]
+	if !ok {
+		return "", fmt.Errorf("invalid bearer token")
+	}
+	return user, nil
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/box/kube-applier/auth"
+	"github.com/box/kube-applier/git"
+	"github.com/box/kube-applier/kube"
+	"github.com/box/kube-applier/run"
+	"github.com/box/kube-applier/sysutil"
+)
+
+// configCheck is a single check run by the "check-config" subcommand. A nil err means the check passed.
+type configCheck struct {
+	name string
+	err  error
+}
+
+// checkConfig runs the "check-config" subcommand, which validates the configuration of the service from its environment
+// variables and config file without starting it, prints a report and exits non-zero if any check failed.
+// It is meant to gate rollouts of a new configuration, so unlike the service it does not wait for the repo to appear.
+func checkConfig() {
+	repoPath := sysutil.ConfigValue("REPO_PATH")
+	tlsCertPath := sysutil.ConfigValue("TLS_CERT_PATH")
+	tlsKeyPath := sysutil.ConfigValue("TLS_KEY_PATH")
+	tlsClientCAPath := sysutil.ConfigValue("TLS_CLIENT_CA_PATH")
+	authTokensPath := sysutil.ConfigValue("AUTH_TOKENS_PATH")
+	kubectlVersion := sysutil.ConfigValue("KUBECTL_VERSION")
+
+	checks := []configCheck{
+		{"REPO_PATH", checkRepo(repoPath)},
+		{"LISTEN_PORT", checkListenPort(sysutil.ConfigValue("LISTEN_PORT"), sysutil.ConfigValue("LISTEN_ADDRESS"))},
+		{"DIFF_URL_FORMAT", validateDiffURLFormat(sysutil.ConfigValue("DIFF_URL_FORMAT"))},
+		{"VALIDATE_MODE", checkValidateMode(sysutil.GetEnvStringOrDefault("VALIDATE_MODE", string(run.ValidateOff)))},
+		{"APPLY_ORDER", checkApplyOrder(sysutil.GetEnvStringOrDefault("APPLY_ORDER", string(run.OrderPath)))},
+		{"KUBECTL_VERSION", validateKubectlVersion(kubectlVersion, sysutil.ConfigValue("KUBECTL_SHA256"))},
+		{"APPLY_WINDOW", checkApplyWindow(sysutil.ConfigValue("APPLY_WINDOW"), sysutil.GetEnvStringOrDefault("APPLY_WINDOW_TIMEZONE", "UTC"))},
+		{"APPLY_RETRY_PATTERNS", checkRetryPolicy(sysutil.GetEnvStringSliceOrDefault("APPLY_RETRY_PATTERNS", kube.DefaultRetryPatterns), sysutil.GetEnvStringSliceOrDefault("APPLY_RETRY_EXIT_CODES", []string{}))},
+		{"APPLY_GROUP_LIMITS", checkGroupLimits(sysutil.GetEnvStringSliceOrDefault("APPLY_GROUP_LIMITS", []string{}))},
+		{"STATUS_TIMEZONE", checkTimezone(sysutil.ConfigValue("STATUS_TIMEZONE"))},
+		{"TLS", validateTLS(tlsCertPath, tlsKeyPath, tlsClientCAPath, authTokensPath)},
+		{"FORCE_RUN_ALLOWED_USERS", validateForceRunAllowedUsers(sysutil.GetEnvStringSliceOrDefault("FORCE_RUN_ALLOWED_USERS", []string{}), tlsClientCAPath, authTokensPath)},
+		{"BLACKLIST_PATH", checkFile(sysutil.ConfigValue("BLACKLIST_PATH"))},
+		{"WHITELIST_PATH", checkFile(sysutil.ConfigValue("WHITELIST_PATH"))},
+		{"TLS_CERT_PATH", checkFile(tlsCertPath)},
+		{"TLS_KEY_PATH", checkFile(tlsKeyPath)},
+		{"TLS_CLIENT_CA_PATH", checkFile(tlsClientCAPath)},
+		{"AUTH_TOKENS_PATH", checkAuthTokens(authTokensPath)},
+		{"RUNBOOKS_PATH", checkRunbooks(sysutil.ConfigValue("RUNBOOKS_PATH"))},
+		{"PRE_APPLY_HOOK", checkHook(repoPath, sysutil.ConfigValue("PRE_APPLY_HOOK"))},
+		{"POST_APPLY_HOOK", checkHook(repoPath, sysutil.ConfigValue("POST_APPLY_HOOK"))},
+	}
+	// A pinned kubectl is downloaded at startup, otherwise the one in the image must be usable.
+	if kubectlVersion == "" {
+		checks = append(checks, configCheck{"kubectl", checkKubectl()})
+	}
+
+	failed := 0
+	for _, c := range checks {
+		if c.err != nil {
+			failed++
+			fmt.Printf("FAIL %v: %v\n", c.name, c.err)
+		} else {
+			fmt.Printf("OK   %v\n", c.name)
+		}
+	}
+	fmt.Printf("%v checks, %v failed.\n", len(checks), failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// validateDiffURLFormat returns an error if the DIFF_URL_FORMAT has no placeholder for the commit hash.
+func validateDiffURLFormat(format string) error {
+	if format != "" && !strings.Contains(format, "%s") && !strings.Contains(format, "%{to}") {
+		return fmt.Errorf("Invalid DIFF_URL_FORMAT, must contain %q or %q: %v", "%s", "%{to}", format)
+	}
+	return nil
+}
+
+// validateKubectlVersion returns an error if a kubectl version is pinned without the checksum to verify it.
+func validateKubectlVersion(version, checksum string) error {
+	if version != "" && checksum == "" {
+		return fmt.Errorf("KUBECTL_VERSION requires KUBECTL_SHA256")
+	}
+	return nil
+}
+
+// validateTLS returns an error if the TLS and API authentication settings are inconsistent.
+func validateTLS(certPath, keyPath, clientCAPath, authTokensPath string) error {
+	if (certPath == "") != (keyPath == "") {
+		return fmt.Errorf("TLS_CERT_PATH and TLS_KEY_PATH must be specified together")
+	}
+	if clientCAPath != "" && certPath == "" {
+		return fmt.Errorf("TLS_CLIENT_CA_PATH requires TLS_CERT_PATH and TLS_KEY_PATH")
+	}
+	if authTokensPath != "" && clientCAPath != "" {
+		return fmt.Errorf("AUTH_TOKENS_PATH and TLS_CLIENT_CA_PATH are mutually exclusive")
+	}
+	return nil
+}
+
+// validateForceRunAllowedUsers returns an error if force runs are restricted to some users but API requests are not authenticated.
+func validateForceRunAllowedUsers(users []string, clientCAPath, authTokensPath string) error {
+	if len(users) > 0 && clientCAPath == "" && authTokensPath == "" {
+		return fmt.Errorf("FORCE_RUN_ALLOWED_USERS requires AUTH_TOKENS_PATH or TLS_CLIENT_CA_PATH")
+	}
+	return nil
+}
+
+func checkRepo(path string) error {
+	if path == "" {
+		return fmt.Errorf("Required environment variable REPO_PATH is not set")
+	}
+	gitUtil := &git.GitUtil{RepoPath: path}
+	_, err := gitUtil.HeadHash()
+	return err
+}
+
+func checkListenPort(port, address string) error {
+	if address != "" {
+		return nil
+	}
+	if port == "" {
+		return fmt.Errorf("Required environment variable LISTEN_PORT is not set")
+	}
+	_, err := strconv.Atoi(port)
+	return err
+}
+
+func checkValidateMode(mode string) error {
+	_, err := run.ParseValidateMode(mode)
+	return err
+}
+
+func checkApplyOrder(policy string) error {
+	_, err := run.ParseOrderPolicy(policy)
+	return err
+}
+
+func checkApplyWindow(spec, timezone string) error {
+	if spec == "" {
+		return nil
+	}
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return err
+	}
+	_, err = run.ParseApplyWindow(spec, location)
+	return err
+}
+
+func checkRetryPolicy(patterns, exitCodes []string) error {
+	_, err := kube.NewRetryPolicy(0, 0, 0, patterns, exitCodes)
+	return err
+}
+
+func checkGroupLimits(specs []string) error {
+	_, err := run.ParseGroupLimits(specs)
+	return err
+}
+
+func checkTimezone(timezone string) error {
+	if timezone == "" {
+		return nil
+	}
+	_, err := time.LoadLocation(timezone)
+	return err
+}
+
+// checkFile returns an error if path is set but cannot be read.
+func checkFile(path string) error {
+	if path == "" {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func checkAuthTokens(path string) error {
+	if path == "" {
+		return nil
+	}
+	_, err := auth.NewTokenAuthenticator(path, &sysutil.FileSystem{})
+	return err
+}
+
+func checkRunbooks(path string) error {
+	if path == "" {
+		return nil
+	}
+	_, err := run.LoadRunbooks(path, &sysutil.FileSystem{})
+	return err
+}
+
+// checkHook returns an error if a hook is configured but is not an executable file in the repo.
+func checkHook(repoPath, hookPath string) error {
+	if hookPath == "" {
+		return nil
+	}
+	info, err := os.Stat(filepath.Join(repoPath, hookPath))
+	if err != nil {
+		return err
+	}
+	if info.IsDir() || info.Mode()&0111 == 0 {
+		return fmt.Errorf("%v is not an executable file", hookPath)
+	}
+	return nil
+}
+
+func checkKubectl() error {
+	output, err := exec.Command("kubectl", "version", "--client").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("Error running kubectl version --client: %v: %s", err, output)
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/box/kube-applier/sysutil"
+)
+
+// devTemplatePath is the status page template within the source tree, used instead of the copy in the container image.
+const devTemplatePath = "templates/status.html"
+
+// dev runs the "dev" subcommand, which configures the service for local development and then starts it as usual.
+// The repo is a local Git checkout rather than one synced by git-sync, kubectl uses the current kubeconfig context (e.g. of a
+// kind or minikube cluster), and the status page is served from the source tree, so it must be run from the root of the repo.
+// All other settings are still read from the environment.
+func dev(args []string) {
+	fs := flag.NewFlagSet("dev", flag.ExitOnError)
+	path := fs.String("path", sysutil.GetEnvStringOrDefault("REPO_PATH", "."), "Path to the Git repository to apply")
+	port := fs.Int("port", sysutil.GetEnvIntOrDefault("LISTEN_PORT", 8080), "Port the webserver listens on")
+	fs.Parse(args)
+
+	repoPath, err := filepath.Abs(*path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// The service waits for the repo to be synced, which never happens for a local checkout that does not exist.
+	if err := checkRepo(repoPath); err != nil {
+		log.Fatalf("Error: %v is not a Git repository: %v", repoPath, err)
+	}
+	if _, err := os.Stat(devTemplatePath); err != nil {
+		log.Fatalf("Error: %v not found, dev mode must be run from the root of the kube-applier source tree", devTemplatePath)
+	}
+	os.Setenv("REPO_PATH", repoPath)
+	os.Setenv("LISTEN_PORT", strconv.Itoa(*port))
+	os.Unsetenv("LISTEN_ADDRESS")
+	// SERVER makes kubectl authenticate with the in-cluster service account token.
+	os.Unsetenv("SERVER")
+	templatePath = devTemplatePath
+	log.Printf("Dev mode: applying %v with the current kubeconfig context, status page on http://localhost:%v/", repoPath, *port)
+}
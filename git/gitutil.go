@@ -3,8 +3,10 @@ package git
 import (
 	"fmt"
 	"github.com/box/kube-applier/applylist"
+	"net/url"
 	"os/exec"
 	"strings"
+	"time"
 )
 
 // GitUtilInterface allows for mocking out the functionality of GitUtil when testing the full process of an apply run.
@@ -13,28 +15,34 @@ type GitUtilInterface interface {
 	ListAllFiles() ([]string, error)
 	CommitLog(string) (string, error)
 	ListDiffFiles(string, string) ([]string, error)
+	DiffStat(string, string) (string, error)
+	CommitEmails(string, string) ([][]string, error)
+	RemoteURL() (string, error)
+	Branch() (string, error)
 }
 
 // GitUtil allows for fetching information about a Git repository using Git CLI commands.
+// If ObserveCommand is set, it is called with the subcommand (e.g. "diff"), duration and error of every command that is run.
 type GitUtil struct {
-	RepoPath string
+	RepoPath       string
+	ObserveCommand func(command string, duration time.Duration, err error)
 }
 
 // HeadHash returns the hash of the current HEAD commit.
 func (g *GitUtil) HeadHash() (string, error) {
-	hash, err := runGitCmd(g.RepoPath, "rev-parse", "HEAD")
+	hash, err := g.runGitCmd("rev-parse", "HEAD")
 	return strings.TrimSuffix(hash, "\n"), err
 }
 
 // CommitLog returns the log of the specified commit, including a list of the files that were modified.
 func (g *GitUtil) CommitLog(hash string) (string, error) {
-	log, err := runGitCmd(g.RepoPath, "log", "-1", "--name-status", hash)
+	log, err := g.runGitCmd("log", "-1", "--name-status", hash)
 	return log, err
 }
 
 // ListAllFiles returns a list of all files under $REPO_PATH, with paths relative to $REPO_PATH.
 func (g *GitUtil) ListAllFiles() ([]string, error) {
-	raw, err := runGitCmd(g.RepoPath, "ls-files")
+	raw, err := g.runGitCmd("ls-files")
 	if err != nil {
 		return nil, err
 	}
@@ -46,7 +54,7 @@ func (g *GitUtil) ListAllFiles() ([]string, error) {
 // ListDiffFiles returns the file names that were added, modified, copied, or renamed.
 // Deletes are ignored because kube-applier should not apply files deleted by a commit.
 func (g *GitUtil) ListDiffFiles(oldHash, newHash string) ([]string, error) {
-	raw, err := runGitCmd(g.RepoPath, "diff", "--diff-filter=AMCR", "--name-only", "--relative", oldHash, newHash)
+	raw, err := g.runGitCmd("diff", "--diff-filter=AMCR", "--name-only", "--relative", oldHash, newHash)
 	if err != nil {
 		return nil, err
 	}
@@ -58,11 +66,76 @@ func (g *GitUtil) ListDiffFiles(oldHash, newHash string) ([]string, error) {
 	return fullPaths, nil
 }
 
-func runGitCmd(dir string, args ...string) (string, error) {
+// DiffStat returns a summary of the changes between the two commits for the files under $REPO_PATH.
+func (g *GitUtil) DiffStat(oldHash, newHash string) (string, error) {
+	return g.runGitCmd("diff", "--stat", "--relative", oldHash, newHash)
+}
+
+// CommitEmails returns the author and committer email addresses of every commit after oldHash up to newHash, newest first.
+// Only the commit newHash is listed if oldHash is empty.
+func (g *GitUtil) CommitEmails(oldHash, newHash string) ([][]string, error) {
+	args := []string{"log", "--format=%ae%n%ce", oldHash + ".." + newHash}
+	if oldHash == "" {
+		args = []string{"log", "-1", "--format=%ae%n%ce", newHash}
+	}
+	raw, err := g.runGitCmd(args...)
+	if err != nil {
+		return nil, err
+	}
+	emails := [][]string{}
+	if raw == "" {
+		return emails, nil
+	}
+	lines := strings.Split(strings.TrimSuffix(raw, "\n"), "\n")
+	for i := 0; i+1 < len(lines); i += 2 {
+		emails = append(emails, lines[i:i+2])
+	}
+	return emails, nil
+}
+
+// RemoteURL returns the URL of the "origin" remote, with any credentials removed so that it can be shown to clients.
+func (g *GitUtil) RemoteURL() (string, error) {
+	raw, err := g.runGitCmd("config", "--get", "remote.origin.url")
+	if err != nil {
+		return "", err
+	}
+	return sanitizeURL(strings.TrimSuffix(raw, "\n")), nil
+}
+
+// Branch returns the name of the checked out branch, or an empty string if HEAD is detached, as in git-sync worktrees.
+func (g *GitUtil) Branch() (string, error) {
+	raw, err := g.runGitCmd("rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		return "", err
+	}
+	branch := strings.TrimSuffix(raw, "\n")
+	if branch == "HEAD" {
+		return "", nil
+	}
+	return branch, nil
+}
+
+// sanitizeURL removes the user info, which may include a password or token, from a URL.
+// scp-like addresses such as "git@github.com:org/repo.git" cannot include a password and are returned as they are.
+func sanitizeURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.User == nil {
+		return raw
+	}
+	u.User = nil
+	return u.String()
+}
+
+// runGitCmd runs git with the given arguments in the repo and returns its combined output.
+func (g *GitUtil) runGitCmd(args ...string) (string, error) {
 	var cmd *exec.Cmd
 	cmd = exec.Command("git", args...)
-	cmd.Dir = dir
+	cmd.Dir = g.RepoPath
+	start := time.Now()
 	output, err := cmd.CombinedOutput()
+	if g.ObserveCommand != nil {
+		g.ObserveCommand(args[0], time.Since(start), err)
+	}
 	if err != nil {
 		return "", fmt.Errorf("Error running command %v: %v: %s", strings.Join(cmd.Args, " "), err, output)
 	}
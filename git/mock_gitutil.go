@@ -43,6 +43,58 @@ func (_mr *MockGitUtilInterfaceMockRecorder) CommitLog(arg0 interface{}) *gomock
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "CommitLog", arg0)
 }
 
+// CommitEmails mocks base method
+func (_m *MockGitUtilInterface) CommitEmails(_param0 string, _param1 string) ([][]string, error) {
+	ret := _m.ctrl.Call(_m, "CommitEmails", _param0, _param1)
+	ret0, _ := ret[0].([][]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CommitEmails indicates an expected call of CommitEmails
+func (_mr *MockGitUtilInterfaceMockRecorder) CommitEmails(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "CommitEmails", arg0, arg1)
+}
+
+// RemoteURL mocks base method
+func (_m *MockGitUtilInterface) RemoteURL() (string, error) {
+	ret := _m.ctrl.Call(_m, "RemoteURL")
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RemoteURL indicates an expected call of RemoteURL
+func (_mr *MockGitUtilInterfaceMockRecorder) RemoteURL() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "RemoteURL")
+}
+
+// Branch mocks base method
+func (_m *MockGitUtilInterface) Branch() (string, error) {
+	ret := _m.ctrl.Call(_m, "Branch")
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Branch indicates an expected call of Branch
+func (_mr *MockGitUtilInterfaceMockRecorder) Branch() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Branch")
+}
+
+// DiffStat mocks base method
+func (_m *MockGitUtilInterface) DiffStat(_param0 string, _param1 string) (string, error) {
+	ret := _m.ctrl.Call(_m, "DiffStat", _param0, _param1)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DiffStat indicates an expected call of DiffStat
+func (_mr *MockGitUtilInterfaceMockRecorder) DiffStat(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "DiffStat", arg0, arg1)
+}
+
 // HeadHash mocks base method
 func (_m *MockGitUtilInterface) HeadHash() (string, error) {
 	ret := _m.ctrl.Call(_m, "HeadHash")
@@ -6,6 +6,7 @@ require (
 	github.com/golang/mock v0.0.0-20160127222235-bd3c8e81be01
 	github.com/prometheus/client_golang v1.11.1
 	github.com/stretchr/testify v1.4.0
+	gopkg.in/yaml.v2 v2.3.0
 )
 
 require (
@@ -20,5 +21,4 @@ require (
 	github.com/prometheus/procfs v0.6.0 // indirect
 	golang.org/x/sys v0.0.0-20210603081109-ebe580a85c40 // indirect
 	google.golang.org/protobuf v1.26.0-rc.1 // indirect
-	gopkg.in/yaml.v2 v2.3.0 // indirect
 )
@@ -1,14 +1,19 @@
 package kube
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"math"
 	"os/exec"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/box/kube-applier/sysutil"
 )
@@ -21,9 +26,20 @@ const (
 	kubeconfigTemplatePath = "/templates/kubeconfig"
 )
 
+// ApplyOutputLine matches the per-resource lines of kubectl apply output, e.g. "deployment.apps/web configured".
+// These lines are kept whatever the MaxOutputBytes of the Client, since the resources applied are counted from them.
+var ApplyOutputLine = regexp.MustCompile(`^([^\s/]+)/(\S+) (created|configured|unchanged|replaced)$`)
+
 // ClientInterface allows for mocking out the functionality of Client when testing the full process of an apply run.
 type ClientInterface interface {
 	Apply(string) (cmd, output string, err error)
+	Validate(string) (cmd, output string, err error)
+	RolloutStatus(string, string, string, time.Duration) (cmd, output string, err error)
+	Label(string, map[string]string) (cmd, output string, err error)
+	Replace(string) (cmd, output string, err error)
+	Diff(string) (cmd, output string, err error)
+	DryRun(string) (cmd, output string, err error)
+	CanI(verb, resource, namespace string) (allowed bool, err error)
 	CheckVersion() error
 }
 
@@ -35,6 +51,77 @@ type Client struct {
 	kubeconfigFilePath string
 	// if <0, no verbosity level is specified in the commands run
 	LogLevel int
+	// Path of the kubectl binary, if empty kubectl is looked up in PATH
+	KubectlPath string
+	// Maximum number of bytes of output kept for each command, if <=0 the full output is kept
+	MaxOutputBytes int
+	// Retry of apply commands that fail with a transient error, if nil they are not retried
+	Retry *RetryPolicy
+	// ObserveRetry is called with the path, attempt number and error of every failed apply attempt that is retried
+	ObserveRetry func(path string, attempt int, err error)
+}
+
+// DefaultRetryPatterns match the output of kubectl for errors that are usually gone by the next attempt: the API server or an
+// admission webhook could not be reached in time, or the API server was overloaded.
+var DefaultRetryPatterns = []string{
+	"connection refused",
+	"connection reset by peer",
+	"i/o timeout",
+	"TLS handshake timeout",
+	"context deadline exceeded",
+	"failed calling webhook",
+	"the server is currently unable to handle the request",
+	"etcdserver: request timed out",
+	"Too Many Requests",
+}
+
+// RetryPolicy determines which failed apply commands are retried, and how often.
+// A command is retried if it exited with one of ExitCodes, or if its output matches one of Patterns.
+// Retries wait for Backoff, doubling after every attempt, until MaxAttempts commands were run or retrying would exceed MaxDuration.
+type RetryPolicy struct {
+	MaxAttempts int
+	Backoff     time.Duration
+	MaxDuration time.Duration
+	Patterns    []*regexp.Regexp
+	ExitCodes   []int
+}
+
+// NewRetryPolicy returns a RetryPolicy for the given regular expressions and exit codes.
+func NewRetryPolicy(maxAttempts int, backoff, maxDuration time.Duration, patterns, exitCodes []string) (*RetryPolicy, error) {
+	p := &RetryPolicy{MaxAttempts: maxAttempts, Backoff: backoff, MaxDuration: maxDuration}
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid retry pattern %q: %v", pattern, err)
+		}
+		p.Patterns = append(p.Patterns, re)
+	}
+	for _, code := range exitCodes {
+		c, err := strconv.Atoi(code)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid retry exit code %q, must be an integer", code)
+		}
+		p.ExitCodes = append(p.ExitCodes, c)
+	}
+	return p, nil
+}
+
+// retryable returns true if a command that failed with err and output should be retried.
+func (p *RetryPolicy) retryable(output string, err error) bool {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		for _, code := range p.ExitCodes {
+			if exitErr.ExitCode() == code {
+				return true
+			}
+		}
+	}
+	for _, pattern := range p.Patterns {
+		if pattern.MatchString(output) {
+			return true
+		}
+	}
+	return false
 }
 
 type KubeVersion struct {
@@ -88,13 +175,7 @@ func (c *Client) Configure() error {
 
 // CheckVersion returns an error if the server and client have incompatible versions, otherwise returns nil.
 func (c *Client) CheckVersion() error {
-	args := []string{"kubectl", "version", "--output=json"}
-	if c.LogLevel > -1 {
-		args = append(args, fmt.Sprintf("-v=%d", c.LogLevel))
-	}
-	if c.Server != "" {
-		args = append(args, fmt.Sprintf("--kubeconfig=%s", c.kubeconfigFilePath))
-	}
+	args := c.kubectlArgs("version", "--output=json")
 	stdout, err := exec.Command(args[0], args[1:]...).CombinedOutput()
 	if err != nil {
 		return fmt.Errorf("Error executing kubectl version command: %v", stdout)
@@ -149,20 +230,185 @@ func isCompatible(stdout []byte) error {
 	return nil
 }
 
-// Apply attempts to "kubectl apply" the file located at path.
-// It returns the full apply command and its output.
+// Apply attempts to "kubectl apply" the file located at path, retrying transient failures according to Retry.
+// Objects annotated with IgnoreAnnotation are left out.
+// It returns the full apply command and its output, which starts with a note of the ignored objects, if any, and the output of any
+// failed attempts.
 func (c *Client) Apply(path string) (cmd, output string, err error) {
-	args := []string{"kubectl", "apply", "-f", path}
+	cmd, output, ignored, err := c.runWithoutIgnored(path, c.applyArgs, func(args []string) (string, string, error) {
+		return c.runWithRetry(path, args)
+	})
+	return cmd, withIgnoredNote(ignored, output), err
+}
+
+// ApplyCommand returns the full apply command that Apply would run for the file located at path, without running it.
+func (c *Client) ApplyCommand(path string) string {
+	return strings.Join(c.applyArgs(path), " ")
+}
+
+// applyArgs returns the full argument list for applying the file located at path.
+func (c *Client) applyArgs(path string) []string {
+	return c.kubectlArgs("apply", "-f", path)
+}
+
+// Replace deletes and recreates the objects defined in the file located at path, for changes that cannot be applied in place.
+// Objects annotated with IgnoreAnnotation are left out. It returns the full replace command and its output.
+func (c *Client) Replace(path string) (cmd, output string, err error) {
+	cmd, output, ignored, err := c.runWithoutIgnored(path, func(path string) []string {
+		return c.kubectlArgs("replace", "--force", "-f", path)
+	}, c.run)
+	return cmd, withIgnoredNote(ignored, output), err
+}
+
+// DryRun submits the file located at path to the API server as "kubectl apply" would, without persisting any changes, so that
+// admission webhooks and server-side validation are run. Transient failures are retried and ignored objects are left out as they are
+// by Apply. It returns the full dry-run command and its output.
+func (c *Client) DryRun(path string) (cmd, output string, err error) {
+	cmd, output, ignored, err := c.runWithoutIgnored(path, func(path string) []string {
+		return c.kubectlArgs("apply", "--dry-run=server", "-f", path)
+	}, func(args []string) (string, string, error) {
+		return c.runWithRetry(path, args)
+	})
+	return cmd, withIgnoredNote(ignored, output), err
+}
+
+// Diff compares the objects defined in the file located at path with the live objects, without changing them.
+// It returns the full diff command and its output, which is empty if there are no differences. Unlike kubectl diff, it only
+// returns an error if the diff could not be computed, not if differences were found. Ignored objects are not compared.
+func (c *Client) Diff(path string) (cmd, output string, err error) {
+	cmd, output, _, err = c.runWithoutIgnored(path, func(path string) []string {
+		return c.kubectlArgs("diff", "-f", path)
+	}, c.run)
+	// kubectl diff exits with 1 if it found differences, and with a greater code if it failed.
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		err = nil
+	}
+	return cmd, output, err
+}
+
+// CanI checks whether kubectl is allowed to perform verb on resource, e.g. "deployment.apps", in namespace, or in the default
+// namespace of its context if namespace is empty. It only returns an error if the check itself failed.
+func (c *Client) CanI(verb, resource, namespace string) (allowed bool, err error) {
+	args := []string{"auth", "can-i", verb, resource}
+	if namespace != "" {
+		args = append(args, "--namespace", namespace)
+	}
+	_, output, err := c.run(c.kubectlArgs(args...))
+	// kubectl auth can-i exits with 1 and prints "no" if the action is not allowed.
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 && strings.HasPrefix(output, "no") {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("%v: %v", err, strings.TrimSpace(output))
+	}
+	return true, nil
+}
+
+// Validate checks the file located at path against the API server's OpenAPI schema without persisting any changes.
+// Ignored objects are not validated. It returns the full validation command and its output.
+func (c *Client) Validate(path string) (cmd, output string, err error) {
+	cmd, output, _, err = c.runWithoutIgnored(path, func(path string) []string {
+		return c.kubectlArgs("apply", "--dry-run=client", "--validate=true", "-f", path)
+	}, c.run)
+	return cmd, output, err
+}
+
+// RolloutStatus waits for the rollout of a single workload to complete, or for the timeout to expire. kubectl only checks
+// individual resources, so workloads must be named rather than given by the file that defines them. An empty namespace is
+// the namespace of the kubectl context. It returns the full rollout status command and its output.
+func (c *Client) RolloutStatus(kind, name, namespace string, timeout time.Duration) (cmd, output string, err error) {
+	args := []string{"rollout", "status", strings.ToLower(kind) + "/" + name, fmt.Sprintf("--timeout=%v", timeout)}
+	if namespace != "" {
+		args = append(args, "-n", namespace)
+	}
+	return c.run(c.kubectlArgs(args...))
+}
+
+// Label sets the given labels on every object defined in the file located at path, overwriting existing values.
+// Ignored objects are not labeled. It returns the full label command and its output.
+func (c *Client) Label(path string, labels map[string]string) (cmd, output string, err error) {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	cmd, output, _, err = c.runWithoutIgnored(path, func(path string) []string {
+		args := []string{"label", "-f", path, "--overwrite"}
+		for _, k := range keys {
+			args = append(args, fmt.Sprintf("%s=%s", k, labels[k]))
+		}
+		return c.kubectlArgs(args...)
+	}, c.run)
+	return cmd, output, err
+}
+
+// kubectlArgs returns the full argument list for a kubectl command, including the flags shared by all commands.
+func (c *Client) kubectlArgs(args ...string) []string {
+	kubectl := c.KubectlPath
+	if kubectl == "" {
+		kubectl = "kubectl"
+	}
+	args = append([]string{kubectl}, args...)
 	if c.LogLevel > -1 {
 		args = append(args, fmt.Sprintf("-v=%d", c.LogLevel))
 	}
 	if c.Server != "" {
 		args = append(args, fmt.Sprintf("--kubeconfig=%s", c.kubeconfigFilePath))
 	}
+	return args
+}
+
+// runWithRetry executes the kubectl command described by args for the file located at path, and runs it again while it fails
+// with an error that Retry considers transient. The output of every failed attempt is kept ahead of the output of the last
+// attempt, so that the retries show up in the run's results.
+func (c *Client) runWithRetry(path string, args []string) (cmd, output string, err error) {
+	cmd, output, err = c.run(args)
+	if c.Retry == nil {
+		return cmd, output, err
+	}
+	start := time.Now()
+	backoff := c.Retry.Backoff
+	previous := ""
+	for attempt := 1; err != nil && attempt < c.Retry.MaxAttempts && c.Retry.retryable(output, err); attempt++ {
+		if c.Retry.MaxDuration > 0 && time.Since(start)+backoff > c.Retry.MaxDuration {
+			break
+		}
+		log.Printf("Attempt %v of %v failed, retrying in %v:\n%v\n%v", attempt, cmd, backoff, output, err)
+		if c.ObserveRetry != nil {
+			c.ObserveRetry(path, attempt, err)
+		}
+		previous += fmt.Sprintf("Attempt %v failed, retrying in %v: %v\n%v", attempt, backoff, err, output)
+		if !strings.HasSuffix(previous, "\n") {
+			previous += "\n"
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+		cmd, output, err = c.run(args)
+	}
+	return cmd, previous + output, err
+}
+
+// run executes the kubectl command described by args and returns the joined command and its combined output.
+// At most MaxOutputBytes of the output are kept, so that a huge output cannot exhaust memory, except for the lines that
+// match ApplyOutputLine.
+func (c *Client) run(args []string) (cmd, output string, err error) {
 	cmd = strings.Join(args, " ")
-	stdout, err := exec.Command(args[0], args[1:]...).CombinedOutput()
-	if err != nil {
-		err = fmt.Errorf("Error: %v", err)
+	buffer := &sysutil.BoundedBuffer{Max: c.MaxOutputBytes, Keep: isApplyOutputLine}
+	command := exec.Command(args[0], args[1:]...)
+	command.Stdout = buffer
+	command.Stderr = buffer
+	if err = command.Run(); err != nil {
+		err = fmt.Errorf("Error: %w", err)
 	}
-	return cmd, string(stdout), err
+	if buffer.Omitted() > 0 {
+		log.Printf("Omitted %v bytes of output from %v", buffer.Omitted(), cmd)
+	}
+	return cmd, buffer.String(), err
+}
+
+// isApplyOutputLine returns true if line matches ApplyOutputLine, ignoring surrounding whitespace.
+func isApplyOutputLine(line []byte) bool {
+	return ApplyOutputLine.Match(bytes.TrimSpace(line))
 }
@@ -2,7 +2,12 @@ package kube
 
 import (
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -121,3 +126,183 @@ func createAndAssert(t *testing.T, tc testCase) {
 	err := isCompatible(tc.kubectlStdout)
 	assert.Equal(tc.expected, err)
 }
+
+func TestClientDiff(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "kubectl")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	kubectl := filepath.Join(dir, "kubectl")
+	c := &Client{KubectlPath: kubectl, LogLevel: -1}
+	writeKubectl := func(script string) {
+		assert.Nil(ioutil.WriteFile(kubectl, []byte("#!/bin/sh\n"+script), 0755))
+	}
+
+	// No differences
+	writeKubectl("exit 0\n")
+	cmd, output, err := c.Diff("file.yaml")
+	assert.Equal(kubectl+" diff -f file.yaml", cmd)
+	assert.Equal("", output)
+	assert.Nil(err)
+
+	// Differences found
+	writeKubectl("echo '-  replicas: 1'\nexit 1\n")
+	_, output, err = c.Diff("file.yaml")
+	assert.Equal("-  replicas: 1\n", output)
+	assert.Nil(err)
+
+	// Diff failed
+	writeKubectl("echo 'connection refused'\nexit 2\n")
+	_, output, err = c.Diff("file.yaml")
+	assert.Equal("connection refused\n", output)
+	assert.EqualError(err, "Error: exit status 2")
+}
+
+func TestClientCanI(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "kubectl")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	kubectl := filepath.Join(dir, "kubectl")
+	c := &Client{KubectlPath: kubectl, LogLevel: -1}
+	writeKubectl := func(script string) {
+		assert.Nil(ioutil.WriteFile(kubectl, []byte("#!/bin/sh\n"+script), 0755))
+	}
+
+	writeKubectl("echo yes\n")
+	allowed, err := c.CanI("patch", "deployment.apps", "team-a")
+	assert.True(allowed)
+	assert.Nil(err)
+
+	writeKubectl("echo no\nexit 1\n")
+	allowed, err = c.CanI("patch", "deployment.apps", "")
+	assert.False(allowed)
+	assert.Nil(err)
+
+	// A failed check is an error, the script echoes its arguments to show the command.
+	writeKubectl("echo \"$@\"\nexit 1\n")
+	allowed, err = c.CanI("create", "namespace", "")
+	assert.False(allowed)
+	assert.EqualError(err, "Error: exit status 1: auth can-i create namespace")
+	_, err = c.CanI("get", "configmap", "team-a")
+	assert.EqualError(err, "Error: exit status 1: auth can-i get configmap --namespace team-a")
+}
+
+func TestClientApplyRetry(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "kubectl")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	kubectl := filepath.Join(dir, "kubectl")
+	counter := filepath.Join(dir, "attempts")
+	retries := []int{}
+	c := &Client{KubectlPath: kubectl, LogLevel: -1, ObserveRetry: func(path string, attempt int, err error) {
+		assert.Equal("file.yaml", path)
+		retries = append(retries, attempt)
+	}}
+	// The script fails with the given output and exit code until it has been run the given number of times.
+	writeKubectl := func(failures int, output string, code int) {
+		os.Remove(counter)
+		script := fmt.Sprintf("#!/bin/sh\necho x >> %v\nif [ $(wc -l < %v) -le %v ]; then echo '%v'; exit %v; fi\necho 'deployment.apps/web configured'\n", counter, counter, failures, output, code)
+		assert.Nil(ioutil.WriteFile(kubectl, []byte(script), 0755))
+	}
+
+	// Without a retry policy, failures are returned immediately.
+	writeKubectl(1, "connection refused", 1)
+	_, output, err := c.Apply("file.yaml")
+	assert.Equal("connection refused\n", output)
+	assert.EqualError(err, "Error: exit status 1")
+
+	c.Retry = &RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond, Patterns: []*regexp.Regexp{regexp.MustCompile("connection refused")}, ExitCodes: []int{7}}
+
+	// Retried until it succeeds, keeping the output of the failed attempts.
+	writeKubectl(2, "connection refused", 1)
+	cmd, output, err := c.Apply("file.yaml")
+	assert.Equal(kubectl+" apply -f file.yaml", cmd)
+	assert.Equal("Attempt 1 failed, retrying in 1ms: Error: exit status 1\nconnection refused\nAttempt 2 failed, retrying in 2ms: Error: exit status 1\nconnection refused\ndeployment.apps/web configured\n", output)
+	assert.Nil(err)
+	assert.Equal([]int{1, 2}, retries)
+
+	// Retried by exit code, up to MaxAttempts.
+	retries = []int{}
+	writeKubectl(3, "", 7)
+	_, _, err = c.DryRun("file.yaml")
+	assert.EqualError(err, "Error: exit status 7")
+	assert.Equal([]int{1, 2}, retries)
+
+	// Errors that are not transient are not retried.
+	retries = []int{}
+	writeKubectl(1, "field is immutable", 1)
+	_, output, err = c.Apply("file.yaml")
+	assert.Equal("field is immutable\n", output)
+	assert.EqualError(err, "Error: exit status 1")
+	assert.Equal([]int{}, retries)
+
+	// No retry is started that would exceed MaxDuration.
+	c.Retry.Backoff = time.Hour
+	c.Retry.MaxDuration = time.Minute
+	writeKubectl(1, "connection refused", 1)
+	_, _, err = c.Apply("file.yaml")
+	assert.EqualError(err, "Error: exit status 1")
+	assert.Equal([]int{}, retries)
+}
+
+func TestNewRetryPolicy(t *testing.T) {
+	assert := assert.New(t)
+
+	p, err := NewRetryPolicy(3, time.Second, time.Minute, []string{"timeout", "webhook .* failed"}, []string{"7"})
+	assert.Nil(err)
+	assert.Equal(3, p.MaxAttempts)
+	assert.Equal(2, len(p.Patterns))
+	assert.Equal([]int{7}, p.ExitCodes)
+	assert.True(p.retryable("calling webhook foo failed", fmt.Errorf("exit status 1")))
+	assert.False(p.retryable("field is immutable", fmt.Errorf("exit status 1")))
+
+	_, err = NewRetryPolicy(3, time.Second, time.Minute, []string{"("}, []string{})
+	assert.EqualError(err, "Invalid retry pattern \"(\": error parsing regexp: missing closing ): `(`")
+	_, err = NewRetryPolicy(3, time.Second, time.Minute, []string{}, []string{"x"})
+	assert.EqualError(err, "Invalid retry exit code \"x\", must be an integer")
+}
+
+func TestClientApplyIgnored(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "kubectl")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	kubectl := filepath.Join(dir, "kubectl")
+	c := &Client{KubectlPath: kubectl, LogLevel: -1}
+	// The script prints the file it is given, so that the filtered copy shows up in the output.
+	assert.Nil(ioutil.WriteFile(kubectl, []byte("#!/bin/sh\necho \"$3\"\ncat \"$3\"\n"), 0755))
+	writeFile := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		assert.Nil(ioutil.WriteFile(path, []byte(content), 0644))
+		return path
+	}
+
+	// Files without ignored objects are applied as they are
+	path := writeFile("plain.yaml", "kind: ConfigMap\nmetadata:\n  name: a\n")
+	cmd, output, err := c.Apply(path)
+	assert.Equal(kubectl+" apply -f "+path, cmd)
+	assert.Equal(path+"\nkind: ConfigMap\nmetadata:\n  name: a\n", output)
+	assert.Nil(err)
+	assert.Equal(0, IgnoredObjects(output))
+
+	// Ignored objects are left out, and the command and output refer to the original file
+	path = writeFile("mixed.yaml", "kind: ConfigMap\nmetadata:\n  name: a\n  annotations:\n    kube-applier.io/ignore: \"true\"\n---\nkind: ConfigMap\nmetadata:\n  name: b\n---\nkind: ConfigMap\nmetadata:\n  name: c\n  annotations:\n    kube-applier.io/ignore: \"false\"\n")
+	cmd, output, err = c.Apply(path)
+	assert.Equal(kubectl+" apply -f "+path, cmd)
+	assert.Equal("Ignored 1 objects annotated kube-applier.io/ignore=true\n"+path+"\n\nkind: ConfigMap\nmetadata:\n  name: b\n\n---\n\nkind: ConfigMap\nmetadata:\n  name: c\n  annotations:\n    kube-applier.io/ignore: \"false\"\n", output)
+	assert.Nil(err)
+	assert.Equal(1, IgnoredObjects(output))
+
+	// If every object is ignored, kubectl is not run
+	path = writeFile("ignored.json", "{\"kind\": \"ConfigMap\", \"metadata\": {\"name\": \"a\", \"annotations\": {\"kube-applier.io/ignore\": \"true\"}}}")
+	cmd, output, err = c.Apply(path)
+	assert.Equal(kubectl+" apply -f "+path, cmd)
+	assert.Equal("Ignored 1 objects annotated kube-applier.io/ignore=true\n", output)
+	assert.Nil(err)
+}
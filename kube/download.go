@@ -0,0 +1,74 @@
+package kube
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// kubectlDownloadURLFormat is the release URL of a kubectl binary, formatted with the version, OS and architecture.
+var kubectlDownloadURLFormat = "https://dl.k8s.io/release/%s/bin/%s/%s/kubectl"
+
+// DownloadKubectl downloads the kubectl binary for version (e.g. "v1.24.3") into dir and returns its path.
+// The binary must match the hex-encoded SHA256 checksum, otherwise it is discarded and an error is returned.
+// A binary already present in dir with the expected checksum is reused.
+func DownloadKubectl(version, checksum, dir string) (string, error) {
+	checksum = strings.ToLower(checksum)
+	path := filepath.Join(dir, "kubectl-"+version)
+	if existing, err := ioutil.ReadFile(path); err == nil && sha256Hex(existing) == checksum {
+		log.Printf("Using previously downloaded kubectl %v at %v", version, path)
+		return path, nil
+	}
+
+	url := fmt.Sprintf(kubectlDownloadURLFormat, version, runtime.GOOS, runtime.GOARCH)
+	log.Printf("Downloading kubectl %v from %v", version, url)
+	resp, err := http.Get(url)
+	if err != nil {
+		return "", fmt.Errorf("Error downloading kubectl %v: %v", version, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Error downloading kubectl %v: %v returned %v", version, url, resp.Status)
+	}
+	binary, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("Error downloading kubectl %v: %v", version, err)
+	}
+	if actual := sha256Hex(binary); actual != checksum {
+		return "", fmt.Errorf("Error verifying kubectl %v: expected SHA256 %v, got %v", version, checksum, actual)
+	}
+
+	// Write to a temporary file first so an interrupted write never leaves a partial binary at path.
+	f, err := ioutil.TempFile(dir, "kubectl-download")
+	if err != nil {
+		return "", fmt.Errorf("Error writing kubectl %v: %v", version, err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(binary); err != nil {
+		f.Close()
+		return "", fmt.Errorf("Error writing kubectl %v: %v", version, err)
+	}
+	if err := f.Close(); err != nil {
+		return "", fmt.Errorf("Error writing kubectl %v: %v", version, err)
+	}
+	if err := os.Chmod(f.Name(), 0755); err != nil {
+		return "", fmt.Errorf("Error writing kubectl %v: %v", version, err)
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return "", fmt.Errorf("Error writing kubectl %v: %v", version, err)
+	}
+	return path, nil
+}
+
+// sha256Hex returns the hex-encoded SHA256 checksum of data.
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,65 @@
+package kube
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDownloadKubectl(t *testing.T) {
+	assert := assert.New(t)
+
+	binary := []byte("kubectl binary")
+	checksum := sha256Hex(binary)
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path != fmt.Sprintf("/v1.24.3/bin/%s/%s/kubectl", runtime.GOOS, runtime.GOARCH) {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(binary)
+	}))
+	defer server.Close()
+	defer func(format string) { kubectlDownloadURLFormat = format }(kubectlDownloadURLFormat)
+	kubectlDownloadURLFormat = server.URL + "/%s/bin/%s/%s/kubectl"
+
+	dir, err := ioutil.TempDir("", "kubectl")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	// Checksum mismatch
+	_, err = DownloadKubectl("v1.24.3", sha256Hex([]byte("other")), dir)
+	assert.EqualError(err, fmt.Sprintf("Error verifying kubectl v1.24.3: expected SHA256 %v, got %v", sha256Hex([]byte("other")), checksum))
+	_, err = os.Stat(filepath.Join(dir, "kubectl-v1.24.3"))
+	assert.True(os.IsNotExist(err))
+
+	// Unknown version
+	_, err = DownloadKubectl("v0.0.0", checksum, dir)
+	assert.NotNil(err)
+
+	// Successful download
+	path, err := DownloadKubectl("v1.24.3", checksum, dir)
+	assert.Nil(err)
+	assert.Equal(filepath.Join(dir, "kubectl-v1.24.3"), path)
+	contents, err := ioutil.ReadFile(path)
+	assert.Nil(err)
+	assert.Equal(binary, contents)
+	info, err := os.Stat(path)
+	assert.Nil(err)
+	assert.Equal(os.FileMode(0755), info.Mode().Perm())
+
+	// Existing binary is reused without downloading again
+	requests = 0
+	path, err = DownloadKubectl("v1.24.3", checksum, dir)
+	assert.Nil(err)
+	assert.Equal(filepath.Join(dir, "kubectl-v1.24.3"), path)
+	assert.Equal(0, requests)
+}
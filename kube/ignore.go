@@ -0,0 +1,109 @@
+package kube
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// IgnoreAnnotation excludes an object from every kubectl command run for its file if it is set to "true", so that a single object
+// can be left alone for a while without removing it from the repo.
+const IgnoreAnnotation = "kube-applier.io/ignore"
+
+// ignoredNote is the first line of the output of a command that left out ignored objects.
+const ignoredNote = "Ignored %d objects annotated " + IgnoreAnnotation + "=true\n"
+
+var (
+	documentSeparator  = regexp.MustCompile(`(?m)^---[ \t]*$`)
+	ignoredNotePattern = regexp.MustCompile(`^Ignored (\d+) objects annotated ` + regexp.QuoteMeta(IgnoreAnnotation) + `=true\n`)
+)
+
+// IgnoredObjects returns the number of objects that were left out of a command because of IgnoreAnnotation, given its output.
+func IgnoredObjects(output string) int {
+	match := ignoredNotePattern.FindStringSubmatch(output)
+	if match == nil {
+		return 0
+	}
+	n, _ := strconv.Atoi(match[1])
+	return n
+}
+
+// WithoutIgnored returns the path of a temporary copy of the file located at path without the documents annotated with
+// IgnoreAnnotation, and the number of documents left out. The copy must be removed by the caller if it is not path itself.
+// If no document is left out, or the file cannot be read or parsed, path itself is returned and left to kubectl to report on.
+// If every document is left out, the returned path is empty. Objects inside a List are not checked.
+func WithoutIgnored(path string) (filtered string, ignored int, err error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return path, 0, nil
+	}
+	kept := []string{}
+	for _, document := range documentSeparator.Split(string(content), -1) {
+		var object struct {
+			Metadata struct {
+				Annotations map[string]string `yaml:"annotations"`
+			} `yaml:"metadata"`
+		}
+		if err := yaml.Unmarshal([]byte(document), &object); err != nil {
+			return path, 0, nil
+		}
+		if object.Metadata.Annotations[IgnoreAnnotation] == "true" {
+			ignored++
+			continue
+		}
+		if strings.TrimSpace(document) != "" {
+			kept = append(kept, document)
+		}
+	}
+	if ignored == 0 {
+		return path, 0, nil
+	}
+	if len(kept) == 0 {
+		return "", ignored, nil
+	}
+	f, err := ioutil.TempFile("", "kube-applier-*"+filepath.Ext(path))
+	if err != nil {
+		return "", 0, fmt.Errorf("Error: could not leave out ignored objects of %v: %v", path, err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(strings.Join(kept, "\n---\n")); err != nil {
+		os.Remove(f.Name())
+		return "", 0, fmt.Errorf("Error: could not leave out ignored objects of %v: %v", path, err)
+	}
+	return f.Name(), ignored, nil
+}
+
+// runWithoutIgnored runs the kubectl command built by args for the file located at path, without the objects annotated with
+// IgnoreAnnotation. The command and its output refer to path rather than to the temporary copy that was passed to kubectl.
+// If every object is ignored, kubectl is not run and the output is empty.
+func (c *Client) runWithoutIgnored(path string, args func(path string) []string, run func(args []string) (cmd, output string, err error)) (cmd, output string, ignored int, err error) {
+	filtered, ignored, err := WithoutIgnored(path)
+	if err != nil {
+		return strings.Join(args(path), " "), "", 0, err
+	}
+	if filtered == "" {
+		return strings.Join(args(path), " "), "", ignored, nil
+	}
+	if filtered != path {
+		defer os.Remove(filtered)
+	}
+	cmd, output, err = run(args(filtered))
+	if filtered != path {
+		cmd, output = strings.Replace(cmd, filtered, path, -1), strings.Replace(output, filtered, path, -1)
+	}
+	return cmd, output, ignored, err
+}
+
+// withIgnoredNote prepends a note of the number of ignored objects to the output, if there are any.
+func withIgnoredNote(ignored int, output string) string {
+	if ignored == 0 {
+		return output
+	}
+	return fmt.Sprintf(ignoredNote, ignored) + output
+}
@@ -5,6 +5,7 @@ package kube
 
 import (
 	gomock "github.com/golang/mock/gomock"
+	time "time"
 )
 
 // Mock of ClientInterface interface
@@ -40,6 +41,89 @@ func (_mr *_MockClientInterfaceRecorder) Apply(arg0 interface{}) *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "Apply", arg0)
 }
 
+func (_m *MockClientInterface) Validate(_param0 string) (string, string, error) {
+	ret := _m.ctrl.Call(_m, "Validate", _param0)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(string)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+func (_mr *_MockClientInterfaceRecorder) Validate(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Validate", arg0)
+}
+
+func (_m *MockClientInterface) RolloutStatus(_param0 string, _param1 string, _param2 string, _param3 time.Duration) (string, string, error) {
+	ret := _m.ctrl.Call(_m, "RolloutStatus", _param0, _param1, _param2, _param3)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(string)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+func (_mr *_MockClientInterfaceRecorder) RolloutStatus(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "RolloutStatus", arg0, arg1, arg2, arg3)
+}
+
+func (_m *MockClientInterface) Label(_param0 string, _param1 map[string]string) (string, string, error) {
+	ret := _m.ctrl.Call(_m, "Label", _param0, _param1)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(string)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+func (_mr *_MockClientInterfaceRecorder) Label(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Label", arg0, arg1)
+}
+
+func (_m *MockClientInterface) Replace(_param0 string) (string, string, error) {
+	ret := _m.ctrl.Call(_m, "Replace", _param0)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(string)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+func (_mr *_MockClientInterfaceRecorder) Replace(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Replace", arg0)
+}
+
+func (_m *MockClientInterface) Diff(_param0 string) (string, string, error) {
+	ret := _m.ctrl.Call(_m, "Diff", _param0)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(string)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+func (_mr *_MockClientInterfaceRecorder) Diff(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Diff", arg0)
+}
+
+func (_m *MockClientInterface) CanI(_param0 string, _param1 string, _param2 string) (bool, error) {
+	ret := _m.ctrl.Call(_m, "CanI", _param0, _param1, _param2)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockClientInterfaceRecorder) CanI(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "CanI", arg0, arg1, arg2)
+}
+
+func (_m *MockClientInterface) DryRun(_param0 string) (string, string, error) {
+	ret := _m.ctrl.Call(_m, "DryRun", _param0)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(string)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+func (_mr *_MockClientInterfaceRecorder) DryRun(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "DryRun", arg0)
+}
+
 func (_m *MockClientInterface) CheckVersion() error {
 	ret := _m.ctrl.Call(_m, "CheckVersion")
 	ret0, _ := ret[0].(error)
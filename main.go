@@ -1,11 +1,15 @@
 package main
 
 import (
+	"io/ioutil"
 	"log"
+	"net/http"
+	"os"
 	"strings"
 	"time"
 
 	"github.com/box/kube-applier/applylist"
+	"github.com/box/kube-applier/auth"
 	"github.com/box/kube-applier/git"
 	"github.com/box/kube-applier/kube"
 	"github.com/box/kube-applier/metrics"
@@ -14,6 +18,12 @@ import (
 	"github.com/box/kube-applier/webserver"
 )
 
+// version is set at build time with -ldflags "-X main.version=<version>".
+var version = "dev"
+
+// templatePath overrides the path of the status page template if set, see the "dev" subcommand.
+var templatePath string
+
 const (
 	// Default number of seconds to wait before checking the Git repo for new commits.
 	defaultPollIntervalSeconds = 5
@@ -21,14 +31,67 @@ const (
 	// Default number of seconds to wait in between apply runs (if no new commits to the repo have been made).
 	defaultFullRunIntervalSeconds = 5 * 60
 
+	// Default number of seconds to wait for the rollout of a file's workloads after applying it.
+	defaultRolloutTimeoutSeconds = 5 * 60
+
+	// Default number of seconds a hook may run before it is killed.
+	defaultHookTimeoutSeconds = 5 * 60
+
+	// Default number of seconds to wait before the first retry of an apply that failed with a transient error.
+	defaultApplyRetryBackoffSeconds = 2
+
+	// Default maximum number of seconds spent retrying an apply.
+	defaultApplyRetryMaxSeconds = 60
+
+	// Default number of seconds to wait for the policy server to evaluate a file.
+	defaultPolicyTimeoutSeconds = 10
+
+	// Default number of seconds to wait for the webhook receiver to accept a run result.
+	defaultWebhookTimeoutSeconds = 10
+
+	// Default number of seconds a drift report is reused before it is computed again.
+	defaultDriftReportTTLSeconds = 5 * 60
+
+	// Default number of apply outcomes retained per file to detect flapping files.
+	defaultHistorySize = 10
+
+	// Default number of seconds a file deleted from the repo is listed on the status page.
+	defaultTombstoneTTLSeconds = 24 * 60 * 60
+
+	// Default maximum number of seconds between polls of the repo after consecutive failed polls.
+	defaultPollBackoffMaxSeconds = 5 * 60
+
+	// Default number of seconds after which a file that keeps failing counts towards the files_failing_too_long metric.
+	defaultSLOFailureThresholdSeconds = 30 * 60
+
 	// Number of seconds to wait in between attempts to locate the repo at the specified path.
 	// Git-sync atomically places the repo at the specified path once it is finished pulling, so it will not be present immediately.
 	waitForRepoInterval = 1 * time.Second
 )
 
 func main() {
+	args, err := loadConfigFile(os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(args) > 0 && args[0] == "render" {
+		render(args[1:])
+		return
+	}
+	if len(args) > 0 && args[0] == "check-config" {
+		checkConfig()
+		return
+	}
+	if len(args) > 0 && args[0] == "dev" {
+		dev(args[1:])
+	}
+
 	repoPath := sysutil.GetRequiredEnvString("REPO_PATH")
-	listenPort := sysutil.GetRequiredEnvInt("LISTEN_PORT")
+	listenAddress := sysutil.GetEnvStringOrDefault("LISTEN_ADDRESS", "")
+	listenPort := 0
+	if listenAddress == "" {
+		listenPort = sysutil.GetRequiredEnvInt("LISTEN_PORT")
+	}
 	server := sysutil.GetEnvStringOrDefault("SERVER", "")
 	blacklistPath := sysutil.GetEnvStringOrDefault("BLACKLIST_PATH", "")
 	logLevel := sysutil.GetEnvIntOrDefault("LOG_LEVEL", -1)
@@ -37,12 +100,134 @@ func main() {
 	// If the env var is not defined or if the file is empty act like a no-op and
 	// all files will be considered.
 	whitelistPath := sysutil.GetEnvStringOrDefault("WHITELIST_PATH", "")
+	clusterResourcesPath := sysutil.GetEnvStringOrDefault("CLUSTER_RESOURCES_PATH", "")
+	recursive := sysutil.GetEnvBoolOrDefault("RECURSIVE", true)
 	diffURLFormat := sysutil.GetEnvStringOrDefault("DIFF_URL_FORMAT", "")
 	pollInterval := time.Duration(sysutil.GetEnvIntOrDefault("POLL_INTERVAL_SECONDS", defaultPollIntervalSeconds)) * time.Second
+	pollBackoffMax := time.Duration(sysutil.GetEnvIntOrDefault("POLL_BACKOFF_MAX_SECONDS", defaultPollBackoffMaxSeconds)) * time.Second
+	staleGracePeriod := time.Duration(sysutil.GetEnvIntOrDefault("STALE_GRACE_PERIOD_SECONDS", 0)) * time.Second
 	fullRunInterval := time.Duration(sysutil.GetEnvIntOrDefault("FULL_RUN_INTERVAL_SECONDS", defaultFullRunIntervalSeconds)) * time.Second
+	sloFailureThreshold := time.Duration(sysutil.GetEnvIntOrDefault("SLO_FAILURE_THRESHOLD_SECONDS", defaultSLOFailureThresholdSeconds)) * time.Second
+	sloApplyInterval := time.Duration(sysutil.GetEnvIntOrDefault("SLO_APPLY_INTERVAL_SECONDS", 2*int(fullRunInterval.Seconds()))) * time.Second
+	waitForRollout := sysutil.GetEnvBoolOrDefault("WAIT_FOR_ROLLOUT", false)
+	ownershipLabels := sysutil.GetEnvBoolOrDefault("OWNERSHIP_LABELS", false)
+	minAppliedResources := sysutil.GetEnvIntOrDefault("MIN_APPLIED_RESOURCES", 0)
+	rolloutTimeout := time.Duration(sysutil.GetEnvIntOrDefault("ROLLOUT_TIMEOUT_SECONDS", defaultRolloutTimeoutSeconds)) * time.Second
+	readOnly := &run.ReadOnly{}
+	readOnly.Set(sysutil.GetEnvBoolOrDefault("READ_ONLY", false))
+	authTokensPath := sysutil.GetEnvStringOrDefault("AUTH_TOKENS_PATH", "")
+	authAllowedCNs := sysutil.GetEnvStringSliceOrDefault("AUTH_ALLOWED_CNS", []string{})
+	authAllowedOrgs := sysutil.GetEnvStringSliceOrDefault("AUTH_ALLOWED_ORGS", []string{})
+	authAllowAnonymousReads := sysutil.GetEnvBoolOrDefault("AUTH_ALLOW_ANONYMOUS_READS", false)
+	forceRunAllowedUsers := sysutil.GetEnvStringSliceOrDefault("FORCE_RUN_ALLOWED_USERS", []string{})
+	tlsCertPath := sysutil.GetEnvStringOrDefault("TLS_CERT_PATH", "")
+	tlsKeyPath := sysutil.GetEnvStringOrDefault("TLS_KEY_PATH", "")
+	tlsClientCAPath := sysutil.GetEnvStringOrDefault("TLS_CLIENT_CA_PATH", "")
+	maxOutputLines := sysutil.GetEnvIntOrDefault("MAX_OUTPUT_LINES", 0)
+	maxOutputBytes := sysutil.GetEnvIntOrDefault("MAX_OUTPUT_BYTES", 0)
+	minRunInterval := time.Duration(sysutil.GetEnvIntOrDefault("MIN_RUN_INTERVAL_SECONDS", 0)) * time.Second
+	runSplay := time.Duration(sysutil.GetEnvIntOrDefault("RUN_SPLAY_SECONDS", 0)) * time.Second
+	historySize := sysutil.GetEnvIntOrDefault("HISTORY_SIZE", defaultHistorySize)
+	tombstoneTTL := time.Duration(sysutil.GetEnvIntOrDefault("TOMBSTONE_TTL_SECONDS", defaultTombstoneTTLSeconds)) * time.Second
+	runbooksPath := sysutil.GetEnvStringOrDefault("RUNBOOKS_PATH", "")
+	circuitBreakerThreshold := sysutil.GetEnvIntOrDefault("CIRCUIT_BREAKER_THRESHOLD", 0)
+	autoApplyAuthors := sysutil.GetEnvStringSliceOrDefault("AUTO_APPLY_AUTHORS", []string{})
+	applyWindowSpec := sysutil.GetEnvStringOrDefault("APPLY_WINDOW", "")
+	applyWindowTimezone := sysutil.GetEnvStringOrDefault("APPLY_WINDOW_TIMEZONE", "UTC")
+	applyWindowAllowForced := sysutil.GetEnvBoolOrDefault("APPLY_WINDOW_ALLOW_FORCED", true)
+	statusTimezone := sysutil.GetEnvStringOrDefault("STATUS_TIMEZONE", "")
+	preApplyHookPath := sysutil.GetEnvStringOrDefault("PRE_APPLY_HOOK", "")
+	postApplyHookPath := sysutil.GetEnvStringOrDefault("POST_APPLY_HOOK", "")
+	hookTimeout := time.Duration(sysutil.GetEnvIntOrDefault("HOOK_TIMEOUT_SECONDS", defaultHookTimeoutSeconds)) * time.Second
+	kubectlVersion := sysutil.GetEnvStringOrDefault("KUBECTL_VERSION", "")
+	kubectlSHA256 := sysutil.GetEnvStringOrDefault("KUBECTL_SHA256", "")
+	kubectlDownloadDir := sysutil.GetEnvStringOrDefault("KUBECTL_DOWNLOAD_DIR", os.TempDir())
 
-	if diffURLFormat != "" && !strings.Contains(diffURLFormat, "%s") {
-		log.Fatalf("Invalid DIFF_URL_FORMAT, must contain %q: %v", "%s", diffURLFormat)
+	if err := validateDiffURLFormat(diffURLFormat); err != nil {
+		log.Fatal(err)
+	}
+
+	checkEncryptedFiles := sysutil.GetEnvBoolOrDefault("CHECK_ENCRYPTED_FILES", false)
+	namespacesFirst := sysutil.GetEnvBoolOrDefault("NAMESPACES_FIRST", false)
+	replaceKinds := sysutil.GetEnvStringSliceOrDefault("REPLACE_KINDS", []string{})
+	applyPhases := sysutil.GetEnvBoolOrDefault("APPLY_PHASES", false)
+	applyRetryAttempts := sysutil.GetEnvIntOrDefault("APPLY_RETRY_ATTEMPTS", 1)
+	applyRetryBackoff := time.Duration(sysutil.GetEnvIntOrDefault("APPLY_RETRY_BACKOFF_SECONDS", defaultApplyRetryBackoffSeconds)) * time.Second
+	applyRetryMax := time.Duration(sysutil.GetEnvIntOrDefault("APPLY_RETRY_MAX_SECONDS", defaultApplyRetryMaxSeconds)) * time.Second
+	applyRetryPatterns := sysutil.GetEnvStringSliceOrDefault("APPLY_RETRY_PATTERNS", kube.DefaultRetryPatterns)
+	applyRetryExitCodes := sysutil.GetEnvStringSliceOrDefault("APPLY_RETRY_EXIT_CODES", []string{})
+	applyGroupLimits := sysutil.GetEnvStringSliceOrDefault("APPLY_GROUP_LIMITS", []string{})
+	guardrails := newGuardrails()
+	policyURL := sysutil.GetEnvStringOrDefault("POLICY_URL", "")
+	policyTimeout := time.Duration(sysutil.GetEnvIntOrDefault("POLICY_TIMEOUT_SECONDS", defaultPolicyTimeoutSeconds)) * time.Second
+	webhookURL := sysutil.GetEnvStringOrDefault("WEBHOOK_URL", "")
+	webhookSecretPath := sysutil.GetEnvStringOrDefault("WEBHOOK_SECRET_PATH", "")
+	webhookTimeout := time.Duration(sysutil.GetEnvIntOrDefault("WEBHOOK_TIMEOUT_SECONDS", defaultWebhookTimeoutSeconds)) * time.Second
+	rbacCheckInterval := time.Duration(sysutil.GetEnvIntOrDefault("RBAC_CHECK_INTERVAL_SECONDS", 0)) * time.Second
+	driftReportTTL := time.Duration(sysutil.GetEnvIntOrDefault("DRIFT_REPORT_TTL_SECONDS", defaultDriftReportTTLSeconds)) * time.Second
+	applyCriticalPaths := sysutil.GetEnvStringSliceOrDefault("APPLY_CRITICAL_PATHS", []string{})
+
+	validateMode, err := run.ParseValidateMode(sysutil.GetEnvStringOrDefault("VALIDATE_MODE", string(run.ValidateOff)))
+	if err != nil {
+		log.Fatalf("Invalid VALIDATE_MODE: %v", err)
+	}
+
+	applyOrderPolicy, err := run.ParseOrderPolicy(sysutil.GetEnvStringOrDefault("APPLY_ORDER", string(run.OrderPath)))
+	if err != nil {
+		log.Fatalf("Invalid APPLY_ORDER: %v", err)
+	}
+
+	// Every setting has been read, so any other key in the config file would be silently ignored.
+	if unknown := sysutil.UnknownConfigKeys(); len(unknown) > 0 {
+		log.Fatalf("Invalid config file: unknown keys %v, see the environment variables in the README", strings.Join(unknown, ", "))
+	}
+
+	var applyRetry *kube.RetryPolicy
+	if applyRetryAttempts > 1 {
+		applyRetry, err = kube.NewRetryPolicy(applyRetryAttempts, applyRetryBackoff, applyRetryMax, applyRetryPatterns, applyRetryExitCodes)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var groupLimits *run.GroupLimits
+	if len(applyGroupLimits) > 0 {
+		groupLimits, err = run.ParseGroupLimits(applyGroupLimits)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var applyWindow *run.ApplyWindow
+	if applyWindowSpec != "" {
+		location, err := time.LoadLocation(applyWindowTimezone)
+		if err != nil {
+			log.Fatalf("Invalid APPLY_WINDOW_TIMEZONE: %v", err)
+		}
+		applyWindow, err = run.ParseApplyWindow(applyWindowSpec, location)
+		if err != nil {
+			log.Fatal(err)
+		}
+		applyWindow.AllowForced = applyWindowAllowForced
+	}
+
+	var statusLocation *time.Location
+	if statusTimezone != "" {
+		statusLocation, err = time.LoadLocation(statusTimezone)
+		if err != nil {
+			log.Fatalf("Invalid STATUS_TIMEZONE: %v", err)
+		}
+	}
+
+	if err := validateKubectlVersion(kubectlVersion, kubectlSHA256); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := validateTLS(tlsCertPath, tlsKeyPath, tlsClientCAPath, authTokensPath); err != nil {
+		log.Fatal(err)
+	}
+	if err := validateForceRunAllowedUsers(forceRunAllowedUsers, tlsClientCAPath, authTokensPath); err != nil {
+		log.Fatal(err)
 	}
 
 	clock := &sysutil.Clock{}
@@ -51,20 +236,63 @@ func main() {
 		log.Fatal(err)
 	}
 
+	kubectlPath := ""
+	if kubectlVersion != "" {
+		path, err := kube.DownloadKubectl(kubectlVersion, kubectlSHA256, kubectlDownloadDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		kubectlPath = path
+	}
+
 	kubeClient := &kube.Client{
-		Server:   server,
-		LogLevel: logLevel,
+		Server:         server,
+		LogLevel:       logLevel,
+		KubectlPath:    kubectlPath,
+		MaxOutputBytes: maxOutputBytes,
+		Retry:          applyRetry,
 	}
 	kubeClient.Configure()
 
-	gitUtil := &git.GitUtil{repoPath}
+	gitUtil := &git.GitUtil{RepoPath: repoPath}
 	fileSystem := &sysutil.FileSystem{}
-	listFactory := &applylist.Factory{repoPath, blacklistPath, whitelistPath, fileSystem}
+	listFactory := &applylist.Factory{
+		RepoPath:             repoPath,
+		BlacklistPath:        blacklistPath,
+		WhitelistPath:        whitelistPath,
+		FileSystem:           fileSystem,
+		ClusterResourcesPath: clusterResourcesPath,
+		TopLevelOnly:         !recursive,
+	}
+
+	var authenticator auth.Authenticator
+	if authTokensPath != "" {
+		tokenAuthenticator, err := auth.NewTokenAuthenticator(authTokensPath, fileSystem)
+		if err != nil {
+			log.Fatal(err)
+		}
+		authenticator = tokenAuthenticator
+	} else if tlsClientCAPath != "" {
+		authenticator = &auth.ClientCertAuthenticator{AllowedCNs: authAllowedCNs, AllowedOrgs: authAllowedOrgs}
+	}
+
+	var webhook *webserver.Webhook
+	if webhookURL != "" {
+		webhook = &webserver.Webhook{URL: webhookURL, Client: &http.Client{Timeout: webhookTimeout}}
+		if webhookSecretPath != "" {
+			secret, err := ioutil.ReadFile(webhookSecretPath)
+			if err != nil {
+				log.Fatalf("Error reading webhook secret: %v", err)
+			}
+			webhook.Secret = []byte(strings.TrimSpace(string(secret)))
+		}
+	}
 
 	// Webserver and scheduler send run requests to FullRunQueue channel.
 	// Runner receives the requests and initiates full runs.
 	// Only 1 pending request may sit in the queue at a time.
-	fullRunQueue := make(chan bool, 1)
+	// Full runs are assigned their run ID from runCount when queued, so that the webserver can report it.
+	fullRunQueue := make(chan int, 1)
 
 	// When a new Git commit comes in, scheduler sends the commit hash to QuickRunQueue channel.
 	// Runner receives the hash and initiates a quick run, using the hash for a diff.
@@ -89,29 +317,186 @@ func main() {
 	// The runner will block on popping the current count until it is updated.
 	runCount := make(chan int)
 
-	metrics := &metrics.Prometheus{RunMetrics: runMetrics}
+	// repoStatus is recorded by the scheduler and read by the webserver and metrics.
+	repoStatus := &run.RepoStatus{}
+
+	metrics := &metrics.Prometheus{
+		RunMetrics:       runMetrics,
+		RepoStatus:       repoStatus,
+		FailureThreshold: sloFailureThreshold,
+		ApplyInterval:    sloApplyInterval,
+	}
 	metrics.Configure()
-	batchApplier := &run.BatchApplier{kubeClient}
+	gitUtil.ObserveCommand = metrics.ObserveGitCommand
+	kubeClient.ObserveRetry = metrics.ObserveApplyRetry
+	applyOrder := &run.ApplyOrder{
+		Policy:        applyOrderPolicy,
+		CriticalPaths: applylist.PrependToEachPath(repoPath, applyCriticalPaths),
+		Clock:         clock,
+	}
+	if clusterResourcesPath != "" {
+		applyOrder.ClusterResourcesPath = applylist.PrependToEachPath(repoPath, []string{clusterResourcesPath})[0]
+	}
+	batchApplier := &run.BatchApplier{
+		KubeClient:          kubeClient,
+		FileSystem:          fileSystem,
+		CheckEncryptedFiles: checkEncryptedFiles,
+		RolloutTimeout:      rolloutTimeout,
+		NamespacesFirst:     namespacesFirst,
+		ReplaceKinds:        replaceKinds,
+		ApplyPhases:         applyPhases,
+		GroupLimits:         groupLimits,
+		ApplyOrder:          applyOrder,
+	}
+
+	guardrails.FileSystem = fileSystem
 
-	pollTicker := time.Tick(pollInterval)
-	fullRunTicker := time.Tick(fullRunInterval)
+	var policy run.PolicyInterface
+	if policyURL != "" {
+		policy = &run.Policy{URL: policyURL, Client: &http.Client{Timeout: policyTimeout}, FileSystem: fileSystem}
+	}
+
+	var cooldown *run.Cooldown
+	if minRunInterval > 0 {
+		cooldown = &run.Cooldown{Interval: minRunInterval, Clock: clock}
+	}
 
+	var history *run.History
+	if historySize > 0 {
+		history = &run.History{Size: historySize}
+	}
+
+	var tombstones *run.Tombstones
+	if tombstoneTTL > 0 {
+		tombstones = &run.Tombstones{TTL: tombstoneTTL, FileSystem: fileSystem}
+	}
+
+	var runbooks run.Runbooks
+	if runbooksPath != "" {
+		runbooks, err = run.LoadRunbooks(runbooksPath, fileSystem)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var circuitBreaker *run.CircuitBreaker
+	if circuitBreakerThreshold > 0 {
+		circuitBreaker = &run.CircuitBreaker{Threshold: circuitBreakerThreshold}
+	}
+
+	var authorPolicy *run.AuthorPolicy
+	if len(autoApplyAuthors) > 0 {
+		authorPolicy = &run.AuthorPolicy{AllowedEmails: autoApplyAuthors}
+	}
+
+	var preApplyHook run.HookInterface
+	if preApplyHookPath != "" {
+		preApplyHook = &run.Hook{RepoPath: repoPath, Path: preApplyHookPath, Timeout: hookTimeout, MaxOutputBytes: maxOutputBytes}
+	}
+	var postApplyHook run.HookInterface
+	if postApplyHookPath != "" {
+		postApplyHook = &run.Hook{RepoPath: repoPath, Path: postApplyHookPath, Timeout: hookTimeout, MaxOutputBytes: maxOutputBytes}
+	}
+
+	runQueue := &run.RunQueue{Clock: clock, ApplyOrder: applyOrder}
 	runner := &run.Runner{
-		batchApplier,
-		listFactory,
-		gitUtil,
-		clock,
-		diffURLFormat,
-		"",
-		quickRunQueue,
-		fullRunQueue,
-		runResults,
-		runMetrics,
-		errors,
-		runCount,
-	}
-	scheduler := &run.Scheduler{gitUtil, pollTicker, fullRunTicker, quickRunQueue, fullRunQueue, errors, ""}
-	webserver := &webserver.WebServer{listenPort, clock, metrics.GetHandler(), fullRunQueue, runResults, errors}
+		BatchApplier:    batchApplier,
+		ListFactory:     listFactory,
+		GitUtil:         gitUtil,
+		FileSystem:      fileSystem,
+		Clock:           clock,
+		DiffURLFormat:   diffURLFormat,
+		ValidateMode:    validateMode,
+		SkipMarkers:     &run.SkipMarkers{RepoPath: repoPath, FileSystem: fileSystem},
+		Guardrails:      guardrails,
+		Policy:          policy,
+		PreApplyHook:    preApplyHook,
+		PostApplyHook:   postApplyHook,
+		WaitForRollout:  waitForRollout,
+		OwnershipLabels: ownershipLabels,
+		MinResources:    minAppliedResources,
+		ReadOnly:        readOnly,
+		CircuitBreaker:  circuitBreaker,
+		AuthorPolicy:    authorPolicy,
+		ApplyWindow:     applyWindow,
+		MaxOutputLines:  maxOutputLines,
+		History:         history,
+		Runbooks:        runbooks,
+		Tombstones:      tombstones,
+		RunQueue:        runQueue,
+		Cooldown:        cooldown,
+		QuickRunQueue:   quickRunQueue,
+		FullRunQueue:    fullRunQueue,
+		RunResults:      runResults,
+		RunMetrics:      runMetrics,
+		Errors:          errors,
+		RunCount:        runCount,
+	}
+	scheduler := &run.Scheduler{
+		GitUtil:          gitUtil,
+		QuickRunQueue:    quickRunQueue,
+		FullRunQueue:     fullRunQueue,
+		RunCount:         runCount,
+		Errors:           errors,
+		Clock:            clock,
+		Splay:            runSplay,
+		RepoStatus:       repoStatus,
+		RunQueue:         runQueue,
+		PollInterval:     pollInterval,
+		FullRunInterval:  fullRunInterval,
+		PollBackoffMax:   pollBackoffMax,
+		StaleGracePeriod: staleGracePeriod,
+	}
+	driftDetector := &run.DriftDetector{
+		KubeClient:  kubeClient,
+		ListFactory: listFactory,
+		GitUtil:     gitUtil,
+		FileSystem:  fileSystem,
+		Clock:       clock,
+		TTL:         driftReportTTL,
+	}
+	var rbacChecker *run.RBACChecker
+	if rbacCheckInterval > 0 {
+		rbacChecker = &run.RBACChecker{
+			KubeClient:  kubeClient,
+			ListFactory: listFactory,
+			GitUtil:     gitUtil,
+			FileSystem:  fileSystem,
+			Clock:       clock,
+			Interval:    rbacCheckInterval,
+		}
+	}
+	webserver := &webserver.WebServer{
+		ListenPort:           listenPort,
+		ListenAddress:        listenAddress,
+		Clock:                clock,
+		MetricsHandler:       metrics.GetHandler(),
+		FullRunQueue:         fullRunQueue,
+		RunCount:             runCount,
+		RunResults:           runResults,
+		Errors:               errors,
+		ReadOnly:             readOnly,
+		CircuitBreaker:       circuitBreaker,
+		AuthorPolicy:         authorPolicy,
+		ApplyWindow:          applyWindow,
+		GitUtil:              gitUtil,
+		RepoStatus:           repoStatus,
+		RunQueue:             runQueue,
+		DriftDetector:        driftDetector,
+		RBACChecker:          rbacChecker,
+		Version:              version,
+		ConfigHash:           sysutil.ConfigHash(),
+		Config:               sysutil.EffectiveConfig(),
+		Webhook:              webhook,
+		TemplatePath:         templatePath,
+		Authenticator:        authenticator,
+		AllowAnonymousReads:  authAllowAnonymousReads,
+		ForceRunAllowedUsers: forceRunAllowedUsers,
+		TLSCertPath:          tlsCertPath,
+		TLSKeyPath:           tlsKeyPath,
+		ClientCAPath:         tlsClientCAPath,
+		Location:             statusLocation,
+	}
 
 	go metrics.StartMetricsLoop()
 	go scheduler.Start()
@@ -119,9 +504,37 @@ func main() {
 	go runner.StartQuickLoop()
 	go runner.StartFullLoop()
 	go webserver.Start()
+	if rbacChecker != nil {
+		go rbacChecker.Start()
+	}
 
 	for err := range errors {
 		log.Fatal(err)
 	}
 
 }
+
+// loadConfigFile loads the config file given by the --config flag, which must come before any subcommand, or else by the
+// CONFIG_PATH environment variable, and returns the remaining arguments.
+func loadConfigFile(args []string) ([]string, error) {
+	path := os.Getenv("CONFIG_PATH")
+	if len(args) > 1 && (args[0] == "--config" || args[0] == "-config") {
+		path, args = args[1], args[2:]
+	} else if len(args) > 0 && (strings.HasPrefix(args[0], "--config=") || strings.HasPrefix(args[0], "-config=")) {
+		path, args = args[0][strings.Index(args[0], "=")+1:], args[1:]
+	}
+	if path == "" {
+		return args, nil
+	}
+	return args, sysutil.LoadConfigFile(path)
+}
+
+// newGuardrails returns the Guardrails configured by the GUARDRAIL_ environment variables, so that the service and the render
+// subcommand reject the same files. The caller must set its FileSystem.
+func newGuardrails() *run.Guardrails {
+	return &run.Guardrails{
+		MaxResources:      sysutil.GetEnvIntOrDefault("GUARDRAIL_MAX_RESOURCES", 0),
+		ForbiddenKinds:    sysutil.GetEnvStringSliceOrDefault("GUARDRAIL_FORBIDDEN_KINDS", []string{}),
+		AllowedNamespaces: sysutil.GetEnvStringSliceOrDefault("GUARDRAIL_ALLOWED_NAMESPACES", []string{}),
+	}
+}
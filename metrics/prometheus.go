@@ -6,15 +6,68 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"net/http"
 	"strconv"
+	"sync"
+	"time"
 )
 
 // Prometheus implements instrumentation of metrics for kube-applier.
 // fileApplyCount is a Counter vector to increment the number of successful and failed apply attempts for each file in the repo.
 // runLatency is a Summary vector that keeps track of the duration for apply runs.
+// rolloutCheckCount is a Counter vector to increment the number of successful and failed post-apply rollout checks for each file.
+// resourceApplyCount is a Counter vector to increment the number of resources kubectl reported as created, configured or unchanged for each kind.
+// kindDriftRatio is a Gauge vector with the share of existing resources of each kind that had drifted from git in the most recent run.
+// hookRunCount is a Counter vector to increment the number of successful and failed runs of each hook.
+// gitCommandDuration is a Summary vector that keeps track of the duration of successful and failed git commands for each subcommand.
+// managedResources is a Gauge vector with the number of resources of each kind in each namespace applied by the most recent successful full run.
+// applyRetryCount is a Counter vector to increment the number of failed apply attempts that were retried for each file.
+// suspendedRunCount is a Counter to increment the number of full runs skipped by the circuit breaker.
+// deletedFiles is a Gauge with the number of files deleted from the repo within the tombstone TTL, as of the most recent run.
+// lastSuccessfulRun is a Gauge with the finish time of the most recent successful run.
+// secondsSinceLastSuccessfulRun is computed on scrape from the same finish time, or from the start of the process if no run has succeeded yet,
+// so that alert rules need neither the current time nor special handling for a missing metric.
+// fileSuccessRate and fileFlapping are Gauge vectors with the success rate and flapping state of each file over the retained run history.
+// The SLO gauges (files_failing_too_long, files_applied_within_interval_ratio and oldest_unapplied_commit_age_seconds) are computed on
+// scrape from the state of each file and, if RepoStatus is set, from the HEAD commit seen by the scheduler, so that alert rules do not
+// have to derive them from the per-file series.
 type Prometheus struct {
-	RunMetrics     <-chan run.Result
-	fileApplyCount *prometheus.CounterVec
-	runLatency     *prometheus.SummaryVec
+	RunMetrics <-chan run.Result
+	// RepoStatus is read for the HEAD commit of the repo.
+	RepoStatus *run.RepoStatus
+	// FailureThreshold is the time after which a file that keeps failing counts towards files_failing_too_long.
+	FailureThreshold time.Duration
+	// ApplyInterval is the time within which every file is expected to have been applied successfully.
+	ApplyInterval      time.Duration
+	fileApplyCount     *prometheus.CounterVec
+	runLatency         *prometheus.SummaryVec
+	rolloutCheckCount  *prometheus.CounterVec
+	resourceApplyCount *prometheus.CounterVec
+	kindDriftRatio     *prometheus.GaugeVec
+	fileSuccessRate    *prometheus.GaugeVec
+	fileFlapping       *prometheus.GaugeVec
+	hookRunCount       *prometheus.CounterVec
+	gitCommandDuration *prometheus.SummaryVec
+	applyRetryCount    *prometheus.CounterVec
+	managedResources   *prometheus.GaugeVec
+	suspendedRunCount  prometheus.Counter
+	deletedFiles       prometheus.Gauge
+	lastSuccessfulRun  prometheus.Gauge
+	// Finish time of the most recent successful run, so that results received out of order do not move lastSuccessfulRun back
+	lastSuccessfulFinish time.Time
+	// Commit of the most recent successful run
+	appliedCommit string
+	// Time at which the oldest commit that has not been applied yet was first seen, or zero if it has not been computed since
+	// the last successful run
+	unappliedSince time.Time
+	// Finish time of the first failure of each file that has been failing since, and of the last success of each known file
+	// (zero if it has never succeeded)
+	failingSince map[string]time.Time
+	lastApplied  map[string]time.Time
+	// Guards lastSuccessfulFinish and the state above, which are read on scrape
+	mu sync.Mutex
+	// Time at which the metrics were configured, used until a run succeeds
+	started time.Time
+	// Returns the current time, overridden in tests
+	now func() time.Time
 }
 
 // GetHandler returns a handler for exposing Prometheus metrics via HTTP.
@@ -47,8 +100,236 @@ func (p *Prometheus) Configure() {
 		},
 	)
 
+	p.rolloutCheckCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "rollout_check_count",
+		Help: "Success metric for every post-apply rollout status check",
+	},
+		[]string{
+			// Path of the file whose workloads were checked
+			"file",
+			// Result: true if the rollout completed, false otherwise
+			"success",
+		},
+	)
+
+	p.resourceApplyCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "resource_apply_count",
+		Help: "Number of resources kubectl apply reported as created, configured or unchanged",
+	},
+		[]string{
+			// Resource type as printed by kubectl, e.g. deployment.apps
+			"kind",
+			// created, configured or unchanged
+			"action",
+		},
+	)
+	p.kindDriftRatio = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kind_drift_ratio",
+		Help: "Ratio of existing resources that were configured (rather than unchanged) in the most recent run that applied the kind in the namespace",
+	},
+		[]string{
+			// Namespace set on the resources in their manifests, empty for resources without one
+			"namespace",
+			// Resource type as printed by kubectl, e.g. deployment.apps
+			"kind",
+		},
+	)
+
+	p.fileSuccessRate = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "file_success_rate",
+		Help: "Ratio of successful apply attempts for each file over the retained run history",
+	},
+		[]string{
+			// Path of the file that was applied
+			"file",
+		},
+	)
+	p.fileFlapping = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "file_flapping",
+		Help: "1 if the file has been alternating between success and failure over the retained run history, 0 otherwise",
+	},
+		[]string{
+			// Path of the file that was applied
+			"file",
+		},
+	)
+
+	p.hookRunCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "hook_run_count",
+		Help: "Success metric for every run of a hook",
+	},
+		[]string{
+			// Hook that was run: preApply or postApply
+			"hook",
+			// Result: true if the hook exited successfully, false otherwise
+			"success",
+		},
+	)
+	p.gitCommandDuration = prometheus.NewSummaryVec(prometheus.SummaryOpts{
+		Name: "git_command_duration_seconds",
+		Help: "Duration of git commands run on the repo",
+	},
+		[]string{
+			// Git subcommand, e.g. rev-parse or diff
+			"command",
+			// Result: true if the command exited successfully, false otherwise
+			"success",
+		},
+	)
+	p.applyRetryCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "apply_retry_count",
+		Help: "Number of failed apply attempts that were retried because of a transient error",
+	},
+		[]string{
+			// Path of the file that was applied
+			"file",
+		},
+	)
+	p.managedResources = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "managed_resources",
+		Help: "Number of resources of each kind in each namespace applied by the most recent successful full run",
+	},
+		[]string{
+			// Namespace set on the resources, empty for resources without one
+			"namespace",
+			// Kind of the resources as in the manifests, e.g. Deployment
+			"kind",
+		},
+	)
+	p.suspendedRunCount = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "suspended_run_count",
+		Help: "Number of full runs skipped because runs were suspended after too many consecutive failures",
+	})
+	p.deletedFiles = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "deleted_files",
+		Help: "Number of files deleted from the repo within the tombstone TTL, whose objects may be left in the cluster",
+	})
+	p.lastSuccessfulRun = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "last_successful_run_timestamp_seconds",
+		Help: "Unix time at which the most recent successful run finished",
+	})
+	if p.now == nil {
+		p.now = time.Now
+	}
+	p.started = p.now()
+	secondsSinceLastSuccessfulRun := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "seconds_since_last_successful_run",
+		Help: "Seconds since the most recent successful run finished, or since kube-applier started if no run has succeeded yet",
+	}, p.secondsSinceLastSuccessfulRun)
+	filesFailingTooLong := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "files_failing_too_long",
+		Help: "Number of files that have failed every apply attempt for longer than the SLO failure threshold",
+	}, p.filesFailingTooLong)
+	filesAppliedWithinInterval := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "files_applied_within_interval_ratio",
+		Help: "Share of the files in the repo that were applied successfully within the SLO apply interval",
+	}, p.filesAppliedWithinInterval)
+	repoStale := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "repo_stale",
+		Help: "1 if the last poll of the repo failed, so that runs apply a commit that may no longer be HEAD, 0 otherwise",
+	}, p.repoStale)
+	oldestUnappliedCommitAge := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "oldest_unapplied_commit_age_seconds",
+		Help: "Seconds since the oldest commit that has not been applied by a successful run was first seen, or 0 if HEAD has been applied",
+	}, p.oldestUnappliedCommitAge)
+
 	prometheus.MustRegister(p.fileApplyCount)
 	prometheus.MustRegister(p.runLatency)
+	prometheus.MustRegister(p.rolloutCheckCount)
+	prometheus.MustRegister(p.resourceApplyCount)
+	prometheus.MustRegister(p.kindDriftRatio)
+	prometheus.MustRegister(p.fileSuccessRate)
+	prometheus.MustRegister(p.fileFlapping)
+	prometheus.MustRegister(p.hookRunCount)
+	prometheus.MustRegister(p.gitCommandDuration)
+	prometheus.MustRegister(p.applyRetryCount)
+	prometheus.MustRegister(p.managedResources)
+	prometheus.MustRegister(p.suspendedRunCount)
+	prometheus.MustRegister(p.deletedFiles)
+	prometheus.MustRegister(p.lastSuccessfulRun)
+	prometheus.MustRegister(secondsSinceLastSuccessfulRun)
+	prometheus.MustRegister(filesFailingTooLong)
+	prometheus.MustRegister(filesAppliedWithinInterval)
+	prometheus.MustRegister(oldestUnappliedCommitAge)
+	prometheus.MustRegister(repoStale)
+}
+
+// secondsSinceLastSuccessfulRun returns the value of seconds_since_last_successful_run at the time of the scrape.
+func (p *Prometheus) secondsSinceLastSuccessfulRun() float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.lastSuccessfulFinish.IsZero() {
+		return p.now().Sub(p.started).Seconds()
+	}
+	return p.now().Sub(p.lastSuccessfulFinish).Seconds()
+}
+
+// filesFailingTooLong returns the value of files_failing_too_long at the time of the scrape.
+func (p *Prometheus) filesFailingTooLong() float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	count := 0
+	for _, since := range p.failingSince {
+		if p.now().Sub(since) >= p.FailureThreshold {
+			count++
+		}
+	}
+	return float64(count)
+}
+
+// filesAppliedWithinInterval returns the value of files_applied_within_interval_ratio at the time of the scrape.
+// It is 1 until a file has been applied, so that it does not alert at startup.
+func (p *Prometheus) filesAppliedWithinInterval() float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.lastApplied) == 0 {
+		return 1
+	}
+	count := 0
+	for _, applied := range p.lastApplied {
+		if !applied.IsZero() && p.now().Sub(applied) <= p.ApplyInterval {
+			count++
+		}
+	}
+	return float64(count) / float64(len(p.lastApplied))
+}
+
+// oldestUnappliedCommitAge returns the value of oldest_unapplied_commit_age_seconds at the time of the scrape.
+// The scheduler only records the HEAD commit, so the oldest commit that has not been applied is the first HEAD seen on a scrape
+// since the last successful run that differs from the applied commit, and commits seen and replaced between two scrapes are missed.
+func (p *Prometheus) oldestUnappliedCommitAge() float64 {
+	if p.RepoStatus == nil {
+		return 0
+	}
+	state := p.RepoStatus.State()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if state.Commit == "" || state.Commit == p.appliedCommit {
+		p.unappliedSince = time.Time{}
+		return 0
+	}
+	if p.unappliedSince.IsZero() {
+		p.unappliedSince = state.CommitSeen
+	}
+	return p.now().Sub(p.unappliedSince).Seconds()
+}
+
+// repoStale returns the value of repo_stale at the time of the scrape.
+func (p *Prometheus) repoStale() float64 {
+	if p.RepoStatus == nil || p.RepoStatus.State().StaleSince == nil {
+		return 0
+	}
+	return 1
+}
+
+// ObserveGitCommand updates git_command_duration_seconds with a git command that was run, for use as git.GitUtil.ObserveCommand.
+func (p *Prometheus) ObserveGitCommand(command string, duration time.Duration, err error) {
+	p.gitCommandDuration.With(prometheus.Labels{"command": command, "success": strconv.FormatBool(err == nil)}).Observe(duration.Seconds())
+}
+
+// ObserveApplyRetry updates apply_retry_count with a failed apply attempt that is retried, for use as kube.Client.ObserveRetry.
+func (p *Prometheus) ObserveApplyRetry(path string, attempt int, err error) {
+	p.applyRetryCount.With(prometheus.Labels{"file": path}).Inc()
 }
 
 // StartMetricsLoop receives from the RunMetrics channel and calls processResult when a run result comes in.
@@ -58,8 +339,14 @@ func (p *Prometheus) StartMetricsLoop() {
 	}
 }
 
-// processResult parses a run result for info and updates the metrics (file_apply_count and run_latency_seconds).
+// processResult parses a run result for info and updates the metrics (file_apply_count, run_latency_seconds, rollout_check_count,
+// resource_apply_count, kind_drift_ratio, file_success_rate, file_flapping, hook_run_count, suspended_run_count and
+// last_successful_run_timestamp_seconds).
+// Dry runs did not change anything, so they are not counted.
 func (p *Prometheus) processResult(result run.Result) {
+	if result.DryRun {
+		return
+	}
 	runSuccess := len(result.Failures) == 0
 	runType := result.RunType
 	latency := result.Finish.Sub(result.Start).Seconds()
@@ -73,4 +360,103 @@ func (p *Prometheus) processResult(result run.Result) {
 		"success":  strconv.FormatBool(runSuccess),
 		"run_type": string(runType),
 	}).Observe(latency)
+	for _, check := range result.RolloutChecks {
+		p.rolloutCheckCount.With(prometheus.Labels{"file": check.FilePath, "success": strconv.FormatBool(check.ErrorMessage == "")}).Inc()
+	}
+	for hook, attempt := range map[string]*run.ApplyAttempt{"preApply": result.PreApplyHook, "postApply": result.PostApplyHook} {
+		if attempt != nil {
+			p.hookRunCount.With(prometheus.Labels{"hook": hook, "success": strconv.FormatBool(attempt.ErrorMessage == "")}).Inc()
+		}
+	}
+	if result.Suspended {
+		p.suspendedRunCount.Inc()
+	}
+	if result.Tombstones != nil {
+		p.deletedFiles.Set(float64(len(result.Tombstones)))
+	}
+	p.mu.Lock()
+	if result.Succeeded() && result.Finish.After(p.lastSuccessfulFinish) {
+		p.lastSuccessfulFinish = result.Finish
+		p.lastSuccessfulRun.Set(float64(result.Finish.Unix()))
+		p.appliedCommit = result.CommitHash
+		p.unappliedSince = time.Time{}
+		// Only a full run that applied every file has the complete set, and resources that were removed must disappear.
+		if result.RunType == run.FullRun && result.ManagedResources != nil {
+			p.managedResources.Reset()
+			for _, c := range result.ManagedResources {
+				p.managedResources.With(prometheus.Labels{"namespace": c.Namespace, "kind": c.Kind}).Set(float64(c.Count))
+			}
+		}
+	}
+	p.recordFiles(result)
+	p.mu.Unlock()
+	for _, h := range result.FileHistory {
+		flapping := 0.0
+		if h.Flapping {
+			flapping = 1
+		}
+		p.fileSuccessRate.With(prometheus.Labels{"file": h.FilePath}).Set(h.SuccessRate)
+		p.fileFlapping.With(prometheus.Labels{"file": h.FilePath}).Set(flapping)
+	}
+	p.processResourceResults(result.ResourceActions)
+}
+
+// recordFiles updates the state of each file from which files_failing_too_long and files_applied_within_interval_ratio are computed.
+// A full run that applied files attempts every file in the repo, so files that it did not attempt were removed and are forgotten.
+// It must be called with mu held.
+func (p *Prometheus) recordFiles(result run.Result) {
+	if p.lastApplied == nil {
+		p.failingSince = map[string]time.Time{}
+		p.lastApplied = map[string]time.Time{}
+	}
+	attempted := map[string]struct{}{}
+	for _, a := range result.Successes {
+		attempted[a.FilePath] = struct{}{}
+		delete(p.failingSince, a.FilePath)
+		if result.Finish.After(p.lastApplied[a.FilePath]) {
+			p.lastApplied[a.FilePath] = result.Finish
+		}
+	}
+	for _, a := range result.Failures {
+		attempted[a.FilePath] = struct{}{}
+		if _, ok := p.failingSince[a.FilePath]; !ok {
+			p.failingSince[a.FilePath] = result.Finish
+		}
+		if _, ok := p.lastApplied[a.FilePath]; !ok {
+			p.lastApplied[a.FilePath] = time.Time{}
+		}
+	}
+	if result.RunType != run.FullRun || len(result.Successes) == 0 {
+		return
+	}
+	for path := range p.lastApplied {
+		if _, ok := attempted[path]; !ok {
+			delete(p.lastApplied, path)
+			delete(p.failingSince, path)
+		}
+	}
+}
+
+// processResourceResults updates resource_apply_count and kind_drift_ratio from the resources counted by the runner, which
+// counts them before the apply outputs are truncated.
+// Resources that were created are not counted towards the drift ratio, since they did not exist before.
+// Resources that were replaced count as drifted, since they were changed.
+func (p *Prometheus) processResourceResults(actions []run.ResourceActionCount) {
+	type namespacedKind struct{ namespace, kind string }
+	configured := make(map[namespacedKind]int)
+	existing := make(map[namespacedKind]int)
+	for _, a := range actions {
+		p.resourceApplyCount.With(prometheus.Labels{"kind": a.Kind, "action": a.Action}).Add(float64(a.Count))
+		k := namespacedKind{a.Namespace, a.Kind}
+		switch a.Action {
+		case run.ActionConfigured, run.ActionReplaced:
+			configured[k] += a.Count
+			existing[k] += a.Count
+		case run.ActionUnchanged:
+			existing[k] += a.Count
+		}
+	}
+	for k, total := range existing {
+		p.kindDriftRatio.With(prometheus.Labels{"namespace": k.namespace, "kind": k.kind}).Set(float64(configured[k]) / float64(total))
+	}
 }
@@ -8,6 +8,7 @@ import (
 	"net/http/httptest"
 	"regexp"
 	"testing"
+	"time"
 )
 
 type testCase struct {
@@ -24,8 +25,19 @@ type testCase struct {
 // Note that filenames are reused in order to ensure that the metrics update iteratively.
 func TestPrometheusProcessResult(t *testing.T) {
 	runMetrics := make(chan run.Result, 5)
-	p := &Prometheus{RunMetrics: runMetrics}
+	now := time.Unix(50, 0)
+	p := &Prometheus{RunMetrics: runMetrics, now: func() time.Time { return now }}
 	p.Configure()
+	now = time.Unix(1000, 0)
+
+	// Before any run has succeeded, the time since the last successful run counts from startup
+	assertMetricsMatch(t, p, []string{"\\bseconds_since_last_successful_run 950\\b"})
+	assertMetricsMatch(t, p, []string{
+		"\\bfiles_failing_too_long 0\\b",
+		"\\bfiles_applied_within_interval_ratio 1\\b",
+		"\\boldest_unapplied_commit_age_seconds 0\\b",
+		"\\brepo_stale 0\\b",
+	})
 
 	testCases := []testCase{
 		// Case 1: No successes, no failures, full run
@@ -103,6 +115,174 @@ func TestPrometheusProcessResult(t *testing.T) {
 	for _, tc := range testCases {
 		processAndCheckOutput(t, p, tc)
 	}
+
+	// Rollout checks are counted per file and result
+	p.processResult(run.Result{
+		RunType: run.QuickRun,
+		RolloutChecks: []run.ApplyAttempt{
+			{FilePath: "file1"},
+			{FilePath: "file2", ErrorMessage: "timed out"},
+		},
+	})
+	assertMetricsMatch(t, p, []string{
+		makeRolloutPattern("file1", true, 1),
+		makeRolloutPattern("file2", false, 1),
+	})
+
+	// Resource actions are counted per kind, and the drift ratio per namespace reflects the most recent run
+	p.processResult(run.Result{
+		RunType: run.FullRun,
+		ResourceActions: []run.ResourceActionCount{
+			{Namespace: "team-a", Kind: "deployment.apps", Action: run.ActionConfigured, Count: 2},
+			{Namespace: "team-a", Kind: "deployment.apps", Action: run.ActionUnchanged, Count: 1},
+			{Namespace: "team-a", Kind: "service", Action: run.ActionCreated, Count: 1},
+			{Namespace: "team-b", Kind: "deployment.apps", Action: run.ActionUnchanged, Count: 1},
+		},
+	})
+	p.processResult(run.Result{
+		RunType:         run.FullRun,
+		ResourceActions: []run.ResourceActionCount{{Namespace: "team-a", Kind: "configmap", Action: run.ActionUnchanged, Count: 1}},
+	})
+	assertMetricsMatch(t, p, []string{
+		makeResourcePattern("deployment.apps", run.ActionConfigured, 2),
+		makeResourcePattern("deployment.apps", run.ActionUnchanged, 2),
+		makeResourcePattern("service", run.ActionCreated, 1),
+		makeResourcePattern("configmap", run.ActionUnchanged, 1),
+		makeDriftPattern("team-a", "deployment.apps", "0.6666666666666666"),
+		makeDriftPattern("team-b", "deployment.apps", "0"),
+		makeDriftPattern("team-a", "configmap", "0"),
+	})
+
+	// Run history is exported per file
+	p.processResult(run.Result{
+		RunType: run.QuickRun,
+		FileHistory: []run.FileHistory{
+			{FilePath: "file1", SuccessRate: 0.5, Flapping: true},
+			{FilePath: "file2", SuccessRate: 1, Flapping: false},
+		},
+	})
+	assertMetricsMatch(t, p, []string{
+		makeGaugePattern("file_success_rate", "file1", "0.5"),
+		makeGaugePattern("file_flapping", "file1", "1"),
+		makeGaugePattern("file_success_rate", "file2", "1"),
+		makeGaugePattern("file_flapping", "file2", "0"),
+	})
+
+	// Only successful runs update the last successful run, and never move it back
+	p.processResult(run.Result{RunType: run.FullRun, Finish: time.Unix(200, 0)})
+	p.processResult(run.Result{RunType: run.QuickRun, Finish: time.Unix(100, 0)})
+	p.processResult(run.Result{RunType: run.FullRun, Finish: time.Unix(300, 0), Failures: []run.ApplyAttempt{{FilePath: "file1"}}})
+	p.processResult(run.Result{RunType: run.FullRun, Finish: time.Unix(400, 0), ReadOnly: true})
+	assertMetricsMatch(t, p, []string{
+		"\\blast_successful_run_timestamp_seconds 200\\b",
+		"\\bseconds_since_last_successful_run 800\\b",
+	})
+
+	// Hook runs are counted per hook and result
+	p.processResult(run.Result{RunType: run.FullRun, PreApplyHook: &run.ApplyAttempt{FilePath: "hook"}})
+	p.processResult(run.Result{RunType: run.FullRun, PreApplyHook: &run.ApplyAttempt{FilePath: "hook"}})
+	p.processResult(run.Result{RunType: run.FullRun, PreApplyHook: &run.ApplyAttempt{FilePath: "hook", ErrorMessage: "error"}})
+	p.processResult(run.Result{RunType: run.FullRun, PreApplyHook: &run.ApplyAttempt{FilePath: "hook"}, PostApplyHook: &run.ApplyAttempt{FilePath: "verify", ErrorMessage: "error"}})
+	assertMetricsMatch(t, p, []string{
+		makeHookPattern("preApply", true, 3),
+		makeHookPattern("preApply", false, 1),
+		makeHookPattern("postApply", false, 1),
+	})
+
+	// Runs skipped by the circuit breaker are counted, but are not successful
+	p.processResult(run.Result{RunType: run.FullRun, Finish: time.Unix(500, 0), Suspended: true})
+	p.processResult(run.Result{RunType: run.FullRun, Finish: time.Unix(600, 0), Suspended: true})
+	assertMetricsMatch(t, p, []string{
+		"\\bsuspended_run_count 2\\b",
+		"\\blast_successful_run_timestamp_seconds 200\\b",
+		"\\bseconds_since_last_successful_run 800\\b",
+	})
+
+	// Dry runs are not counted
+	p.processResult(run.Result{RunType: run.FullRun, PreApplyHook: &run.ApplyAttempt{FilePath: "hook"}, DryRun: true})
+	assertMetricsMatch(t, p, []string{
+		makeHookPattern("preApply", true, 3),
+	})
+
+	// Git commands are timed per subcommand and result
+	p.ObserveGitCommand("rev-parse", 2*time.Second, nil)
+	p.ObserveGitCommand("rev-parse", 3*time.Second, nil)
+	p.ObserveGitCommand("diff", time.Second, fmt.Errorf("exit status 128"))
+	assertMetricsMatch(t, p, []string{
+		makeGitCommandPattern("rev-parse", true, "count", 2),
+		makeGitCommandPattern("rev-parse", true, "sum", 5),
+		makeGitCommandPattern("diff", false, "count", 1),
+	})
+
+	// Managed resources are replaced by every successful full run, in order of finish time
+	p.processResult(run.Result{RunType: run.FullRun, Finish: time.Unix(700, 0), ManagedResources: []run.ResourceCount{{Namespace: "team-a", Kind: "Deployment", Count: 2}, {Namespace: "team-b", Kind: "Service", Count: 1}}})
+	p.processResult(run.Result{RunType: run.FullRun, Finish: time.Unix(800, 0), ManagedResources: []run.ResourceCount{{Namespace: "team-a", Kind: "Deployment", Count: 3}, {Namespace: "", Kind: "Namespace", Count: 2}}})
+	p.processResult(run.Result{RunType: run.FullRun, Finish: time.Unix(750, 0), ManagedResources: []run.ResourceCount{{Namespace: "team-a", Kind: "Deployment", Count: 4}}})
+	p.processResult(run.Result{RunType: run.FullRun, Finish: time.Unix(900, 0), Failures: []run.ApplyAttempt{{FilePath: "file1"}}, ManagedResources: []run.ResourceCount{{Namespace: "team-a", Kind: "Deployment", Count: 1}}})
+	assertMetricsMatch(t, p, []string{
+		"\\bmanaged_resources\\{kind\\=\"Deployment\",namespace\\=\"team-a\"\\} 3\\b",
+		"\\bmanaged_resources\\{kind\\=\"Namespace\",namespace\\=\"\"\\} 2\\b",
+	})
+	assert.NotContains(t, requestContentBody(p.GetHandler()), "managed_resources{kind=\"Service\",namespace=\"team-b\"}")
+
+	// Retried apply attempts are counted per file
+	p.ObserveApplyRetry("file1", 1, fmt.Errorf("exit status 1"))
+	p.ObserveApplyRetry("file1", 2, fmt.Errorf("exit status 1"))
+	assertMetricsMatch(t, p, []string{
+		"\\bapply_retry_count\\{file\\=\"file1\"\\} 2\\b",
+	})
+
+	// Deleted files are set by runs that recorded tombstones, and kept by runs that did not
+	p.processResult(run.Result{RunType: run.FullRun, Finish: time.Unix(1000, 0), Tombstones: []run.Tombstone{{FilePath: "file2"}, {FilePath: "file3"}}})
+	p.processResult(run.Result{RunType: run.FullRun, Finish: time.Unix(1100, 0), Suspended: true})
+	assertMetricsMatch(t, p, []string{
+		"\\bdeleted_files 2\\b",
+	})
+}
+
+func TestPrometheusSLOGauges(t *testing.T) {
+	assert := assert.New(t)
+	now := time.Unix(0, 0)
+	repoStatus := &run.RepoStatus{}
+	p := &Prometheus{RepoStatus: repoStatus, FailureThreshold: 100 * time.Second, ApplyInterval: 200 * time.Second, now: func() time.Time { return now }}
+
+	// file2 fails from the first run on, file3 was never applied
+	p.recordFiles(run.Result{RunType: run.FullRun, Finish: time.Unix(100, 0), Successes: []run.ApplyAttempt{{FilePath: "file1"}, {FilePath: "file2"}}})
+	p.recordFiles(run.Result{RunType: run.FullRun, Finish: time.Unix(200, 0), Successes: []run.ApplyAttempt{{FilePath: "file1"}}, Failures: []run.ApplyAttempt{{FilePath: "file2"}, {FilePath: "file3"}}})
+	p.recordFiles(run.Result{RunType: run.QuickRun, Finish: time.Unix(250, 0), Failures: []run.ApplyAttempt{{FilePath: "file2"}}})
+	now = time.Unix(250, 0)
+	assert.Equal(0.0, p.filesFailingTooLong())
+	assert.Equal(2.0/3.0, p.filesAppliedWithinInterval())
+	now = time.Unix(301, 0)
+	assert.Equal(2.0, p.filesFailingTooLong())
+	assert.Equal(1.0/3.0, p.filesAppliedWithinInterval())
+
+	// A full run that applied files forgets the files it did not attempt, and a success ends a failure
+	p.recordFiles(run.Result{RunType: run.FullRun, Finish: time.Unix(300, 0), Successes: []run.ApplyAttempt{{FilePath: "file1"}, {FilePath: "file2"}}})
+	assert.Equal(0.0, p.filesFailingTooLong())
+	assert.Equal(1.0, p.filesAppliedWithinInterval())
+	assert.Len(p.lastApplied, 2)
+
+	// The age of the oldest unapplied commit counts from when it was first seen, until a run applies HEAD
+	assert.Equal(0.0, p.oldestUnappliedCommitAge())
+	p.appliedCommit = "hash0"
+	repoStatus.Record("hash0", time.Unix(300, 0), nil)
+	assert.Equal(0.0, p.oldestUnappliedCommitAge())
+	repoStatus.Record("hash1", time.Unix(310, 0), nil)
+	now = time.Unix(320, 0)
+	assert.Equal(10.0, p.oldestUnappliedCommitAge())
+	repoStatus.Record("hash2", time.Unix(330, 0), nil)
+	now = time.Unix(340, 0)
+	assert.Equal(30.0, p.oldestUnappliedCommitAge())
+	p.appliedCommit, p.unappliedSince = "hash2", time.Time{}
+	assert.Equal(0.0, p.oldestUnappliedCommitAge())
+
+	// The repo is stale while polls fail
+	assert.Equal(0.0, p.repoStale())
+	repoStatus.Record("", time.Unix(350, 0), fmt.Errorf("git error"))
+	assert.Equal(1.0, p.repoStale())
+	repoStatus.Record("hash2", time.Unix(360, 0), nil)
+	assert.Equal(0.0, p.repoStale())
 }
 
 // Request content body from the handler.
@@ -127,13 +307,62 @@ func makeLatencyPattern(runType run.RunType, success bool, count int) string {
 		runType, success, count)
 }
 
+// Build a regex pattern for rollout_check_count metric.
+func makeRolloutPattern(filename string, success bool, count int) string {
+	return fmt.Sprintf(
+		"\\brollout_check_count\\{file\\=\"%v\",success\\=\"%v\"\\} %v\\b",
+		filename, success, count)
+}
+
+// Build a regex pattern for resource_apply_count metric.
+func makeResourcePattern(kind, action string, count int) string {
+	return fmt.Sprintf(
+		"\\bresource_apply_count\\{action\\=\"%v\",kind\\=\"%v\"\\} %v\\b",
+		action, kind, count)
+}
+
+// Build a regex pattern for kind_drift_ratio metric.
+func makeDriftPattern(namespace, kind, ratio string) string {
+	return fmt.Sprintf(
+		"\\bkind_drift_ratio\\{kind\\=\"%v\",namespace\\=\"%v\"\\} %v\\b",
+		kind, namespace, regexp.QuoteMeta(ratio))
+}
+
+// Build a regex pattern for hook_run_count metric.
+func makeHookPattern(hook string, success bool, count int) string {
+	return fmt.Sprintf(
+		"\\bhook_run_count\\{hook\\=\"%v\",success\\=\"%v\"\\} %v\\b",
+		hook, success, count)
+}
+
+// Build a regex pattern for the count or sum of the git_command_duration_seconds metric.
+func makeGitCommandPattern(command string, success bool, suffix string, value int) string {
+	return fmt.Sprintf(
+		"\\bgit_command_duration_seconds_%v\\{command\\=\"%v\",success\\=\"%v\"\\} %v\\b",
+		suffix, command, success, value)
+}
+
+// Build a regex pattern for a gauge metric labelled by file.
+func makeGaugePattern(name, filename, value string) string {
+	return fmt.Sprintf(
+		"\\b%v\\{file\\=\"%v\"\\} %v\\b",
+		name, filename, regexp.QuoteMeta(value))
+}
+
 // Process the test case and check that the metrics output contains the expected patterns.
 func processAndCheckOutput(t *testing.T, p *Prometheus, tc testCase) {
-	assert := assert.New(t)
 	result := run.Result{Successes: tc.successes, Failures: tc.failures, RunType: tc.runType}
 	p.processResult(result)
+	assertMetricsMatch(t, p, tc.expectedPatterns)
+}
+
+// Check that the metrics output contains the expected patterns.
+func assertMetricsMatch(t *testing.T, p *Prometheus, expectedPatterns []string) {
+	assert := assert.New(t)
 	metricsRaw := requestContentBody(p.GetHandler())
-	for _, pattern := range tc.expectedPatterns {
-		assert.True(regexp.MatchString(pattern, metricsRaw))
+	for _, pattern := range expectedPatterns {
+		matched, err := regexp.MatchString(pattern, metricsRaw)
+		assert.Nil(err)
+		assert.True(matched, pattern)
 	}
 }
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/box/kube-applier/applylist"
+	"github.com/box/kube-applier/git"
+	"github.com/box/kube-applier/kube"
+	"github.com/box/kube-applier/run"
+	"github.com/box/kube-applier/sysutil"
+)
+
+// render runs the "render" subcommand, which prints the files a full run would apply for the given path, in order,
+// together with the kubectl command that would run for each, so that run failures can be debugged without cluster access.
+// Flags default to the environment variables used by the service.
+func render(args []string) {
+	fs := flag.NewFlagSet("render", flag.ExitOnError)
+	path := fs.String("path", sysutil.GetEnvStringOrDefault("REPO_PATH", ""), "Path to the directory to render, must be a Git repository or a path within one")
+	blacklistPath := fs.String("blacklist", sysutil.GetEnvStringOrDefault("BLACKLIST_PATH", ""), "Path to the blacklist file")
+	whitelistPath := fs.String("whitelist", sysutil.GetEnvStringOrDefault("WHITELIST_PATH", ""), "Path to the whitelist file")
+	clusterResourcesPath := fs.String("cluster-resources-path", sysutil.GetEnvStringOrDefault("CLUSTER_RESOURCES_PATH", ""), "Directory relative to path holding cluster-scoped resources")
+	recursive := fs.Bool("recursive", sysutil.GetEnvBoolOrDefault("RECURSIVE", true), "Apply files in subdirectories of path")
+	fs.Parse(args)
+
+	if *path == "" {
+		log.Fatal("Error: --path must be specified")
+	}
+
+	fileSystem := &sysutil.FileSystem{}
+	gitUtil := &git.GitUtil{RepoPath: *path}
+	listFactory := &applylist.Factory{
+		RepoPath:             *path,
+		BlacklistPath:        *blacklistPath,
+		WhitelistPath:        *whitelistPath,
+		FileSystem:           fileSystem,
+		ClusterResourcesPath: *clusterResourcesPath,
+		TopLevelOnly:         !*recursive,
+	}
+	guardrails := newGuardrails()
+	guardrails.FileSystem = fileSystem
+	applyOrderPolicy, err := run.ParseOrderPolicy(sysutil.GetEnvStringOrDefault("APPLY_ORDER", string(run.OrderPath)))
+	if err != nil {
+		log.Fatalf("Invalid APPLY_ORDER: %v", err)
+	}
+	applyOrder := &run.ApplyOrder{
+		Policy:        applyOrderPolicy,
+		CriticalPaths: applylist.PrependToEachPath(*path, sysutil.GetEnvStringSliceOrDefault("APPLY_CRITICAL_PATHS", []string{})),
+	}
+	if *clusterResourcesPath != "" {
+		applyOrder.ClusterResourcesPath = applylist.PrependToEachPath(*path, []string{*clusterResourcesPath})[0]
+	}
+	// Only used to order the files, nothing is applied
+	batchApplier := &run.BatchApplier{
+		FileSystem:      fileSystem,
+		NamespacesFirst: sysutil.GetEnvBoolOrDefault("NAMESPACES_FIRST", false),
+		ApplyPhases:     sysutil.GetEnvBoolOrDefault("APPLY_PHASES", false),
+		ApplyOrder:      applyOrder,
+	}
+	kubeClient := &kube.Client{LogLevel: -1}
+
+	rawList, err := gitUtil.ListAllFiles()
+	if err != nil {
+		log.Fatal(err)
+	}
+	applyList, _, _, err := listFactory.Create(rawList)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Files below a skip marker are left out as a run would leave them out
+	skipMarkers := &run.SkipMarkers{RepoPath: *path, FileSystem: fileSystem}
+	skipped := skipMarkers.Check(0, applyList)
+	skippedFiles := map[string]struct{}{}
+	for _, s := range skipped {
+		skippedFiles[s.FilePath] = struct{}{}
+	}
+	filteredList := []string{}
+	for _, file := range applyList {
+		if _, ok := skippedFiles[file]; !ok {
+			filteredList = append(filteredList, file)
+		}
+	}
+	applyList = filteredList
+
+	ignoredObjects := 0
+	for _, file := range batchApplier.Order(applyList) {
+		contents, ignored, err := readWithoutIgnored(file)
+		if err != nil {
+			log.Fatal(err)
+		}
+		ignoredObjects += ignored
+		if ignored > 0 && contents == "" {
+			fmt.Printf("# %v: all %d objects are annotated %v=true, kubectl would not run\n\n", file, ignored, kube.IgnoreAnnotation)
+			continue
+		}
+		fmt.Printf("# $ %s\n", kubeClient.ApplyCommand(file))
+		if ignored > 0 {
+			fmt.Printf("# Ignored %d objects annotated %v=true\n", ignored, kube.IgnoreAnnotation)
+		}
+		fmt.Printf("---\n%s\n", contents)
+	}
+
+	for _, s := range skipped {
+		fmt.Fprintf(os.Stderr, "%v: %v\n", s.FilePath, s.Output)
+	}
+	violations := guardrails.Check(applyList)
+	for _, v := range violations {
+		fmt.Fprintf(os.Stderr, "%v: %v\n", v.FilePath, v.ErrorMessage)
+	}
+	fmt.Fprintf(os.Stderr, "%v files would be applied, %v would be skipped, %v would be rejected by guardrails, %v objects would be ignored.\n", len(applyList)-len(violations), len(skipped), len(violations), ignoredObjects)
+	if len(violations) > 0 {
+		os.Exit(1)
+	}
+}
+
+// readWithoutIgnored returns the contents of the file located at path as kubectl would receive them, without the objects
+// annotated with kube.IgnoreAnnotation, and the number of objects left out. The contents are empty if every object is left out.
+func readWithoutIgnored(path string) (contents string, ignored int, err error) {
+	filtered, ignored, err := kube.WithoutIgnored(path)
+	if err != nil || filtered == "" {
+		return "", ignored, err
+	}
+	if filtered != path {
+		defer os.Remove(filtered)
+	}
+	content, err := ioutil.ReadFile(filtered)
+	if err != nil {
+		return "", 0, fmt.Errorf("Error reading %v: %v", path, err)
+	}
+	return string(content), ignored, nil
+}
@@ -0,0 +1,191 @@
+package run
+
+import (
+	"fmt"
+	"github.com/box/kube-applier/sysutil"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OrderPolicy determines the order in which the files of a run are applied.
+type OrderPolicy string
+
+const (
+	// OrderPath applies files in the order of their paths, as the apply list is created.
+	OrderPath OrderPolicy = "path"
+	// OrderShortestFirst applies the files that are expected to apply fastest first, and the files that failed their last
+	// apply after all others, since they often fail slowly, e.g. on webhook timeouts, and would hold up the rest of the run.
+	OrderShortestFirst OrderPolicy = "shortest-first"
+	// OrderCriticalFirst applies the files that failed their last apply first, so that a fix is applied as soon as possible,
+	// and the others by their expected apply time.
+	OrderCriticalFirst OrderPolicy = "critical-first"
+)
+
+// ParseOrderPolicy converts the value of $APPLY_ORDER into an OrderPolicy, returning an error for unknown values.
+// An empty string is treated as OrderPath.
+func ParseOrderPolicy(s string) (OrderPolicy, error) {
+	switch OrderPolicy(s) {
+	case "", OrderPath:
+		return OrderPath, nil
+	case OrderShortestFirst, OrderCriticalFirst:
+		return OrderPolicy(s), nil
+	}
+	return "", fmt.Errorf("Invalid apply order %q, must be one of %q, %q or %q", s, OrderPath, OrderShortestFirst, OrderCriticalFirst)
+}
+
+// Backlog is the number of files a run has left to apply, and the time they are expected to take based on their previous applies.
+type Backlog struct {
+	Files            int     `json:"files"`
+	EstimatedSeconds float64 `json:"estimatedSeconds"`
+}
+
+// ApplyOrder orders the files of a run by priority, the outcome of their last apply and how long they took to apply before, so that
+// after a change to a shared base, which changes most files at once, the files that matter most are not held up by the others.
+// Files in the ClusterResourcesPath directory always come first, followed by the files in each of the CriticalPaths directories in
+// turn. Within each of these groups, files are ordered by the Policy, and by path otherwise.
+// It also tracks the files each run has left to apply, to estimate how long the runs in progress and the queued runs will take.
+// It is shared between the quick and full run loops, through the BatchApplier, and the RunQueue.
+type ApplyOrder struct {
+	Policy               OrderPolicy
+	ClusterResourcesPath string
+	CriticalPaths        []string
+	Clock                sysutil.ClockInterface
+	mu                   sync.Mutex
+	// Moving average of the apply time of each file applied since startup, and whether its last apply failed
+	durations map[string]time.Duration
+	failed    map[string]bool
+	// Files left to apply by each run in progress
+	pending map[int][]string
+}
+
+// Sort returns the apply list of the run with the given ID in the order of the Policy, and records it as the run's backlog until
+// Finish is called.
+func (o *ApplyOrder) Sort(id int, applyList []string) []string {
+	sorted := o.Order(applyList)
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.pending[id] = append([]string{}, sorted...)
+	return sorted
+}
+
+// Order returns the apply list in the order of the Policy, without recording a backlog. Files that have not been applied since
+// startup are ordered as if their last apply succeeded instantly.
+func (o *ApplyOrder) Order(applyList []string) []string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.init()
+	sorted := append([]string{}, applyList...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		pi, pj := o.priority(sorted[i]), o.priority(sorted[j])
+		if pi != pj {
+			return pi < pj
+		}
+		if o.Policy == OrderPath {
+			return false
+		}
+		fi, fj := o.failed[sorted[i]], o.failed[sorted[j]]
+		if fi != fj {
+			return fi == (o.Policy == OrderCriticalFirst)
+		}
+		return o.durations[sorted[i]] < o.durations[sorted[j]]
+	})
+	return sorted
+}
+
+// priority returns the group of the file located at p: 0 for cluster resources, i+1 for the i-th critical path and
+// len(CriticalPaths)+1 for all other files.
+func (o *ApplyOrder) priority(p string) int {
+	if o.ClusterResourcesPath != "" && strings.HasPrefix(p, path.Clean(o.ClusterResourcesPath)+"/") {
+		return 0
+	}
+	for i, dir := range o.CriticalPaths {
+		if strings.HasPrefix(p, path.Clean(dir)+"/") {
+			return i + 1
+		}
+	}
+	return len(o.CriticalPaths) + 1
+}
+
+// Start records that the run with the given ID starts applying the file located at p, and returns a function that records the
+// outcome once it has been applied.
+func (o *ApplyOrder) Start(id int, p string) (done func(success bool)) {
+	start := o.Clock.Now()
+	return func(success bool) {
+		duration := o.Clock.Now().Sub(start)
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		o.init()
+		if previous, ok := o.durations[p]; ok {
+			duration = (previous + duration) / 2
+		}
+		o.durations[p] = duration
+		o.failed[p] = !success
+		pending := o.pending[id]
+		for i, file := range pending {
+			if file == p {
+				o.pending[id] = append(pending[:i:i], pending[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// Finish forgets the backlog of the run with the given ID, including any files it did not apply.
+func (o *ApplyOrder) Finish(id int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	delete(o.pending, id)
+}
+
+// Backlog returns the backlog of the run with the given ID, or nil if it is not applying files.
+// Files that have not been applied since startup are expected to take the average apply time of the others.
+func (o *ApplyOrder) Backlog(id int) *Backlog {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	pending, ok := o.pending[id]
+	if !ok {
+		return nil
+	}
+	return o.estimate(pending)
+}
+
+// FullRunBacklog returns the expected backlog of a full run that has not started yet, from the files applied since startup.
+func (o *ApplyOrder) FullRunBacklog() *Backlog {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	files := make([]string, 0, len(o.durations))
+	for file := range o.durations {
+		files = append(files, file)
+	}
+	return o.estimate(files)
+}
+
+// estimate returns the backlog of the given files. o.mu must be held.
+func (o *ApplyOrder) estimate(files []string) *Backlog {
+	var total, average time.Duration
+	for _, d := range o.durations {
+		total += d
+	}
+	if len(o.durations) > 0 {
+		average = total / time.Duration(len(o.durations))
+	}
+	var estimate time.Duration
+	for _, file := range files {
+		if d, ok := o.durations[file]; ok {
+			estimate += d
+		} else {
+			estimate += average
+		}
+	}
+	return &Backlog{Files: len(files), EstimatedSeconds: estimate.Seconds()}
+}
+
+// init creates the maps of the ApplyOrder on first use. o.mu must be held.
+func (o *ApplyOrder) init() {
+	if o.durations == nil {
+		o.durations, o.failed, o.pending = map[string]time.Duration{}, map[string]bool{}, map[int][]string{}
+	}
+}
@@ -0,0 +1,80 @@
+package run
+
+import (
+	"github.com/box/kube-applier/sysutil"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestParseOrderPolicy(t *testing.T) {
+	assert := assert.New(t)
+
+	for s, expected := range map[string]OrderPolicy{"": OrderPath, "path": OrderPath, "shortest-first": OrderShortestFirst, "critical-first": OrderCriticalFirst} {
+		policy, err := ParseOrderPolicy(s)
+		assert.Nil(err)
+		assert.Equal(expected, policy)
+	}
+	_, err := ParseOrderPolicy("longest-first")
+	assert.EqualError(err, "Invalid apply order \"longest-first\", must be one of \"path\", \"shortest-first\" or \"critical-first\"")
+}
+
+func TestApplyOrder(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	clock := sysutil.NewMockClockInterface(mockCtrl)
+	o := &ApplyOrder{Policy: OrderPath, ClusterResourcesPath: "/repo/cluster", CriticalPaths: []string{"/repo/ingress"}, Clock: clock}
+	applyList := []string{"/repo/cluster/ns.yaml", "/repo/a.yaml", "/repo/b.yaml", "/repo/c.yaml", "/repo/ingress/x.yaml"}
+
+	// Nothing is known about the files, so only their priority matters
+	assert.Nil(o.Backlog(0))
+	assert.Equal([]string{"/repo/cluster/ns.yaml", "/repo/ingress/x.yaml", "/repo/a.yaml", "/repo/b.yaml", "/repo/c.yaml"}, o.Sort(0, applyList))
+	assert.Equal(&Backlog{Files: 5, EstimatedSeconds: 0}, o.Backlog(0))
+
+	// a takes 30s and fails, b 10s, c 20s, and their apply times are recorded as they are applied
+	for _, file := range []struct {
+		path     string
+		duration time.Duration
+		success  bool
+	}{
+		{"/repo/cluster/ns.yaml", time.Second, true},
+		{"/repo/ingress/x.yaml", time.Second, true},
+		{"/repo/a.yaml", 30 * time.Second, false},
+		{"/repo/b.yaml", 10 * time.Second, true},
+	} {
+		gomock.InOrder(
+			clock.EXPECT().Now().Times(1).Return(time.Unix(0, 0)),
+			clock.EXPECT().Now().Times(1).Return(time.Unix(0, 0).Add(file.duration)),
+		)
+		o.Start(0, file.path)(file.success)
+	}
+	// c is expected to take the average of the others
+	assert.Equal(&Backlog{Files: 1, EstimatedSeconds: 10.5}, o.Backlog(0))
+	gomock.InOrder(
+		clock.EXPECT().Now().Times(1).Return(time.Unix(0, 0)),
+		clock.EXPECT().Now().Times(1).Return(time.Unix(20, 0)),
+	)
+	o.Start(0, "/repo/c.yaml")(true)
+	assert.Equal(&Backlog{Files: 0, EstimatedSeconds: 0}, o.Backlog(0))
+	o.Finish(0)
+	assert.Nil(o.Backlog(0))
+	assert.Equal(&Backlog{Files: 5, EstimatedSeconds: 62}, o.FullRunBacklog())
+
+	// Files that failed come last when shortest first, and first when critical first
+	o.Policy = OrderShortestFirst
+	assert.Equal([]string{"/repo/cluster/ns.yaml", "/repo/ingress/x.yaml", "/repo/b.yaml", "/repo/c.yaml", "/repo/a.yaml"}, o.Sort(1, applyList))
+	o.Finish(1)
+	o.Policy = OrderCriticalFirst
+	assert.Equal([]string{"/repo/cluster/ns.yaml", "/repo/ingress/x.yaml", "/repo/a.yaml", "/repo/b.yaml", "/repo/c.yaml"}, o.Sort(2, applyList))
+
+	// Apply times are averaged with the previous ones
+	gomock.InOrder(
+		clock.EXPECT().Now().Times(1).Return(time.Unix(0, 0)),
+		clock.EXPECT().Now().Times(1).Return(time.Unix(2, 0)),
+	)
+	o.Start(2, "/repo/c.yaml")(true)
+	assert.Equal(&Backlog{Files: 4, EstimatedSeconds: 42}, o.Backlog(2))
+}
@@ -0,0 +1,87 @@
+package run
+
+import (
+	"github.com/box/kube-applier/kube"
+	"github.com/box/kube-applier/sysutil"
+	"sort"
+	"strings"
+)
+
+// Actions reported by kubectl apply for each resource, and by kubectl replace for files that are replaced.
+const (
+	ActionCreated    = "created"
+	ActionConfigured = "configured"
+	ActionUnchanged  = "unchanged"
+	ActionReplaced   = "replaced"
+)
+
+// ResourceResult stores the action kubectl apply reported for a single resource.
+// Kind is the resource type as printed by kubectl, e.g. "deployment.apps".
+type ResourceResult struct {
+	Kind   string
+	Name   string
+	Action string
+}
+
+// ParseApplyOutput returns a ResourceResult for every resource line in the output of a kubectl apply command.
+// Lines that do not describe a resource (warnings, errors) are ignored.
+func ParseApplyOutput(output string) []ResourceResult {
+	results := []ResourceResult{}
+	for _, line := range strings.Split(output, "\n") {
+		m := kube.ApplyOutputLine.FindStringSubmatch(strings.TrimSpace(line))
+		if m == nil {
+			continue
+		}
+		results = append(results, ResourceResult{m[1], m[2], m[3]})
+	}
+	return results
+}
+
+// ResourceActionCount is the number of resources of a kind in a namespace for which kubectl reported the same action.
+// Namespace is empty for cluster-scoped resources and for resources whose manifest does not set one.
+type ResourceActionCount struct {
+	Namespace string
+	Kind      string
+	Action    string
+	Count     int
+}
+
+// countResourceActions counts the resources reported in the apply output of the attempts by namespace, kind and action, sorted in
+// that order, or nil if no resources were reported. The namespace of each resource is looked up in the manifests of its file by name and kind, if fs is set.
+// It must be called before the outputs are truncated, since the resource lines of large files are in the middle of their output.
+func countResourceActions(fs sysutil.FileSystemInterface, attempts []ApplyAttempt) []ResourceActionCount {
+	counts := map[ResourceActionCount]int{}
+	for _, a := range attempts {
+		results := ParseApplyOutput(a.Output)
+		if len(results) == 0 {
+			continue
+		}
+		namespaces := map[string]string{}
+		if fs != nil {
+			resources, _ := readResources(fs, a.FilePath)
+			for _, r := range resources {
+				namespaces[strings.ToLower(r.Kind)+"/"+r.Metadata.Name] = r.Metadata.Namespace
+			}
+		}
+		for _, r := range results {
+			// kubectl prints the kind with its API group, e.g. deployment.apps
+			kind := strings.SplitN(r.Kind, ".", 2)[0]
+			counts[ResourceActionCount{Namespace: namespaces[kind+"/"+r.Name], Kind: r.Kind, Action: r.Action}]++
+		}
+	}
+	var actions []ResourceActionCount
+	for c, n := range counts {
+		c.Count = n
+		actions = append(actions, c)
+	}
+	sort.Slice(actions, func(i, j int) bool {
+		if actions[i].Namespace != actions[j].Namespace {
+			return actions[i].Namespace < actions[j].Namespace
+		}
+		if actions[i].Kind != actions[j].Kind {
+			return actions[i].Kind < actions[j].Kind
+		}
+		return actions[i].Action < actions[j].Action
+	})
+	return actions
+}
@@ -0,0 +1,113 @@
+package run
+
+import (
+	"fmt"
+	"github.com/box/kube-applier/sysutil"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseApplyOutput(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal([]ResourceResult{}, ParseApplyOutput(""))
+
+	output := `namespace/web unchanged
+deployment.apps/web configured
+service/web created
+job.batch "migrate" deleted
+job.batch/migrate replaced
+Warning: resource configmaps/web is missing the kubectl.kubernetes.io/last-applied-configuration annotation
+configmap/web configured (server dry run)
+Error from server (NotFound): error when creating "web.yaml": namespaces "missing" not found
+`
+	expected := []ResourceResult{
+		{"namespace", "web", ActionUnchanged},
+		{"deployment.apps", "web", ActionConfigured},
+		{"service", "web", ActionCreated},
+		{"job.batch", "migrate", ActionReplaced},
+	}
+	assert.Equal(expected, ParseApplyOutput(output))
+}
+
+func TestCountResourceActions(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+	fs := sysutil.NewMockFileSystemInterface(mockCtrl)
+
+	assert.Nil(countResourceActions(fs, []ApplyAttempt{{FilePath: "file0", Output: "error: something failed"}}))
+
+	fs.EXPECT().ReadFile("file1").Times(1).Return([]byte(`kind: Deployment
+metadata:
+  name: web
+  namespace: team-a
+---
+kind: Service
+metadata:
+  name: web
+  namespace: team-a
+---
+kind: Namespace
+metadata:
+  name: team-a
+`), nil)
+	fs.EXPECT().ReadFile("file2").Times(1).Return(nil, fmt.Errorf("read error"))
+	attempts := []ApplyAttempt{
+		{FilePath: "file1", Output: "namespace/team-a unchanged\ndeployment.apps/web configured\nservice/web unchanged\n"},
+		{FilePath: "file2", Output: "deployment.apps/api configured\n"},
+	}
+	assert.Equal([]ResourceActionCount{
+		{Namespace: "", Kind: "deployment.apps", Action: ActionConfigured, Count: 1},
+		{Namespace: "", Kind: "namespace", Action: ActionUnchanged, Count: 1},
+		{Namespace: "team-a", Kind: "deployment.apps", Action: ActionConfigured, Count: 1},
+		{Namespace: "team-a", Kind: "service", Action: ActionUnchanged, Count: 1},
+	}, countResourceActions(fs, attempts))
+
+	// Without a file system, namespaces are unknown
+	assert.Equal([]ResourceActionCount{
+		{Namespace: "", Kind: "deployment.apps", Action: ActionConfigured, Count: 2},
+		{Namespace: "", Kind: "namespace", Action: ActionUnchanged, Count: 1},
+		{Namespace: "", Kind: "service", Action: ActionUnchanged, Count: 1},
+	}, countResourceActions(nil, attempts))
+}
+
+func TestCountResourceActionsFromFiles(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := writeManifests(t, map[string]string{
+		"web.yaml": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  namespace: team-a
+spec:
+  template:
+    metadata:
+      name: ignored
+      namespace: ignored
+---
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: migrate
+  namespace: team-b
+  annotations:
+    description: |
+      name: web
+      namespace: ignored
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	attempts := []ApplyAttempt{
+		{FilePath: filepath.Join(dir, "web.yaml"), Output: "deployment.apps/web configured\njob.batch/migrate unchanged\n"},
+	}
+	assert.Equal([]ResourceActionCount{
+		{Namespace: "team-a", Kind: "deployment.apps", Action: ActionConfigured, Count: 1},
+		{Namespace: "team-b", Kind: "job.batch", Action: ActionUnchanged, Count: 1},
+	}, countResourceActions(&sysutil.FileSystem{}, attempts))
+}
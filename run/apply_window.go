@@ -0,0 +1,139 @@
+package run
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+var weekdays = map[string]time.Weekday{
+	"Sun": time.Sunday,
+	"Mon": time.Monday,
+	"Tue": time.Tuesday,
+	"Wed": time.Wednesday,
+	"Thu": time.Thursday,
+	"Fri": time.Friday,
+	"Sat": time.Saturday,
+}
+
+// ApplyWindow restricts runs to a recurring time window, e.g. business hours, outside of which runs apply nothing.
+// It is shared between the runner, which checks it before applying, and the webserver, which lets forced runs through if AllowForced is set.
+type ApplyWindow struct {
+	// Days on which the window opens.
+	Days map[time.Weekday]bool
+	// Start and End of the window as offsets from midnight. If End is not after Start, the window closes on the next day.
+	Start time.Duration
+	End   time.Duration
+	// Location in which Days, Start and End are evaluated.
+	Location *time.Location
+	// AllowForced lets forced runs go ahead outside of the window.
+	AllowForced bool
+	mu          sync.Mutex
+	forced      bool
+}
+
+// ParseApplyWindow parses a window in the format "<days> <start>-<end>", e.g. "Mon-Fri 09:00-17:00" or "Sat,Sun 22:00-06:00".
+// Days are a comma-separated list of three-letter weekdays or ranges of weekdays.
+func ParseApplyWindow(spec string, location *time.Location) (*ApplyWindow, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 2 {
+		return nil, fmt.Errorf("Invalid apply window %q, must be in the format \"<days> <start>-<end>\"", spec)
+	}
+	days, err := parseWeekdays(fields[0])
+	if err != nil {
+		return nil, fmt.Errorf("Invalid apply window %q: %v", spec, err)
+	}
+	times := strings.Split(fields[1], "-")
+	if len(times) != 2 {
+		return nil, fmt.Errorf("Invalid apply window %q, times must be in the format \"<start>-<end>\"", spec)
+	}
+	start, err := parseTimeOfDay(times[0])
+	if err != nil {
+		return nil, fmt.Errorf("Invalid apply window %q: %v", spec, err)
+	}
+	end, err := parseTimeOfDay(times[1])
+	if err != nil {
+		return nil, fmt.Errorf("Invalid apply window %q: %v", spec, err)
+	}
+	return &ApplyWindow{Days: days, Start: start, End: end, Location: location}, nil
+}
+
+// parseWeekdays parses a comma-separated list of weekdays and weekday ranges, e.g. "Mon-Wed,Fri".
+func parseWeekdays(s string) (map[time.Weekday]bool, error) {
+	days := make(map[time.Weekday]bool)
+	for _, part := range strings.Split(s, ",") {
+		bounds := strings.Split(part, "-")
+		if len(bounds) > 2 {
+			return nil, fmt.Errorf("invalid days %q", part)
+		}
+		first, ok := weekdays[bounds[0]]
+		if !ok {
+			return nil, fmt.Errorf("invalid day %q", bounds[0])
+		}
+		last := first
+		if len(bounds) == 2 {
+			if last, ok = weekdays[bounds[1]]; !ok {
+				return nil, fmt.Errorf("invalid day %q", bounds[1])
+			}
+		}
+		// Ranges may wrap around the end of the week, e.g. "Fri-Mon".
+		for d := first; ; d = (d + 1) % 7 {
+			days[d] = true
+			if d == last {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+// parseTimeOfDay parses a time in the format "hh:mm" as an offset from midnight.
+func parseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, must be in the format \"hh:mm\"", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Allow returns true if a run starting at the given time may apply files, either because it is within the window or because
+// a run was forced. A pending forced run is consumed by the next full run.
+func (w *ApplyWindow) Allow(runType RunType, now time.Time) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if runType == FullRun && w.forced {
+		w.forced = false
+		return true
+	}
+	return w.contains(now)
+}
+
+// contains returns true if the given time is within the window.
+func (w *ApplyWindow) contains(now time.Time) bool {
+	now = now.In(w.Location)
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, w.Location)
+	offset := now.Sub(midnight)
+	if w.End > w.Start {
+		return w.Days[now.Weekday()] && offset >= w.Start && offset < w.End
+	}
+	// The window closes on the day after it opens.
+	if offset >= w.Start {
+		return w.Days[now.Weekday()]
+	}
+	return offset < w.End && w.Days[(now.Weekday()+6)%7]
+}
+
+// Force lets the next full run go ahead outside of the window, if AllowForced is set.
+func (w *ApplyWindow) Force() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.forced = w.AllowForced
+}
+
+// clearForce drops a pending forced run that was held back before reaching the window.
+func (w *ApplyWindow) clearForce() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.forced = false
+}
@@ -0,0 +1,61 @@
+package run
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestParseApplyWindow(t *testing.T) {
+	assert := assert.New(t)
+
+	w, err := ParseApplyWindow("Mon-Wed,Fri 09:00-17:30", time.UTC)
+	assert.Nil(err)
+	assert.Equal(map[time.Weekday]bool{time.Monday: true, time.Tuesday: true, time.Wednesday: true, time.Friday: true}, w.Days)
+	assert.Equal(9*time.Hour, w.Start)
+	assert.Equal(17*time.Hour+30*time.Minute, w.End)
+
+	// Day ranges wrap around the end of the week
+	w, err = ParseApplyWindow("Fri-Mon 22:00-06:00", time.UTC)
+	assert.Nil(err)
+	assert.Equal(map[time.Weekday]bool{time.Friday: true, time.Saturday: true, time.Sunday: true, time.Monday: true}, w.Days)
+
+	for _, spec := range []string{"", "Mon-Fri", "Mon-Fri 09:00", "Mon-Fri 9-17", "Monday 09:00-17:00", "Mon-Tue-Wed 09:00-17:00", "Mon-Fri 09:00-25:00"} {
+		_, err = ParseApplyWindow(spec, time.UTC)
+		assert.NotNil(err, spec)
+	}
+}
+
+func TestApplyWindowAllow(t *testing.T) {
+	assert := assert.New(t)
+	location := time.FixedZone("UTC+2", 2*60*60)
+	w, _ := ParseApplyWindow("Mon-Fri 09:00-17:00", location)
+
+	// 2020-01-06 is a Monday
+	assert.True(w.Allow(QuickRun, time.Date(2020, 1, 6, 9, 0, 0, 0, location)))
+	assert.True(w.Allow(FullRun, time.Date(2020, 1, 10, 16, 59, 0, 0, location)))
+	assert.False(w.Allow(FullRun, time.Date(2020, 1, 6, 17, 0, 0, 0, location)))
+	assert.False(w.Allow(QuickRun, time.Date(2020, 1, 11, 12, 0, 0, 0, location)))
+
+	// Evaluated in the window's location
+	assert.False(w.Allow(QuickRun, time.Date(2020, 1, 6, 6, 30, 0, 0, time.UTC)))
+	assert.True(w.Allow(QuickRun, time.Date(2020, 1, 6, 7, 30, 0, 0, time.UTC)))
+
+	// Forcing is ignored unless allowed
+	saturday := time.Date(2020, 1, 11, 12, 0, 0, 0, location)
+	w.Force()
+	assert.False(w.Allow(FullRun, saturday))
+	w.AllowForced = true
+	w.Force()
+	assert.False(w.Allow(QuickRun, saturday))
+	assert.True(w.Allow(FullRun, saturday))
+	assert.False(w.Allow(FullRun, saturday))
+
+	// Window closing on the next day
+	w, _ = ParseApplyWindow("Sat 22:00-06:00", location)
+	assert.False(w.Allow(QuickRun, time.Date(2020, 1, 11, 21, 59, 0, 0, location)))
+	assert.True(w.Allow(QuickRun, time.Date(2020, 1, 11, 22, 0, 0, 0, location)))
+	assert.True(w.Allow(QuickRun, time.Date(2020, 1, 12, 5, 59, 0, 0, location)))
+	assert.False(w.Allow(QuickRun, time.Date(2020, 1, 12, 6, 0, 0, 0, location)))
+	assert.False(w.Allow(QuickRun, time.Date(2020, 1, 11, 5, 0, 0, 0, location)))
+}
@@ -0,0 +1,70 @@
+package run
+
+import "sync"
+
+// AuthorPolicy restricts automatic runs to commits authored or committed by one of AllowedEmails, as a lightweight approval gate.
+// Every commit since the last allowed one is checked, since applying a commit also applies the commits before it.
+// Runs of any other commit are left pending until a full run is forced, which approves the commit it applies.
+// It is shared between the runner, which checks it before applying, and the webserver, which approves forced runs.
+type AuthorPolicy struct {
+	AllowedEmails []string
+	mu            sync.Mutex
+	forced        bool
+	approvedHash  string
+	allowedHash   string
+}
+
+// AllowedHash returns the hash of the last commit that was allowed, or an empty string if none was allowed since startup.
+// The commits after it are the ones to check before applying a later commit.
+func (p *AuthorPolicy) AllowedHash() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.allowedHash
+}
+
+// Allow returns true if a run of the given type may apply the commit with the given hash, given the author and committer emails
+// of every commit since AllowedHash. A pending forced run is consumed by the next full run.
+func (p *AuthorPolicy) Allow(runType RunType, hash string, emails [][]string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if runType == FullRun && p.forced {
+		p.forced = false
+		p.approvedHash = hash
+	}
+	if hash != p.approvedHash && !p.allowCommits(emails) {
+		return false
+	}
+	p.allowedHash = hash
+	return true
+}
+
+// allowCommits returns true if every commit is authored or committed by one of AllowedEmails.
+func (p *AuthorPolicy) allowCommits(emails [][]string) bool {
+	allowed := stringSet(p.AllowedEmails)
+	for _, commit := range emails {
+		ok := false
+		for _, email := range commit {
+			if _, ok = allowed[email]; ok {
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Force approves the commit applied by the next full run, whoever authored it.
+func (p *AuthorPolicy) Force() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.forced = true
+}
+
+// clearForce drops a pending forced run that was held back before reaching the policy.
+func (p *AuthorPolicy) clearForce() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.forced = false
+}
@@ -0,0 +1,44 @@
+package run
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestAuthorPolicyAllow(t *testing.T) {
+	assert := assert.New(t)
+	p := &AuthorPolicy{AllowedEmails: []string{"alice@example.com", "merge-bot@example.com"}}
+
+	bob := []string{"bob@example.com", "bob@example.com"}
+	assert.Equal("", p.AllowedHash())
+
+	// Allowed author or committer
+	assert.True(p.Allow(QuickRun, "hash1", [][]string{{"alice@example.com", "alice@example.com"}}))
+	assert.True(p.Allow(FullRun, "hash1", [][]string{{"bob@example.com", "merge-bot@example.com"}}))
+	assert.Equal("hash1", p.AllowedHash())
+
+	// No new commits
+	assert.True(p.Allow(FullRun, "hash1", [][]string{}))
+
+	// Neither is allowed
+	assert.False(p.Allow(QuickRun, "hash2", [][]string{bob}))
+	assert.False(p.Allow(FullRun, "hash2", [][]string{bob}))
+	assert.Equal("hash1", p.AllowedHash())
+
+	// Every commit is checked, not only the last one
+	assert.False(p.Allow(QuickRun, "hash3", [][]string{{"bob@example.com", "merge-bot@example.com"}, bob}))
+
+	// Forcing does not apply to quick runs
+	p.Force()
+	assert.False(p.Allow(QuickRun, "hash3", [][]string{{"bob@example.com", "merge-bot@example.com"}, bob}))
+
+	// The next full run approves its commit, which stays approved for later runs
+	assert.True(p.Allow(FullRun, "hash3", [][]string{{"bob@example.com", "merge-bot@example.com"}, bob}))
+	assert.True(p.Allow(FullRun, "hash3", [][]string{{"bob@example.com", "merge-bot@example.com"}, bob}))
+	assert.True(p.Allow(QuickRun, "hash3", [][]string{{"bob@example.com", "merge-bot@example.com"}, bob}))
+	assert.Equal("hash3", p.AllowedHash())
+
+	// Later commits are not approved
+	assert.False(p.Allow(FullRun, "hash4", [][]string{bob}))
+	assert.True(p.Allow(QuickRun, "hash4", [][]string{{"alice@example.com", "bob@example.com"}}))
+}
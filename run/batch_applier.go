@@ -1,10 +1,19 @@
 package run
 
 import (
+	"fmt"
 	"github.com/box/kube-applier/kube"
+	"github.com/box/kube-applier/sysutil"
 	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// strongboxHeader is the first line of every file encrypted by strongbox (https://github.com/uw-labs/strongbox).
+const strongboxHeader = "# STRONGBOX ENCRYPTED RESOURCE"
+
 // ApplyAttempt stores the data from an attempt at applying a single file.
 type ApplyAttempt struct {
 	FilePath     string
@@ -13,14 +22,69 @@ type ApplyAttempt struct {
 	ErrorMessage string
 }
 
+// ValidateMode determines how schema validation findings affect an apply run.
+type ValidateMode string
+
+const (
+	// ValidateOff skips validation entirely.
+	ValidateOff ValidateMode = "off"
+	// ValidateWarn records validation findings but still applies every file.
+	ValidateWarn ValidateMode = "warn"
+	// ValidateStrict records validation findings and does not apply the files that failed validation.
+	ValidateStrict ValidateMode = "strict"
+)
+
+// ParseValidateMode converts the value of $VALIDATE_MODE into a ValidateMode, returning an error for unknown values.
+// An empty string is treated as ValidateOff.
+func ParseValidateMode(s string) (ValidateMode, error) {
+	switch ValidateMode(s) {
+	case "", ValidateOff:
+		return ValidateOff, nil
+	case ValidateWarn, ValidateStrict:
+		return ValidateMode(s), nil
+	}
+	return "", fmt.Errorf("Invalid validate mode %q, must be one of %q, %q or %q", s, ValidateStrict, ValidateWarn, ValidateOff)
+}
+
 // BatchApplierInterface allows for mocking out the functionality of BatchApplier when testing the full process of an apply run.
 type BatchApplierInterface interface {
 	Apply(int, []string) (successes []ApplyAttempt, failures []ApplyAttempt)
+	DryRun(int, []string) (successes []ApplyAttempt, failures []ApplyAttempt)
+	Validate(int, []string) (findings []ApplyAttempt)
+	CheckRollouts(int, []ApplyAttempt) (checks []ApplyAttempt)
+	Label(int, []ApplyAttempt, map[string]string)
 }
 
+// immutableFieldError is part of the error kubectl apply reports when a change cannot be applied in place.
+const immutableFieldError = "field is immutable"
+
+// CommitLabel is set to the applied commit hash on every object if ownership labels are enabled.
+const CommitLabel = "kube-applier.io/commit"
+
+// ApplyPhaseAnnotation assigns the objects of a file to an apply phase if apply phases are enabled.
+const ApplyPhaseAnnotation = "kube-applier.io/apply-phase"
+
+// rolloutKinds are the workload kinds that "kubectl rollout status" supports.
+var rolloutKinds = []string{"Deployment", "StatefulSet", "DaemonSet"}
+
 // BatchApplier makes apply calls for a batch of files.
+// If CheckEncryptedFiles is set, files that are still strongbox-encrypted are reported as failures instead of being applied.
+// RolloutTimeout limits how long CheckRollouts waits for each file's workloads to become ready.
+// If NamespacesFirst is set, files that define a Namespace are applied before all other files, so that resources in brand-new namespaces can be created.
+// Files that fail to apply because of a change to an immutable field are replaced instead, if they only define ReplaceKinds.
+// If ApplyPhases is set, files are applied in the order of their apply phase, and each phase waits for the previous one to roll out.
+// If GroupLimits is set, a batch only starts applying once it holds a slot of every limited API group its files define objects of.
+// If ApplyOrder is set, files are ordered by it before any of the above, and their apply times are recorded in it.
 type BatchApplier struct {
-	KubeClient kube.ClientInterface
+	KubeClient          kube.ClientInterface
+	FileSystem          sysutil.FileSystemInterface
+	CheckEncryptedFiles bool
+	RolloutTimeout      time.Duration
+	NamespacesFirst     bool
+	ReplaceKinds        []string
+	ApplyPhases         bool
+	GroupLimits         *GroupLimits
+	ApplyOrder          *ApplyOrder
 }
 
 // Apply takes a list of files and attempts an apply command on each, labeling logs with the run ID.
@@ -30,12 +94,99 @@ func (a *BatchApplier) Apply(id int, applyList []string) (successes []ApplyAttem
 		log.Fatal(err)
 	}
 
+	if a.ApplyOrder != nil {
+		applyList = a.ApplyOrder.Sort(id, applyList)
+		defer a.ApplyOrder.Finish(id)
+	}
+	if a.NamespacesFirst {
+		applyList = a.namespacesFirst(applyList)
+	}
+	defer a.acquireGroups(id, applyList)()
+	if a.ApplyPhases {
+		return a.applyPhases(id, applyList)
+	}
+	return a.applyFiles(id, applyList, false)
+}
+
+// Order returns the apply list in the order Apply applies its files: by the ApplyOrder, with the files that define a Namespace
+// first if NamespacesFirst is set, and by apply phase if ApplyPhases is set. Files whose phase cannot be determined are listed
+// last, since Apply reports them as failures without applying them.
+func (a *BatchApplier) Order(applyList []string) []string {
+	if a.ApplyOrder != nil {
+		applyList = a.ApplyOrder.Order(applyList)
+	}
+	if a.NamespacesFirst {
+		applyList = a.namespacesFirst(applyList)
+	}
+	if !a.ApplyPhases {
+		return applyList
+	}
+	type phasedFile struct {
+		path  string
+		phase int
+		err   error
+	}
+	files := make([]phasedFile, 0, len(applyList))
+	for _, path := range applyList {
+		phase, err := a.readPhase(path)
+		files = append(files, phasedFile{path, phase, err})
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		if (files[i].err != nil) != (files[j].err != nil) {
+			return files[j].err != nil
+		}
+		return files[i].phase < files[j].phase
+	})
+	ordered := make([]string, 0, len(files))
+	for _, f := range files {
+		ordered = append(ordered, f.path)
+	}
+	return ordered
+}
+
+// DryRun takes a list of files and attempts a server-side dry-run apply of each, labeling logs with the run ID.
+// Nothing is changed in the cluster, so files are neither replaced nor applied in phases.
+// It returns two lists of ApplyAttempts - one for files that succeeded, and one for files that failed.
+func (a *BatchApplier) DryRun(id int, applyList []string) (successes []ApplyAttempt, failures []ApplyAttempt) {
+	if err := a.KubeClient.CheckVersion(); err != nil {
+		log.Fatal(err)
+	}
+
+	if a.NamespacesFirst {
+		applyList = a.namespacesFirst(applyList)
+	}
+	defer a.acquireGroups(id, applyList)()
+	return a.applyFiles(id, applyList, true)
+}
+
+// applyFiles attempts an apply command, or a dry-run apply command if dryRun is set, on each file in order, labeling logs with the run ID.
+func (a *BatchApplier) applyFiles(id int, applyList []string, dryRun bool) (successes []ApplyAttempt, failures []ApplyAttempt) {
+	apply := a.KubeClient.Apply
+	if dryRun {
+		apply = a.KubeClient.DryRun
+	}
 	successes = []ApplyAttempt{}
 	failures = []ApplyAttempt{}
+	encrypted := []string{}
 	for _, path := range applyList {
+		if a.CheckEncryptedFiles && a.isEncrypted(path) {
+			encrypted = append(encrypted, path)
+			failures = append(failures, ApplyAttempt{path, "", "", "Error: file is still strongbox-encrypted, check that the repository was decrypted"})
+			continue
+		}
 		log.Printf("RUN %v: Applying file %v", id, path)
-		cmd, output, err := a.KubeClient.Apply(path)
+		done := func(bool) {}
+		if a.ApplyOrder != nil && !dryRun {
+			done = a.ApplyOrder.Start(id, path)
+		}
+		cmd, output, err := apply(path)
+		if err != nil && !dryRun && a.canReplace(path, output) {
+			log.Printf("RUN %v: %v\n%v\n%v", id, cmd, output, err)
+			log.Printf("RUN %v: Replacing file %v", id, path)
+			cmd, output, err = a.KubeClient.Replace(path)
+		}
 		success := (err == nil)
+		done(success)
 		appliedFile := ApplyAttempt{path, cmd, output, ""}
 		if success {
 			successes = append(successes, appliedFile)
@@ -46,5 +197,212 @@ func (a *BatchApplier) Apply(id int, applyList []string) (successes []ApplyAttem
 			log.Printf("RUN %v: %v\n%v\n%v", id, cmd, output, appliedFile.ErrorMessage)
 		}
 	}
+	if len(encrypted) > 0 {
+		log.Printf("RUN %v: Skipped %v strongbox-encrypted files: %v", id, len(encrypted), strings.Join(encrypted, ", "))
+	}
+	return successes, failures
+}
+
+// acquireGroups waits for the GroupLimits slots of the API groups defined in the files of applyList, and returns a function that
+// releases them. Files that cannot be parsed are left to fail when they are applied.
+func (a *BatchApplier) acquireGroups(id int, applyList []string) (release func()) {
+	if a.GroupLimits == nil {
+		return func() {}
+	}
+	groups := []string{}
+	for _, path := range applyList {
+		resources, _ := readResources(a.FileSystem, path)
+		for _, r := range resources {
+			groups = append(groups, apiGroup(r.APIVersion))
+		}
+	}
+	return a.GroupLimits.Acquire(id, groups)
+}
+
+// applyPhases applies the files grouped by their apply phase, in ascending order. Once a phase has been applied, the rollouts of its
+// workloads are checked before the next phase is applied. If a file of a phase fails to apply or to roll out, the files of the later
+// phases are reported as failures without being applied. Files whose phase cannot be determined are reported as failures too.
+func (a *BatchApplier) applyPhases(id int, applyList []string) (successes []ApplyAttempt, failures []ApplyAttempt) {
+	successes = []ApplyAttempt{}
+	failures = []ApplyAttempt{}
+	phases := map[int][]string{}
+	for _, path := range applyList {
+		phase, err := a.readPhase(path)
+		if err != nil {
+			failures = append(failures, ApplyAttempt{path, "", "", err.Error()})
+			log.Printf("RUN %v: Not applying file %v: %v", id, path, err)
+			continue
+		}
+		phases[phase] = append(phases[phase], path)
+	}
+	order := []int{}
+	for phase := range phases {
+		order = append(order, phase)
+	}
+	sort.Ints(order)
+
+	for i, phase := range order {
+		log.Printf("RUN %v: Applying phase %v", id, phase)
+		phaseSuccesses, phaseFailures := a.applyFiles(id, phases[phase], false)
+		successes = append(successes, phaseSuccesses...)
+		failures = append(failures, phaseFailures...)
+		if i == len(order)-1 {
+			break
+		}
+		healthy := len(phaseFailures) == 0
+		if healthy {
+			for _, check := range a.CheckRollouts(id, phaseSuccesses) {
+				if check.ErrorMessage != "" {
+					healthy = false
+				}
+			}
+		}
+		if !healthy {
+			log.Printf("RUN %v: Phase %v did not complete, not applying later phases", id, phase)
+			for _, later := range order[i+1:] {
+				for _, path := range phases[later] {
+					failures = append(failures, ApplyAttempt{path, "", "", fmt.Sprintf("Error: not applied because apply phase %v did not complete", phase)})
+				}
+			}
+			break
+		}
+	}
 	return successes, failures
 }
+
+// readPhase returns the apply phase of the file located at path, set by the ApplyPhaseAnnotation on its objects. Objects without
+// the annotation are in phase 0. Since a file is applied as a whole, all of its objects must be in the same phase.
+// Files that cannot be read or parsed are in phase 0, and left for kubectl to report on.
+func (a *BatchApplier) readPhase(path string) (int, error) {
+	resources, err := readResources(a.FileSystem, path)
+	if err != nil || len(resources) == 0 {
+		return 0, nil
+	}
+	phase := 0
+	for i, r := range resources {
+		p := 0
+		if value, ok := r.Metadata.Annotations[ApplyPhaseAnnotation]; ok {
+			if p, err = strconv.Atoi(value); err != nil {
+				return 0, fmt.Errorf("Error: invalid %v annotation %q, must be an integer", ApplyPhaseAnnotation, value)
+			}
+		}
+		if i > 0 && p != phase {
+			return 0, fmt.Errorf("Error: file has objects in apply phases %v and %v, split it into one file per phase", phase, p)
+		}
+		phase = p
+	}
+	return phase, nil
+}
+
+// canReplace returns true if the apply of the file located at path failed because an immutable field was changed, and every
+// kind it defines may be replaced. Replacing deletes and recreates all objects in the file, so files defining other kinds are never replaced.
+func (a *BatchApplier) canReplace(path, output string) bool {
+	if len(a.ReplaceKinds) == 0 || !strings.Contains(output, immutableFieldError) {
+		return false
+	}
+	kinds, err := readKinds(a.FileSystem, path)
+	if err != nil || len(kinds) == 0 {
+		return false
+	}
+	replaceable := stringSet(a.ReplaceKinds)
+	for _, kind := range kinds {
+		if _, ok := replaceable[kind]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// namespacesFirst returns the list with the files that define a Namespace moved ahead of all other files, preserving their order otherwise.
+// Files that cannot be read or parsed are left in place for kubectl to report on.
+func (a *BatchApplier) namespacesFirst(applyList []string) []string {
+	namespaces := []string{}
+	others := []string{}
+	for _, path := range applyList {
+		kinds, _ := readKinds(a.FileSystem, path)
+		if _, ok := stringSet(kinds)["Namespace"]; ok {
+			namespaces = append(namespaces, path)
+		} else {
+			others = append(others, path)
+		}
+	}
+	return append(namespaces, others...)
+}
+
+// isEncrypted returns true if the file located at path starts with the strongbox header.
+// Files that cannot be read are left for kubectl to report on.
+func (a *BatchApplier) isEncrypted(path string) bool {
+	lines, err := a.FileSystem.ReadLines(path)
+	if err != nil || len(lines) == 0 {
+		return false
+	}
+	return strings.HasPrefix(lines[0], strongboxHeader)
+}
+
+// Validate takes a list of files and runs schema validation on each, labeling logs with the run ID.
+// It returns an ApplyAttempt for every file that failed validation.
+func (a *BatchApplier) Validate(id int, applyList []string) (findings []ApplyAttempt) {
+	findings = []ApplyAttempt{}
+	for _, path := range applyList {
+		cmd, output, err := a.KubeClient.Validate(path)
+		if err != nil {
+			finding := ApplyAttempt{path, cmd, output, err.Error()}
+			findings = append(findings, finding)
+			log.Printf("RUN %v: Validation failed for file %v: %v\n%v\n%v", id, path, cmd, output, finding.ErrorMessage)
+		}
+	}
+	return findings
+}
+
+// CheckRollouts waits for the rollout of the workloads in each successfully applied file, labeling logs with the run ID.
+// Only files containing a Deployment, StatefulSet or DaemonSet are checked, one workload at a time, since kubectl cannot check
+// the rollout of a file that defines other resources too. Workloads annotated with kube.IgnoreAnnotation are not checked, nor are
+// workloads without a name, e.g. those using generateName, since kubectl cannot refer to them.
+// It returns an ApplyAttempt for every file checked, with the commands and outputs of all its workloads, and ErrorMessage set
+// to the errors of the workloads whose rollout did not complete.
+func (a *BatchApplier) CheckRollouts(id int, successes []ApplyAttempt) (checks []ApplyAttempt) {
+	checks = []ApplyAttempt{}
+	workloads := stringSet(rolloutKinds)
+	for _, applied := range successes {
+		resources, err := readResources(a.FileSystem, applied.FilePath)
+		if err != nil {
+			continue
+		}
+		cmds, outputs, errs := []string{}, []string{}, []string{}
+		for _, r := range resources {
+			if _, ok := workloads[r.Kind]; !ok || r.Metadata.Annotations[kube.IgnoreAnnotation] == "true" {
+				continue
+			}
+			if r.Metadata.Name == "" {
+				log.Printf("RUN %v: Not checking rollout status of %v without a name in file %v", id, r.Kind, applied.FilePath)
+				continue
+			}
+			log.Printf("RUN %v: Checking rollout status of %v %v in file %v", id, r.Kind, r.Metadata.Name, applied.FilePath)
+			cmd, output, err := a.KubeClient.RolloutStatus(r.Kind, r.Metadata.Name, r.Metadata.Namespace, a.RolloutTimeout)
+			cmds, outputs = append(cmds, cmd), append(outputs, output)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%v %v: %v", r.Kind, r.Metadata.Name, err))
+			}
+		}
+		if len(cmds) == 0 {
+			continue
+		}
+		check := ApplyAttempt{applied.FilePath, strings.Join(cmds, "\n"), strings.Join(outputs, "\n"), strings.Join(errs, "; ")}
+		if check.ErrorMessage != "" {
+			log.Printf("RUN %v: Rollout failed for file %v: %v\n%v\n%v", id, applied.FilePath, check.Command, check.Output, check.ErrorMessage)
+		}
+		checks = append(checks, check)
+	}
+	return checks
+}
+
+// Label sets the given labels on the objects in each successfully applied file, labeling logs with the run ID.
+// Failures are only logged, since the files were applied.
+func (a *BatchApplier) Label(id int, successes []ApplyAttempt, labels map[string]string) {
+	for _, applied := range successes {
+		cmd, output, err := a.KubeClient.Label(applied.FilePath, labels)
+		if err != nil {
+			log.Printf("RUN %v: Labeling failed for file %v: %v\n%v\n%v", id, applied.FilePath, cmd, output, err)
+		}
+	}
+}
@@ -3,9 +3,13 @@ package run
 import (
 	"fmt"
 	"github.com/box/kube-applier/kube"
+	"github.com/box/kube-applier/sysutil"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 )
 
 type batchTestCase struct {
@@ -85,6 +89,100 @@ func TestBatchApplierApply(t *testing.T) {
 	runCount++
 }
 
+func TestBatchApplierApplyEncryptedFiles(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	kubeClient := kube.NewMockClientInterface(mockCtrl)
+	fs := sysutil.NewMockFileSystemInterface(mockCtrl)
+	ba := BatchApplier{KubeClient: kubeClient, FileSystem: fs, CheckEncryptedFiles: true}
+
+	gomock.InOrder(
+		expectCheckVersionAndReturnNil(kubeClient),
+		fs.EXPECT().ReadLines("file1").Times(1).Return([]string{"apiVersion: v1"}, nil),
+		expectApplyAndReturnSuccess("file1", kubeClient),
+		fs.EXPECT().ReadLines("file2").Times(1).Return([]string{strongboxHeader + " ; See https://github.com/uw-labs/strongbox", "version: 1"}, nil),
+		fs.EXPECT().ReadLines("file3").Times(1).Return(nil, fmt.Errorf("read error")),
+		expectApplyAndReturnSuccess("file3", kubeClient),
+	)
+	successes, failures := ba.Apply(0, []string{"file1", "file2", "file3"})
+	assert.Equal([]ApplyAttempt{
+		{"file1", "cmd file1", "output file1", ""},
+		{"file3", "cmd file3", "output file3", ""},
+	}, successes)
+	assert.Equal([]ApplyAttempt{
+		{"file2", "", "", "Error: file is still strongbox-encrypted, check that the repository was decrypted"},
+	}, failures)
+}
+
+func TestBatchApplierApplyNamespacesFirst(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	kubeClient := kube.NewMockClientInterface(mockCtrl)
+	fs := sysutil.NewMockFileSystemInterface(mockCtrl)
+	ba := BatchApplier{KubeClient: kubeClient, FileSystem: fs, NamespacesFirst: true}
+
+	fs.EXPECT().ReadFile("a/deployment.yaml").Times(1).Return([]byte("kind: Deployment\n"), nil)
+	fs.EXPECT().ReadFile("a/namespace.yaml").Times(1).Return([]byte("kind: Namespace\n"), nil)
+	fs.EXPECT().ReadFile("b/all.yaml").Times(1).Return([]byte(`kind: Service
+---
+kind: Namespace
+`), nil)
+	fs.EXPECT().ReadFile("c/broken.yaml").Times(1).Return(nil, fmt.Errorf("read error"))
+	gomock.InOrder(
+		expectCheckVersionAndReturnNil(kubeClient),
+		expectApplyAndReturnSuccess("a/namespace.yaml", kubeClient),
+		expectApplyAndReturnSuccess("b/all.yaml", kubeClient),
+		expectApplyAndReturnSuccess("a/deployment.yaml", kubeClient),
+		expectApplyAndReturnSuccess("c/broken.yaml", kubeClient),
+	)
+	successes, failures := ba.Apply(0, []string{"a/deployment.yaml", "a/namespace.yaml", "b/all.yaml", "c/broken.yaml"})
+	assert.Equal([]ApplyAttempt{
+		{"a/namespace.yaml", "cmd a/namespace.yaml", "output a/namespace.yaml", ""},
+		{"b/all.yaml", "cmd b/all.yaml", "output b/all.yaml", ""},
+		{"a/deployment.yaml", "cmd a/deployment.yaml", "output a/deployment.yaml", ""},
+		{"c/broken.yaml", "cmd c/broken.yaml", "output c/broken.yaml", ""},
+	}, successes)
+	assert.Equal([]ApplyAttempt{}, failures)
+}
+
+func TestBatchApplierApplyReplaceKinds(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	kubeClient := kube.NewMockClientInterface(mockCtrl)
+	fs := sysutil.NewMockFileSystemInterface(mockCtrl)
+	ba := BatchApplier{KubeClient: kubeClient, FileSystem: fs, ReplaceKinds: []string{"Job"}}
+
+	immutable := "The Job \"migrate\" is invalid: spec.template: Invalid value: field is immutable"
+	gomock.InOrder(
+		expectCheckVersionAndReturnNil(kubeClient),
+		// Only files that failed with an immutable field error are replaced.
+		kubeClient.EXPECT().Apply("job.yaml").Times(1).Return("cmd job.yaml", immutable, fmt.Errorf("exit status 1")),
+		fs.EXPECT().ReadFile("job.yaml").Times(1).Return([]byte("kind: Job\n"), nil),
+		kubeClient.EXPECT().Replace("job.yaml").Times(1).Return("replace job.yaml", "job.batch/migrate replaced", nil),
+		// Files that also define other kinds are never replaced.
+		kubeClient.EXPECT().Apply("mixed.yaml").Times(1).Return("cmd mixed.yaml", immutable, fmt.Errorf("exit status 1")),
+		fs.EXPECT().ReadFile("mixed.yaml").Times(1).Return([]byte(`kind: Job
+---
+kind: Service
+`), nil),
+		expectApplyAndReturnFailure("other.yaml", kubeClient),
+	)
+	successes, failures := ba.Apply(0, []string{"job.yaml", "mixed.yaml", "other.yaml"})
+	assert.Equal([]ApplyAttempt{
+		{"job.yaml", "replace job.yaml", "job.batch/migrate replaced", ""},
+	}, successes)
+	assert.Equal([]ApplyAttempt{
+		{"mixed.yaml", "cmd mixed.yaml", immutable, "exit status 1"},
+		{"other.yaml", "cmd other.yaml", "output other.yaml", "error other.yaml"},
+	}, failures)
+}
+
 func expectCheckVersionAndReturnNil(kubeClient *kube.MockClientInterface) *gomock.Call {
 	return kubeClient.EXPECT().CheckVersion().Times(1).Return(nil)
 }
@@ -99,8 +197,361 @@ func expectApplyAndReturnFailure(file string, kubeClient *kube.MockClientInterfa
 
 func applyAndAssert(t *testing.T, runCount int, tc batchTestCase) {
 	assert := assert.New(t)
-	ba := BatchApplier{tc.kubeClient}
+	ba := BatchApplier{KubeClient: tc.kubeClient}
 	successes, failures := ba.Apply(runCount, tc.applyList)
 	assert.Equal(tc.expectedSuccesses, successes)
 	assert.Equal(tc.expectedFailures, failures)
 }
+
+// phaseManifests are real manifests in apply phases, whose annotations are nested under metadata.
+var phaseManifests = map[string]string{
+	"apps/app.yaml": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  namespace: apps
+  annotations:
+    kube-applier.io/apply-phase: "2"
+spec:
+  template:
+    metadata:
+      annotations:
+        kube-applier.io/apply-phase: "0"
+`,
+	"apps/config.yaml": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+  namespace: apps
+data:
+  key: value
+`,
+	"apps/namespace.yaml": `apiVersion: v1
+kind: Namespace
+metadata:
+  name: apps
+`,
+	"cluster/crd.yaml": `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+  annotations:
+    kube-applier.io/apply-phase: "0"
+`,
+	"ingress/operator.yaml": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: operator
+  namespace: ingress
+  annotations:
+    kube-applier.io/apply-phase: "1"
+    description: |
+      Watches the widgets
+      of every namespace.
+`,
+	"apps/mixed.yaml": `apiVersion: v1
+kind: Service
+metadata:
+  name: mixed
+  annotations:
+    kube-applier.io/apply-phase: "1"
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: mixed
+  annotations:
+    kube-applier.io/apply-phase: "2"
+`,
+	"apps/invalid.yaml": `apiVersion: v1
+kind: Service
+metadata:
+  name: invalid
+  annotations:
+    kube-applier.io/apply-phase: first
+`,
+}
+
+func TestBatchApplierOrder(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := writeManifests(t, phaseManifests)
+	defer os.RemoveAll(dir)
+	at := func(name string) string { return filepath.Join(dir, name) }
+	applyList := []string{at("apps/app.yaml"), at("apps/config.yaml"), at("apps/invalid.yaml"), at("apps/namespace.yaml"), at("cluster/crd.yaml"), at("ingress/operator.yaml")}
+
+	// Without any ordering setting, files are applied in the order of the list
+	ba := BatchApplier{FileSystem: &sysutil.FileSystem{}}
+	assert.Equal(applyList, ba.Order(applyList))
+
+	// Cluster resources and critical paths first, then namespaces first
+	ba.ApplyOrder = &ApplyOrder{ClusterResourcesPath: at("cluster"), CriticalPaths: []string{at("ingress")}}
+	ba.NamespacesFirst = true
+	assert.Equal([]string{
+		at("apps/namespace.yaml"),
+		at("cluster/crd.yaml"),
+		at("ingress/operator.yaml"),
+		at("apps/app.yaml"),
+		at("apps/config.yaml"),
+		at("apps/invalid.yaml"),
+	}, ba.Order(applyList))
+
+	// Phases take precedence, and files whose phase cannot be determined come last
+	ba.ApplyPhases = true
+	assert.Equal([]string{
+		at("apps/namespace.yaml"),
+		at("cluster/crd.yaml"),
+		at("apps/config.yaml"),
+		at("ingress/operator.yaml"),
+		at("apps/app.yaml"),
+		at("apps/invalid.yaml"),
+	}, ba.Order(applyList))
+	assert.Nil(ba.ApplyOrder.Backlog(0))
+}
+
+func TestBatchApplierApplyPhases(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	dir := writeManifests(t, phaseManifests)
+	defer os.RemoveAll(dir)
+	at := func(name string) string { return filepath.Join(dir, name) }
+	applied := func(name string) ApplyAttempt {
+		return ApplyAttempt{at(name), "cmd " + at(name), "output " + at(name), ""}
+	}
+
+	kubeClient := kube.NewMockClientInterface(mockCtrl)
+	ba := BatchApplier{KubeClient: kubeClient, FileSystem: &sysutil.FileSystem{}, ApplyPhases: true}
+
+	gomock.InOrder(
+		expectCheckVersionAndReturnNil(kubeClient),
+		expectApplyAndReturnSuccess(at("cluster/crd.yaml"), kubeClient),
+		expectApplyAndReturnSuccess(at("apps/config.yaml"), kubeClient),
+		expectApplyAndReturnSuccess(at("ingress/operator.yaml"), kubeClient),
+		kubeClient.EXPECT().RolloutStatus("Deployment", "operator", "ingress", time.Duration(0)).Times(1).Return("rollout", "", nil),
+		expectApplyAndReturnSuccess(at("apps/app.yaml"), kubeClient),
+	)
+	successes, failures := ba.Apply(0, []string{at("apps/app.yaml"), at("cluster/crd.yaml"), at("ingress/operator.yaml"), at("apps/config.yaml"), at("apps/mixed.yaml"), at("apps/invalid.yaml")})
+	assert.Equal([]ApplyAttempt{applied("cluster/crd.yaml"), applied("apps/config.yaml"), applied("ingress/operator.yaml"), applied("apps/app.yaml")}, successes)
+	assert.Equal([]ApplyAttempt{
+		{at("apps/mixed.yaml"), "", "", "Error: file has objects in apply phases 1 and 2, split it into one file per phase"},
+		{at("apps/invalid.yaml"), "", "", "Error: invalid " + ApplyPhaseAnnotation + " annotation \"first\", must be an integer"},
+	}, failures)
+
+	// Later phases are not applied if a rollout fails.
+	gomock.InOrder(
+		expectCheckVersionAndReturnNil(kubeClient),
+		expectApplyAndReturnSuccess(at("ingress/operator.yaml"), kubeClient),
+		kubeClient.EXPECT().RolloutStatus("Deployment", "operator", "ingress", time.Duration(0)).Times(1).Return("rollout", "", fmt.Errorf("timed out")),
+	)
+	successes, failures = ba.Apply(0, []string{at("apps/app.yaml"), at("ingress/operator.yaml")})
+	assert.Equal([]ApplyAttempt{applied("ingress/operator.yaml")}, successes)
+	assert.Equal([]ApplyAttempt{{at("apps/app.yaml"), "", "", "Error: not applied because apply phase 1 did not complete"}}, failures)
+
+	// Later phases are not applied if a file fails to apply.
+	gomock.InOrder(
+		expectCheckVersionAndReturnNil(kubeClient),
+		expectApplyAndReturnFailure(at("apps/config.yaml"), kubeClient),
+	)
+	successes, failures = ba.Apply(0, []string{at("apps/app.yaml"), at("apps/config.yaml")})
+	assert.Equal([]ApplyAttempt{}, successes)
+	assert.Equal([]ApplyAttempt{
+		{at("apps/config.yaml"), "cmd " + at("apps/config.yaml"), "output " + at("apps/config.yaml"), "error " + at("apps/config.yaml")},
+		{at("apps/app.yaml"), "", "", "Error: not applied because apply phase 0 did not complete"},
+	}, failures)
+}
+
+func TestBatchApplierApplyGroupLimits(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	kubeClient := kube.NewMockClientInterface(mockCtrl)
+	fs := sysutil.NewMockFileSystemInterface(mockCtrl)
+	groupLimits, _ := ParseGroupLimits([]string{"apiextensions.k8s.io=1"})
+	ba := BatchApplier{KubeClient: kubeClient, FileSystem: fs, GroupLimits: groupLimits}
+
+	fs.EXPECT().ReadFile("crd.yaml").Return([]byte(`apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+`), nil).AnyTimes()
+	fs.EXPECT().ReadFile("app.yaml").Return([]byte(`apiVersion: apps/v1
+kind: Deployment
+`), nil).AnyTimes()
+
+	// A run applying CRDs waits while another run holds the slot, runs for other groups do not.
+	release := groupLimits.Acquire(0, []string{"apiextensions.k8s.io"})
+	expectCheckVersionAndReturnNil(kubeClient)
+	expectApplyAndReturnSuccess("app.yaml", kubeClient)
+	successes, _ := ba.Apply(1, []string{"app.yaml"})
+	assert.Equal(1, len(successes))
+
+	expectCheckVersionAndReturnNil(kubeClient)
+	done := make(chan []ApplyAttempt)
+	go func() {
+		successes, _ := ba.Apply(2, []string{"app.yaml", "crd.yaml"})
+		done <- successes
+	}()
+	select {
+	case <-done:
+		t.Fatal("Applied CRDs while another run held the slot")
+	case <-time.After(50 * time.Millisecond):
+	}
+	expectApplyAndReturnSuccess("app.yaml", kubeClient)
+	expectApplyAndReturnSuccess("crd.yaml", kubeClient)
+	release()
+	assert.Equal(2, len(<-done))
+	assert.Equal(0, len(groupLimits.slots["apiextensions.k8s.io"]))
+}
+
+func TestBatchApplierDryRun(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	kubeClient := kube.NewMockClientInterface(mockCtrl)
+	fs := sysutil.NewMockFileSystemInterface(mockCtrl)
+	ba := BatchApplier{KubeClient: kubeClient, FileSystem: fs, ReplaceKinds: []string{"Job"}, ApplyPhases: true}
+
+	// Files are neither replaced nor applied in phases.
+	immutable := "The Job \"migrate\" is invalid: spec.template: Invalid value: field is immutable"
+	gomock.InOrder(
+		expectCheckVersionAndReturnNil(kubeClient),
+		kubeClient.EXPECT().DryRun("job.yaml").Times(1).Return("dryrun job.yaml", immutable, fmt.Errorf("exit status 1")),
+		kubeClient.EXPECT().DryRun("app.yaml").Times(1).Return("dryrun app.yaml", "deployment.apps/web configured (server dry run)", nil),
+	)
+	successes, failures := ba.DryRun(0, []string{"job.yaml", "app.yaml"})
+	assert.Equal([]ApplyAttempt{{"app.yaml", "dryrun app.yaml", "deployment.apps/web configured (server dry run)", ""}}, successes)
+	assert.Equal([]ApplyAttempt{{"job.yaml", "dryrun job.yaml", immutable, "exit status 1"}}, failures)
+}
+
+func TestBatchApplierValidate(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	kubeClient := kube.NewMockClientInterface(mockCtrl)
+	ba := BatchApplier{KubeClient: kubeClient}
+
+	// Empty apply list
+	assert.Equal([]ApplyAttempt{}, ba.Validate(0, []string{}))
+
+	// Some files fail validation
+	gomock.InOrder(
+		kubeClient.EXPECT().Validate("file1").Times(1).Return("cmd file1", "output file1", nil),
+		kubeClient.EXPECT().Validate("file2").Times(1).Return("cmd file2", "output file2", fmt.Errorf("error file2")),
+		kubeClient.EXPECT().Validate("file3").Times(1).Return("cmd file3", "output file3", nil),
+	)
+	findings := []ApplyAttempt{
+		{"file2", "cmd file2", "output file2", "error file2"},
+	}
+	assert.Equal(findings, ba.Validate(1, []string{"file1", "file2", "file3"}))
+}
+
+func TestBatchApplierCheckRollouts(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	kubeClient := kube.NewMockClientInterface(mockCtrl)
+	fs := sysutil.NewMockFileSystemInterface(mockCtrl)
+	ba := BatchApplier{KubeClient: kubeClient, FileSystem: fs, RolloutTimeout: time.Minute}
+
+	successes := []ApplyAttempt{
+		{"file1", "cmd file1", "output file1", ""},
+		{"file2", "cmd file2", "output file2", ""},
+		{"file3", "cmd file3", "output file3", ""},
+		{"file4", "cmd file4", "output file4", ""},
+		{"file5", "cmd file5", "output file5", ""},
+		{"file6", "cmd file6", "output file6", ""},
+	}
+	gomock.InOrder(
+		// Each workload of a file that mixes workloads with other resources is checked on its own
+		fs.EXPECT().ReadFile("file1").Times(1).Return([]byte(`kind: Service
+metadata:
+  name: web
+  namespace: team-a
+---
+kind: Deployment
+metadata:
+  name: web
+  namespace: team-a
+---
+kind: DaemonSet
+metadata:
+  name: agent
+`), nil),
+		kubeClient.EXPECT().RolloutStatus("Deployment", "web", "team-a", time.Minute).Times(1).Return("rollout web", "output web", nil),
+		kubeClient.EXPECT().RolloutStatus("DaemonSet", "agent", "", time.Minute).Times(1).Return("rollout agent", "output agent", nil),
+		fs.EXPECT().ReadFile("file2").Times(1).Return([]byte("kind: ConfigMap\n"), nil),
+		fs.EXPECT().ReadFile("file3").Times(1).Return([]byte(`kind: StatefulSet
+metadata:
+  name: db
+`), nil),
+		kubeClient.EXPECT().RolloutStatus("StatefulSet", "db", "", time.Minute).Times(1).Return("rollout db", "output db", fmt.Errorf("error db")),
+		fs.EXPECT().ReadFile("file4").Times(1).Return(nil, fmt.Errorf("read error")),
+		// Ignored workloads are not checked
+		fs.EXPECT().ReadFile("file5").Times(1).Return([]byte(`kind: Deployment
+metadata:
+  name: old
+  annotations:
+    kube-applier.io/ignore: "true"
+`), nil),
+		// Workloads without a name cannot be checked
+		fs.EXPECT().ReadFile("file6").Times(1).Return([]byte(`kind: Deployment
+metadata:
+  generateName: batch-
+`), nil),
+	)
+	checks := []ApplyAttempt{
+		{"file1", "rollout web\nrollout agent", "output web\noutput agent", ""},
+		{"file3", "rollout db", "output db", "StatefulSet db: error db"},
+	}
+	assert.Equal(checks, ba.CheckRollouts(0, successes))
+
+	// The name and namespace are read from the nested metadata of a real file
+	dir := writeManifests(t, phaseManifests)
+	defer os.RemoveAll(dir)
+	operator := filepath.Join(dir, "ingress/operator.yaml")
+	ba.FileSystem = &sysutil.FileSystem{}
+	kubeClient.EXPECT().RolloutStatus("Deployment", "operator", "ingress", time.Minute).Times(1).Return("rollout operator", "output operator", nil)
+	checks = []ApplyAttempt{{operator, "rollout operator", "output operator", ""}}
+	assert.Equal(checks, ba.CheckRollouts(0, []ApplyAttempt{{operator, "cmd", "output", ""}}))
+}
+
+func TestBatchApplierLabel(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	kubeClient := kube.NewMockClientInterface(mockCtrl)
+	ba := BatchApplier{KubeClient: kubeClient}
+
+	successes := []ApplyAttempt{
+		{"file1", "cmd file1", "output file1", ""},
+		{"file2", "cmd file2", "output file2", ""},
+	}
+	labels := map[string]string{CommitLabel: "hash"}
+	gomock.InOrder(
+		kubeClient.EXPECT().Label("file1", labels).Times(1).Return("label file1", "output file1", fmt.Errorf("error file1")),
+		kubeClient.EXPECT().Label("file2", labels).Times(1).Return("label file2", "output file2", nil),
+	)
+	ba.Label(0, successes, labels)
+}
+
+func TestParseValidateMode(t *testing.T) {
+	assert := assert.New(t)
+
+	for in, expected := range map[string]ValidateMode{
+		"":       ValidateOff,
+		"off":    ValidateOff,
+		"warn":   ValidateWarn,
+		"strict": ValidateStrict,
+	} {
+		mode, err := ParseValidateMode(in)
+		assert.Nil(err)
+		assert.Equal(expected, mode)
+	}
+
+	_, err := ParseValidateMode("lenient")
+	assert.NotNil(err)
+}
@@ -0,0 +1,50 @@
+package run
+
+import "sync"
+
+// CircuitBreaker suspends scheduled full runs after Threshold consecutive runs have failed, so that a permanently broken
+// repo does not keep re-applying the same files and alerting on every run.
+// Quick runs are never suspended, since a new commit may fix the failures, and a successful run of either type closes the breaker.
+// It is shared between the runner, which checks it before full runs, and the webserver, which lets a forced run through.
+type CircuitBreaker struct {
+	Threshold int
+	mu        sync.Mutex
+	failures  int
+	forced    bool
+}
+
+// Allow returns true if a full run should go ahead, either because the breaker is closed or because a run was forced.
+func (c *CircuitBreaker) Allow() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.forced {
+		c.forced = false
+		return true
+	}
+	return c.Threshold <= 0 || c.failures < c.Threshold
+}
+
+// Force lets the next full run go ahead even if the breaker is open.
+func (c *CircuitBreaker) Force() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.forced = true
+}
+
+// clearForce drops a pending forced run that was held back before reaching the breaker.
+func (c *CircuitBreaker) clearForce() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.forced = false
+}
+
+// Record counts a failed run towards the threshold, or closes the breaker after a successful run.
+func (c *CircuitBreaker) Record(succeeded bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if succeeded {
+		c.failures = 0
+		return
+	}
+	c.failures++
+}
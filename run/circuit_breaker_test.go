@@ -0,0 +1,34 @@
+package run
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	assert := assert.New(t)
+	c := &CircuitBreaker{Threshold: 2}
+
+	c.Record(false)
+	assert.True(c.Allow())
+
+	// Opens after the second consecutive failure
+	c.Record(false)
+	assert.False(c.Allow())
+
+	// A forced run is let through once
+	c.Force()
+	assert.True(c.Allow())
+	assert.False(c.Allow())
+
+	// A successful run closes the breaker
+	c.Record(true)
+	assert.True(c.Allow())
+
+	// Disabled without a threshold
+	c = &CircuitBreaker{}
+	for i := 0; i < 5; i++ {
+		c.Record(false)
+	}
+	assert.True(c.Allow())
+}
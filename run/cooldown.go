@@ -0,0 +1,31 @@
+package run
+
+import (
+	"github.com/box/kube-applier/sysutil"
+	"log"
+	"sync"
+	"time"
+)
+
+// Cooldown enforces a minimum interval between the starts of runs, so that polling, the full run interval and forced runs
+// that coincide do not apply the repo back to back. It is shared between the quick and full run loops. Triggers that come in
+// while a run waits collapse into the queued runs, since each queue holds a single run.
+type Cooldown struct {
+	Interval time.Duration
+	Clock    sysutil.ClockInterface
+	mu       sync.Mutex
+	last     time.Time
+}
+
+// Wait blocks until Interval has passed since the previous run started, and records the start of a new run.
+func (c *Cooldown) Wait() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.Clock.Now()
+	if wait := c.Interval - now.Sub(c.last); !c.last.IsZero() && wait > 0 {
+		log.Printf("Waiting %v for the minimum interval between runs.", wait)
+		c.Clock.Sleep(wait)
+		now = now.Add(wait)
+	}
+	c.last = now
+}
@@ -0,0 +1,32 @@
+package run
+
+import (
+	"github.com/box/kube-applier/sysutil"
+	"github.com/golang/mock/gomock"
+	"testing"
+	"time"
+)
+
+func TestCooldownWait(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	clock := sysutil.NewMockClockInterface(mockCtrl)
+	c := &Cooldown{Interval: time.Minute, Clock: clock}
+	gomock.InOrder(
+		// The first run starts right away.
+		clock.EXPECT().Now().Times(1).Return(time.Unix(0, 0)),
+		// A run 20 seconds later waits for the rest of the interval.
+		clock.EXPECT().Now().Times(1).Return(time.Unix(20, 0)),
+		clock.EXPECT().Sleep(40*time.Second).Times(1),
+		// The interval is counted from the end of the wait.
+		clock.EXPECT().Now().Times(1).Return(time.Unix(100, 0)),
+		clock.EXPECT().Sleep(20*time.Second).Times(1),
+		// A run after the interval starts right away.
+		clock.EXPECT().Now().Times(1).Return(time.Unix(300, 0)),
+	)
+	c.Wait()
+	c.Wait()
+	c.Wait()
+	c.Wait()
+}
@@ -0,0 +1,161 @@
+package run
+
+import (
+	"github.com/box/kube-applier/applylist"
+	"github.com/box/kube-applier/git"
+	"github.com/box/kube-applier/kube"
+	"github.com/box/kube-applier/sysutil"
+	"log"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DriftDetector compares the files that would be applied by a full run with the live objects in the cluster, using "kubectl diff"
+// so that nothing is changed. Diffing every file takes about as long as a full run, so a report is only computed when it is
+// requested, and is reused for TTL. Concurrent requests wait for the same report instead of computing their own.
+type DriftDetector struct {
+	KubeClient  kube.ClientInterface
+	ListFactory applylist.FactoryInterface
+	GitUtil     git.GitUtilInterface
+	FileSystem  sysutil.FileSystemInterface
+	Clock       sysutil.ClockInterface
+	TTL         time.Duration
+	mu          sync.Mutex
+	report      *DriftReport
+}
+
+// DriftReport lists the files whose objects differ from the live objects in the cluster.
+type DriftReport struct {
+	// Commit is the HEAD commit the files were read from.
+	Commit    string    `json:"commit"`
+	Generated time.Time `json:"generated"`
+	// Checked is the number of files that were diffed.
+	Checked int `json:"checked"`
+	// Files lists the files that drifted or could not be diffed.
+	Files []FileDrift `json:"files"`
+}
+
+// FileDrift holds the differences between the objects defined in a file and the live objects.
+type FileDrift struct {
+	FilePath string `json:"file"`
+	// Namespaces are the namespaces set on the objects of the file.
+	Namespaces []string      `json:"namespaces"`
+	Objects    []ObjectDrift `json:"objects"`
+	// Error is set if the file could not be diffed, in which case Objects is empty.
+	Error string `json:"error,omitempty"`
+}
+
+// ObjectDrift holds the differences for a single object, named as kubectl diff names it, e.g. "apps.v1.Deployment.default.nginx".
+type ObjectDrift struct {
+	Object string      `json:"object"`
+	Hunks  []DriftHunk `json:"hunks"`
+}
+
+// DriftHunk is a hunk of a unified diff, from the live object to the object that would be applied.
+type DriftHunk struct {
+	// Header is the "@@ -l,s +l,s @@" line of the hunk.
+	Header string   `json:"header"`
+	Lines  []string `json:"lines"`
+}
+
+// Report returns the drift report for the objects in the given namespace, or for all files if namespace is empty.
+// A new report is computed if the cached one is older than TTL.
+func (d *DriftDetector) Report(namespace string) (*DriftReport, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.report == nil || d.Clock.Now().Sub(d.report.Generated) >= d.TTL {
+		report, err := d.compute()
+		if err != nil {
+			return nil, err
+		}
+		d.report = report
+	}
+	report := &DriftReport{Commit: d.report.Commit, Generated: d.report.Generated, Files: []FileDrift{}}
+	for _, file := range d.report.Files {
+		if namespace != "" {
+			if _, ok := stringSet(file.Namespaces)[namespace]; !ok {
+				continue
+			}
+		}
+		report.Checked++
+		if len(file.Objects) > 0 || file.Error != "" {
+			report.Files = append(report.Files, file)
+		}
+	}
+	return report, nil
+}
+
+// compute diffs every file that a full run would apply, keeping the files without differences so that they can be counted.
+func (d *DriftDetector) compute() (*DriftReport, error) {
+	hash, err := d.GitUtil.HeadHash()
+	if err != nil {
+		return nil, err
+	}
+	rawList, err := d.GitUtil.ListAllFiles()
+	if err != nil {
+		return nil, err
+	}
+	applyList, _, _, err := d.ListFactory.Create(rawList)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Computing drift report for %v files at commit %v", len(applyList), hash)
+	report := &DriftReport{Commit: hash, Generated: d.Clock.Now(), Files: []FileDrift{}}
+	for _, filePath := range applyList {
+		file := FileDrift{FilePath: filePath, Namespaces: d.readNamespaces(filePath), Objects: []ObjectDrift{}}
+		cmd, output, err := d.KubeClient.Diff(filePath)
+		if err != nil {
+			file.Error = err.Error()
+			log.Printf("Diff failed for file %v: %v\n%v\n%v", filePath, cmd, output, file.Error)
+		} else {
+			file.Objects = parseDiff(output)
+		}
+		report.Files = append(report.Files, file)
+	}
+	return report, nil
+}
+
+// readNamespaces returns the namespaces set on the objects defined in the file located at path, in order of appearance.
+func (d *DriftDetector) readNamespaces(filePath string) []string {
+	namespaces := []string{}
+	resources, _ := readResources(d.FileSystem, filePath)
+	seen := map[string]struct{}{}
+	for _, r := range resources {
+		if _, ok := seen[r.Metadata.Namespace]; ok || r.Metadata.Namespace == "" {
+			continue
+		}
+		seen[r.Metadata.Namespace] = struct{}{}
+		namespaces = append(namespaces, r.Metadata.Namespace)
+	}
+	return namespaces
+}
+
+// parseDiff splits the output of kubectl diff into objects and hunks. kubectl diff runs "diff -u -N" on a live and a merged
+// copy of each object, so every object starts with a "diff" line naming both copies, followed by the "---" and "+++" lines.
+func parseDiff(output string) []ObjectDrift {
+	objects := []ObjectDrift{}
+	var object *ObjectDrift
+	var hunk *DriftHunk
+	for _, line := range strings.Split(output, "\n") {
+		switch {
+		case strings.HasPrefix(line, "diff "):
+			fields := strings.Fields(line)
+			objects = append(objects, ObjectDrift{Object: path.Base(fields[len(fields)-1]), Hunks: []DriftHunk{}})
+			object = &objects[len(objects)-1]
+			hunk = nil
+		case object == nil:
+			continue
+		case strings.HasPrefix(line, "@@"):
+			object.Hunks = append(object.Hunks, DriftHunk{Header: line, Lines: []string{}})
+			hunk = &object.Hunks[len(object.Hunks)-1]
+		case hunk == nil:
+			// The "---" and "+++" lines before the first hunk of an object.
+			continue
+		case line != "":
+			hunk.Lines = append(hunk.Lines, line)
+		}
+	}
+	return objects
+}
@@ -0,0 +1,162 @@
+package run
+
+import (
+	"fmt"
+	"github.com/box/kube-applier/applylist"
+	"github.com/box/kube-applier/git"
+	"github.com/box/kube-applier/kube"
+	"github.com/box/kube-applier/sysutil"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testDiff = `diff -u -N /tmp/LIVE-1/apps.v1.Deployment.team-a.web /tmp/MERGED-2/apps.v1.Deployment.team-a.web
+--- /tmp/LIVE-1/apps.v1.Deployment.team-a.web	2018-01-01 00:00:00.000000000 +0000
++++ /tmp/MERGED-2/apps.v1.Deployment.team-a.web	2018-01-01 00:00:00.000000000 +0000
+@@ -6,7 +6,7 @@
+   name: web
+ spec:
+-  replicas: 5
++  replicas: 3
+@@ -20,1 +20,1 @@
+-        image: web:2
++        image: web:1
+diff -u -N /tmp/LIVE-1/v1.Service.team-a.web /tmp/MERGED-2/v1.Service.team-a.web
+--- /tmp/LIVE-1/v1.Service.team-a.web	2018-01-01 00:00:00.000000000 +0000
++++ /tmp/MERGED-2/v1.Service.team-a.web	2018-01-01 00:00:00.000000000 +0000
+@@ -1,1 +1,1 @@
+-  port: 81
++  port: 80
+`
+
+func TestParseDiff(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal([]ObjectDrift{}, parseDiff(""))
+	assert.Equal([]ObjectDrift{
+		{"apps.v1.Deployment.team-a.web", []DriftHunk{
+			{"@@ -6,7 +6,7 @@", []string{"   name: web", " spec:", "-  replicas: 5", "+  replicas: 3"}},
+			{"@@ -20,1 +20,1 @@", []string{"-        image: web:2", "+        image: web:1"}},
+		}},
+		{"v1.Service.team-a.web", []DriftHunk{
+			{"@@ -1,1 +1,1 @@", []string{"-  port: 81", "+  port: 80"}},
+		}},
+	}, parseDiff(testDiff))
+}
+
+func TestDriftDetectorReport(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	kubeClient := kube.NewMockClientInterface(mockCtrl)
+	listFactory := applylist.NewMockFactoryInterface(mockCtrl)
+	gitUtil := git.NewMockGitUtilInterface(mockCtrl)
+	fs := sysutil.NewMockFileSystemInterface(mockCtrl)
+	clock := sysutil.NewMockClockInterface(mockCtrl)
+	d := &DriftDetector{KubeClient: kubeClient, ListFactory: listFactory, GitUtil: gitUtil, FileSystem: fs, Clock: clock, TTL: time.Minute}
+
+	fs.EXPECT().ReadFile("a/web.yaml").Return([]byte(`kind: Deployment
+metadata:
+  namespace: team-a
+`), nil).AnyTimes()
+	fs.EXPECT().ReadFile("a/config.yaml").Return([]byte(`kind: ConfigMap
+metadata:
+  namespace: team-a
+`), nil).AnyTimes()
+	fs.EXPECT().ReadFile("b/broken.yaml").Return([]byte(`kind: Deployment
+metadata:
+  namespace: team-b
+`), nil).AnyTimes()
+	gomock.InOrder(
+		gitUtil.EXPECT().HeadHash().Times(1).Return("hash", nil),
+		gitUtil.EXPECT().ListAllFiles().Times(1).Return([]string{"a/web.yaml", "a/config.yaml", "b/broken.yaml"}, nil),
+		listFactory.EXPECT().Create([]string{"a/web.yaml", "a/config.yaml", "b/broken.yaml"}).Times(1).Return([]string{"a/web.yaml", "a/config.yaml", "b/broken.yaml"}, []string{}, []string{}, nil),
+		clock.EXPECT().Now().Times(1).Return(time.Unix(1, 0)),
+		kubeClient.EXPECT().Diff("a/web.yaml").Times(1).Return("diff", testDiff, nil),
+		kubeClient.EXPECT().Diff("a/config.yaml").Times(1).Return("diff", "", nil),
+		kubeClient.EXPECT().Diff("b/broken.yaml").Times(1).Return("diff", "forbidden", fmt.Errorf("Error: exit status 2")),
+	)
+	report, err := d.Report("")
+	assert.Nil(err)
+	assert.Equal("hash", report.Commit)
+	assert.Equal(time.Unix(1, 0), report.Generated)
+	assert.Equal(3, report.Checked)
+	assert.Equal(2, len(report.Files))
+	assert.Equal("a/web.yaml", report.Files[0].FilePath)
+	assert.Equal([]string{"team-a"}, report.Files[0].Namespaces)
+	assert.Equal(parseDiff(testDiff), report.Files[0].Objects)
+	assert.Equal(FileDrift{"b/broken.yaml", []string{"team-b"}, []ObjectDrift{}, "Error: exit status 2"}, report.Files[1])
+
+	// The cached report is filtered by namespace until it expires.
+	clock.EXPECT().Now().Times(1).Return(time.Unix(60, 0))
+	report, err = d.Report("team-a")
+	assert.Nil(err)
+	assert.Equal(2, report.Checked)
+	assert.Equal(1, len(report.Files))
+	assert.Equal("a/web.yaml", report.Files[0].FilePath)
+
+	clock.EXPECT().Now().Times(1).Return(time.Unix(61, 0))
+	gitUtil.EXPECT().HeadHash().Times(1).Return("", fmt.Errorf("git error"))
+	report, err = d.Report("team-c")
+	assert.Nil(report)
+	assert.EqualError(err, "git error")
+}
+
+func TestDriftDetectorReportFiles(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	dir := writeManifests(t, map[string]string{
+		"web.yaml": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  namespace: team-a
+spec:
+  template:
+    metadata:
+      namespace: ignored
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+  namespace: team-b
+`,
+		"crd.yaml": `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+  annotations:
+    description: |
+      namespace: ignored
+`,
+	})
+	defer os.RemoveAll(dir)
+	web, crd := filepath.Join(dir, "web.yaml"), filepath.Join(dir, "crd.yaml")
+
+	kubeClient := kube.NewMockClientInterface(mockCtrl)
+	listFactory := applylist.NewMockFactoryInterface(mockCtrl)
+	gitUtil := git.NewMockGitUtilInterface(mockCtrl)
+	clock := sysutil.NewMockClockInterface(mockCtrl)
+	d := &DriftDetector{KubeClient: kubeClient, ListFactory: listFactory, GitUtil: gitUtil, FileSystem: &sysutil.FileSystem{}, Clock: clock, TTL: time.Minute}
+
+	gitUtil.EXPECT().HeadHash().Times(1).Return("hash", nil)
+	gitUtil.EXPECT().ListAllFiles().Times(1).Return([]string{web, crd}, nil)
+	listFactory.EXPECT().Create([]string{web, crd}).Times(1).Return([]string{web, crd}, []string{}, []string{}, nil)
+	clock.EXPECT().Now().Times(1).Return(time.Unix(1, 0))
+	kubeClient.EXPECT().Diff(web).Times(1).Return("diff", testDiff, nil)
+	kubeClient.EXPECT().Diff(crd).Times(1).Return("diff", testDiff, nil)
+	report, err := d.Report("team-b")
+	assert.Nil(err)
+	assert.Equal(1, report.Checked)
+	assert.Equal(1, len(report.Files))
+	assert.Equal(web, report.Files[0].FilePath)
+	assert.Equal([]string{"team-a", "team-b"}, report.Files[0].Namespaces)
+}
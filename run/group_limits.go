@@ -0,0 +1,66 @@
+package run
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// GroupLimits limits how many runs may apply objects of an API group at the same time, e.g. so that CRDs or admission webhooks
+// are never applied by a quick run and a full run at once. A run holds a slot of every limited group that its files define
+// objects of until it has applied all of them; runs that apply no limited group are never held back.
+type GroupLimits struct {
+	slots map[string]chan struct{}
+}
+
+// ParseGroupLimits parses limits in the format "<group>=<limit>", e.g. "apiextensions.k8s.io=1". The core group is named "core".
+func ParseGroupLimits(specs []string) (*GroupLimits, error) {
+	l := &GroupLimits{slots: map[string]chan struct{}{}}
+	for _, spec := range specs {
+		parts := strings.Split(spec, "=")
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("Invalid group limit %q, must be in the format \"<group>=<limit>\"", spec)
+		}
+		limit, err := strconv.Atoi(parts[1])
+		if err != nil || limit < 1 {
+			return nil, fmt.Errorf("Invalid group limit %q, limit must be a positive integer", spec)
+		}
+		l.slots[parts[0]] = make(chan struct{}, limit)
+	}
+	return l, nil
+}
+
+// Acquire waits for a slot of every limited group in groups, labeling logs with the run ID, and returns a function that
+// releases them. Slots are taken in order of group name, so that runs waiting for the same groups cannot deadlock.
+func (l *GroupLimits) Acquire(id int, groups []string) (release func()) {
+	limited := []string{}
+	for group := range stringSet(groups) {
+		if _, ok := l.slots[group]; ok {
+			limited = append(limited, group)
+		}
+	}
+	sort.Strings(limited)
+	for _, group := range limited {
+		select {
+		case l.slots[group] <- struct{}{}:
+		default:
+			log.Printf("RUN %v: Waiting for other runs to finish applying API group %v", id, group)
+			l.slots[group] <- struct{}{}
+		}
+	}
+	return func() {
+		for _, group := range limited {
+			<-l.slots[group]
+		}
+	}
+}
+
+// apiGroup returns the group of an apiVersion, e.g. "apps" for "apps/v1" and "core" for "v1".
+func apiGroup(apiVersion string) string {
+	if i := strings.Index(apiVersion, "/"); i >= 0 {
+		return apiVersion[:i]
+	}
+	return "core"
+}
@@ -0,0 +1,67 @@
+package run
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestParseGroupLimits(t *testing.T) {
+	assert := assert.New(t)
+
+	l, err := ParseGroupLimits([]string{"apiextensions.k8s.io=1", "core=2"})
+	assert.Nil(err)
+	assert.Equal(2, len(l.slots))
+	assert.Equal(1, cap(l.slots["apiextensions.k8s.io"]))
+	assert.Equal(2, cap(l.slots["core"]))
+
+	_, err = ParseGroupLimits([]string{"apiextensions.k8s.io"})
+	assert.EqualError(err, "Invalid group limit \"apiextensions.k8s.io\", must be in the format \"<group>=<limit>\"")
+	_, err = ParseGroupLimits([]string{"=1"})
+	assert.EqualError(err, "Invalid group limit \"=1\", must be in the format \"<group>=<limit>\"")
+	_, err = ParseGroupLimits([]string{"apps=0"})
+	assert.EqualError(err, "Invalid group limit \"apps=0\", limit must be a positive integer")
+	_, err = ParseGroupLimits([]string{"apps=one"})
+	assert.EqualError(err, "Invalid group limit \"apps=one\", limit must be a positive integer")
+}
+
+func TestGroupLimitsAcquire(t *testing.T) {
+	assert := assert.New(t)
+
+	l, _ := ParseGroupLimits([]string{"apiextensions.k8s.io=1", "apps=2"})
+	// Groups are only counted once per run, and unlimited groups are ignored.
+	release := l.Acquire(0, []string{"apiextensions.k8s.io", "apps", "apiextensions.k8s.io", "core"})
+	assert.Equal(1, len(l.slots["apiextensions.k8s.io"]))
+	assert.Equal(1, len(l.slots["apps"]))
+
+	// A run for an unlimited group or a group with free slots is not held back.
+	l.Acquire(1, []string{"core"})()
+	l.Acquire(1, []string{"apps"})()
+
+	acquired := make(chan struct{})
+	go func() {
+		l.Acquire(2, []string{"apiextensions.k8s.io"})()
+		close(acquired)
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("Acquired a slot of a group at its limit")
+	case <-time.After(50 * time.Millisecond):
+	}
+	release()
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("Slot was not released")
+	}
+	assert.Equal(0, len(l.slots["apiextensions.k8s.io"]))
+	assert.Equal(0, len(l.slots["apps"]))
+}
+
+func TestAPIGroup(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("apps", apiGroup("apps/v1"))
+	assert.Equal("apiextensions.k8s.io", apiGroup("apiextensions.k8s.io/v1"))
+	assert.Equal("core", apiGroup("v1"))
+	assert.Equal("core", apiGroup(""))
+}
@@ -0,0 +1,72 @@
+package run
+
+import (
+	"fmt"
+	"github.com/box/kube-applier/sysutil"
+)
+
+// GuardrailsInterface allows for mocking out the functionality of Guardrails when testing the full process of an apply run.
+type GuardrailsInterface interface {
+	Check([]string) (violations []ApplyAttempt)
+}
+
+// Guardrails enforces operator-configured limits on the files of a run before they are applied.
+// MaxResources limits the total number of resources in a single run (0 means no limit).
+// ForbiddenKinds lists resource kinds that kube-applier must never apply.
+// AllowedNamespaces, if set, lists the only namespaces that resources may set in their metadata. Resources without a namespace
+// are either cluster-scoped or applied to kubectl's default namespace, so cluster-scoped kinds should be restricted with ForbiddenKinds.
+type Guardrails struct {
+	MaxResources      int
+	ForbiddenKinds    []string
+	AllowedNamespaces []string
+	FileSystem        sysutil.FileSystemInterface
+}
+
+// Check reads every file in the apply list and returns an ApplyAttempt for each file that violates the guardrails.
+// If the run exceeds MaxResources, every file in the apply list is returned as a violation.
+// Files that cannot be read or parsed are violations too, since the guardrails cannot tell what they would apply.
+func (g *Guardrails) Check(applyList []string) (violations []ApplyAttempt) {
+	violations = []ApplyAttempt{}
+	if g.MaxResources <= 0 && len(g.ForbiddenKinds) == 0 && len(g.AllowedNamespaces) == 0 {
+		return violations
+	}
+
+	forbidden := stringSet(g.ForbiddenKinds)
+	allowedNamespaces := stringSet(g.AllowedNamespaces)
+	total := 0
+	for _, path := range applyList {
+		resources, err := readResources(g.FileSystem, path)
+		if err != nil {
+			violations = append(violations, ApplyAttempt{path, "", "", fmt.Sprintf("Error: guardrail violation: file could not be checked: %v", err)})
+			continue
+		}
+		total += len(resources)
+		for _, r := range resources {
+			if _, ok := forbidden[r.Kind]; ok {
+				violations = append(violations, ApplyAttempt{path, "", "", fmt.Sprintf("Error: guardrail violation: resources of kind %v may not be applied", r.Kind)})
+				break
+			}
+			if _, ok := allowedNamespaces[r.Metadata.Namespace]; len(allowedNamespaces) > 0 && r.Metadata.Namespace != "" && !ok {
+				violations = append(violations, ApplyAttempt{path, "", "", fmt.Sprintf("Error: guardrail violation: resources may not be applied to namespace %v", r.Metadata.Namespace)})
+				break
+			}
+		}
+	}
+
+	if g.MaxResources > 0 && total > g.MaxResources {
+		violations = []ApplyAttempt{}
+		for _, path := range applyList {
+			violations = append(violations, ApplyAttempt{path, "", "", fmt.Sprintf("Error: guardrail violation: run contains %v resources, exceeding the limit of %v", total, g.MaxResources)})
+		}
+	}
+	return violations
+}
+
+// stringSet creates a set with the slice's strings as keys.
+func stringSet(strings []string) map[string]struct{} {
+	m := make(map[string]struct{})
+	for _, s := range strings {
+		m[s] = struct{}{}
+	}
+	return m
+}
@@ -0,0 +1,154 @@
+package run
+
+import (
+	"github.com/box/kube-applier/sysutil"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeManifests writes each manifest to a file named by its key in a new temporary directory, and returns the directory.
+// The caller must remove it.
+func writeManifests(t *testing.T, manifests map[string]string) string {
+	dir, err := ioutil.TempDir("", "manifests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, manifest := range manifests {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(manifest), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+const (
+	guardrailsDeployment = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  namespace: web
+spec:
+  template:
+    metadata:
+      labels:
+        app: web
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+  namespace: web
+`
+	guardrailsBinding = `apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: admin
+  namespace: payments
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: admin
+  annotations:
+    description: |
+      Grants cluster-admin to the payments
+      service account.
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: cluster-admin
+`
+	guardrailsList = `apiVersion: v1
+kind: List
+items:
+  - apiVersion: v1
+    kind: Secret
+    metadata:
+      name: token
+      namespace: kube-system
+  - apiVersion: rbac.authorization.k8s.io/v1
+    kind: ClusterRoleBinding
+    metadata:
+      name: token
+`
+	guardrailsConfigMap = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+data:
+  mode: strict
+`
+)
+
+func TestGuardrailsCheck(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := writeManifests(t, map[string]string{
+		"web.yaml":     guardrailsDeployment,
+		"binding.yaml": guardrailsBinding,
+		"list.yaml":    guardrailsList,
+		"config.yaml":  guardrailsConfigMap,
+		"invalid.yaml": "kind: Deployment\nmetadata:\n  name: [web\n",
+	})
+	defer os.RemoveAll(dir)
+	web, binding, list, config := filepath.Join(dir, "web.yaml"), filepath.Join(dir, "binding.yaml"), filepath.Join(dir, "list.yaml"), filepath.Join(dir, "config.yaml")
+	invalid, missing := filepath.Join(dir, "invalid.yaml"), filepath.Join(dir, "missing.yaml")
+	fs := &sysutil.FileSystem{}
+
+	// No guardrails configured, files are not read
+	g := &Guardrails{FileSystem: fs}
+	assert.Equal([]ApplyAttempt{}, g.Check([]string{missing}))
+
+	// Forbidden kinds, including inside a List and a multi-document file with a block scalar
+	g = &Guardrails{ForbiddenKinds: []string{"ClusterRoleBinding"}, FileSystem: fs}
+	violations := g.Check([]string{web, binding, list, invalid, missing})
+	assert.Len(violations, 4)
+	assert.Equal(ApplyAttempt{binding, "", "", "Error: guardrail violation: resources of kind ClusterRoleBinding may not be applied"}, violations[0])
+	assert.Equal(ApplyAttempt{list, "", "", "Error: guardrail violation: resources of kind ClusterRoleBinding may not be applied"}, violations[1])
+
+	// Files that cannot be read or parsed are violations
+	assert.Equal(invalid, violations[2].FilePath)
+	assert.Contains(violations[2].ErrorMessage, "Error: guardrail violation: file could not be checked: yaml:")
+	assert.Equal(missing, violations[3].FilePath)
+	assert.Contains(violations[3].ErrorMessage, "Error: guardrail violation: file could not be checked: Error reading the file at "+missing)
+
+	// Within resource limit
+	g = &Guardrails{MaxResources: 3, FileSystem: fs}
+	assert.Equal([]ApplyAttempt{}, g.Check([]string{web, config}))
+
+	// Resource limit exceeded, every file is a violation
+	g = &Guardrails{MaxResources: 2, FileSystem: fs}
+	expected := []ApplyAttempt{
+		{web, "", "", "Error: guardrail violation: run contains 3 resources, exceeding the limit of 2"},
+		{config, "", "", "Error: guardrail violation: run contains 3 resources, exceeding the limit of 2"},
+	}
+	assert.Equal(expected, g.Check([]string{web, config}))
+}
+
+func TestGuardrailsCheckAllowedNamespaces(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := writeManifests(t, map[string]string{
+		"web.yaml":     guardrailsDeployment,
+		"binding.yaml": guardrailsBinding,
+		"list.yaml":    guardrailsList,
+		"config.yaml":  guardrailsConfigMap,
+	})
+	defer os.RemoveAll(dir)
+	web, binding, list, config := filepath.Join(dir, "web.yaml"), filepath.Join(dir, "binding.yaml"), filepath.Join(dir, "list.yaml"), filepath.Join(dir, "config.yaml")
+
+	// The namespace is read from the nested metadata, resources without a namespace are allowed
+	g := &Guardrails{AllowedNamespaces: []string{"web", "db"}, FileSystem: &sysutil.FileSystem{}}
+	expected := []ApplyAttempt{
+		{binding, "", "", "Error: guardrail violation: resources may not be applied to namespace payments"},
+		{list, "", "", "Error: guardrail violation: resources may not be applied to namespace kube-system"},
+	}
+	assert.Equal(expected, g.Check([]string{web, binding, list, config}))
+}
@@ -0,0 +1,68 @@
+package run
+
+import (
+	"sort"
+	"sync"
+)
+
+// flapTransitions is the number of changes between success and failure within a file's retained history at which the file is considered flapping.
+const flapTransitions = 3
+
+// FileHistory summarizes the retained apply outcomes of a single file.
+type FileHistory struct {
+	FilePath    string
+	SuccessRate float64
+	Flapping    bool
+}
+
+// History retains the outcomes of the most recent Size apply attempts of each file, so that flaky files can be detected across runs.
+// It is shared between the quick and full run loops.
+type History struct {
+	Size     int
+	mu       sync.Mutex
+	outcomes map[string][]bool
+}
+
+// Record adds the successes and failures of a run to the history and returns the updated summary of every file in the history, sorted by path.
+func (h *History) Record(successes, failures []ApplyAttempt) []FileHistory {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.outcomes == nil {
+		h.outcomes = make(map[string][]bool)
+	}
+	for _, a := range successes {
+		h.add(a.FilePath, true)
+	}
+	for _, a := range failures {
+		h.add(a.FilePath, false)
+	}
+
+	summary := []FileHistory{}
+	for path, outcomes := range h.outcomes {
+		succeeded, transitions := 0, 0
+		for i, success := range outcomes {
+			if success {
+				succeeded++
+			}
+			if i > 0 && success != outcomes[i-1] {
+				transitions++
+			}
+		}
+		summary = append(summary, FileHistory{
+			FilePath:    path,
+			SuccessRate: float64(succeeded) / float64(len(outcomes)),
+			Flapping:    transitions >= flapTransitions,
+		})
+	}
+	sort.Slice(summary, func(i, j int) bool { return summary[i].FilePath < summary[j].FilePath })
+	return summary
+}
+
+// add appends an outcome for the file, dropping the oldest outcome once Size outcomes are retained.
+func (h *History) add(path string, success bool) {
+	outcomes := append(h.outcomes[path], success)
+	if len(outcomes) > h.Size {
+		outcomes = outcomes[len(outcomes)-h.Size:]
+	}
+	h.outcomes[path] = outcomes
+}
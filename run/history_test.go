@@ -0,0 +1,39 @@
+package run
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestHistoryRecord(t *testing.T) {
+	assert := assert.New(t)
+	h := &History{Size: 4}
+
+	assert.Equal([]FileHistory{}, h.Record(nil, nil))
+
+	file1 := []ApplyAttempt{{FilePath: "file1"}}
+	file2 := []ApplyAttempt{{FilePath: "file2"}}
+
+	// file1 alternates between success and failure, file2 always fails
+	h.Record(file1, file2)
+	h.Record(nil, append(file1, file2...))
+	summary := h.Record(file1, nil)
+	assert.Equal([]FileHistory{
+		{FilePath: "file1", SuccessRate: 2.0 / 3.0, Flapping: false},
+		{FilePath: "file2", SuccessRate: 0, Flapping: false},
+	}, summary)
+
+	// Third transition marks file1 as flapping
+	summary = h.Record(nil, file1)
+	assert.Equal(FileHistory{FilePath: "file1", SuccessRate: 0.5, Flapping: true}, summary[0])
+
+	// Only the last 4 outcomes are retained, leaving F S F S for file1
+	summary = h.Record(file1, nil)
+	assert.Equal(FileHistory{FilePath: "file1", SuccessRate: 0.5, Flapping: true}, summary[0])
+
+	// Two more successes leave F S S S, which is no longer flapping
+	h.Record(file1, nil)
+	summary = h.Record(file1, nil)
+	assert.Equal(FileHistory{FilePath: "file1", SuccessRate: 0.75, Flapping: false}, summary[0])
+	assert.Equal(FileHistory{FilePath: "file2", SuccessRate: 0, Flapping: false}, summary[1])
+}
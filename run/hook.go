@@ -0,0 +1,74 @@
+package run
+
+import (
+	"fmt"
+	"github.com/box/kube-applier/sysutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// HookInterface allows for mocking out the functionality of Hook when testing the full process of an apply run.
+type HookInterface interface {
+	Run(id int, hash string) ApplyAttempt
+}
+
+// Hook runs an executable from the repo as part of every apply run.
+// Path is relative to RepoPath, and the executable runs with RepoPath as its working directory.
+// The executable does not inherit kube-applier's environment: it only receives PATH, plus the run ID and commit hash
+// in KUBE_APPLIER_RUN_ID and KUBE_APPLIER_COMMIT_HASH.
+// If Timeout is set, the executable and any processes it started are killed once it expires.
+// If MaxOutputBytes is set, at most that many bytes of the hook's output are kept.
+type Hook struct {
+	RepoPath       string
+	Path           string
+	Timeout        time.Duration
+	MaxOutputBytes int
+}
+
+// Run executes the hook for the run with the given ID and commit hash, labeling logs with the run ID.
+// It returns an ApplyAttempt with the hook's output, with ErrorMessage set if the hook failed or timed out.
+func (h *Hook) Run(id int, hash string) ApplyAttempt {
+	path := filepath.Join(h.RepoPath, h.Path)
+	output := &sysutil.BoundedBuffer{Max: h.MaxOutputBytes}
+	cmd := exec.Command(path)
+	cmd.Dir = h.RepoPath
+	cmd.Env = []string{
+		"PATH=" + os.Getenv("PATH"),
+		fmt.Sprintf("KUBE_APPLIER_RUN_ID=%d", id),
+		"KUBE_APPLIER_COMMIT_HASH=" + hash,
+	}
+	cmd.Stdout = output
+	cmd.Stderr = output
+	// Run the hook in its own process group, so that a timeout also kills the processes it started.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	log.Printf("RUN %v: Running hook %v", id, path)
+	attempt := ApplyAttempt{path, path, "", ""}
+	if err := cmd.Start(); err != nil {
+		attempt.ErrorMessage = fmt.Sprintf("Error: %v", err)
+		log.Printf("RUN %v: Hook %v failed to start: %v", id, path, attempt.ErrorMessage)
+		return attempt
+	}
+	var timer *time.Timer
+	if h.Timeout > 0 {
+		timer = time.AfterFunc(h.Timeout, func() {
+			syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		})
+	}
+	err := cmd.Wait()
+	attempt.Output = output.String()
+	// The timer can only be stopped if it has not fired yet.
+	if timer != nil && !timer.Stop() {
+		attempt.ErrorMessage = fmt.Sprintf("Error: hook timed out after %v", h.Timeout)
+	} else if err != nil {
+		attempt.ErrorMessage = fmt.Sprintf("Error: %v", err)
+	}
+	if attempt.ErrorMessage != "" {
+		log.Printf("RUN %v: Hook %v failed:\n%v\n%v", id, path, attempt.Output, attempt.ErrorMessage)
+	}
+	return attempt
+}
@@ -0,0 +1,45 @@
+package run
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHookRun(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "hook")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	writeScript := func(name, script string) {
+		assert.Nil(ioutil.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+script), 0755))
+	}
+
+	// The hook runs in the repo with a restricted environment
+	os.Setenv("KUBE_APPLIER_HOOK_TEST_SECRET", "secret")
+	defer os.Unsetenv("KUBE_APPLIER_HOOK_TEST_SECRET")
+	writeScript("env.sh", "pwd\necho $KUBE_APPLIER_RUN_ID $KUBE_APPLIER_COMMIT_HASH $KUBE_APPLIER_HOOK_TEST_SECRET\n")
+	h := &Hook{RepoPath: dir, Path: "env.sh"}
+	path := filepath.Join(dir, "env.sh")
+	realDir, _ := filepath.EvalSymlinks(dir)
+	assert.Equal(ApplyAttempt{path, path, realDir + "\n3 hash\n", ""}, h.Run(3, "hash"))
+
+	// Non-zero exit code
+	writeScript("fail.sh", "echo failing\nexit 2\n")
+	h = &Hook{RepoPath: dir, Path: "fail.sh"}
+	path = filepath.Join(dir, "fail.sh")
+	assert.Equal(ApplyAttempt{path, path, "failing\n", "Error: exit status 2"}, h.Run(0, "hash"))
+
+	// Timeout
+	writeScript("slow.sh", "sleep 5\n")
+	h = &Hook{RepoPath: dir, Path: "slow.sh", Timeout: 100 * time.Millisecond}
+	assert.Equal("Error: hook timed out after 100ms", h.Run(0, "hash").ErrorMessage)
+
+	// Missing executable
+	h = &Hook{RepoPath: dir, Path: "missing.sh"}
+	assert.NotEqual("", h.Run(0, "hash").ErrorMessage)
+}
@@ -0,0 +1,131 @@
+package run
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/box/kube-applier/sysutil"
+	"gopkg.in/yaml.v2"
+	"io"
+	"sort"
+	"strings"
+)
+
+// resource holds the fields of a manifest that kube-applier inspects around applying it.
+type resource struct {
+	APIVersion string `yaml:"apiVersion"`
+	Kind       string `yaml:"kind"`
+	Metadata   struct {
+		Name        string            `yaml:"name"`
+		Namespace   string            `yaml:"namespace"`
+		Annotations map[string]string `yaml:"annotations"`
+	} `yaml:"metadata"`
+	Items []resource `yaml:"items"`
+}
+
+// readKinds returns the kind of every resource defined in the file located at path, expanding List resources.
+func readKinds(fs sysutil.FileSystemInterface, path string) ([]string, error) {
+	resources, err := readResources(fs, path)
+	if err != nil {
+		return nil, err
+	}
+	kinds := []string{}
+	for _, r := range resources {
+		kinds = append(kinds, r.Kind)
+	}
+	return kinds, nil
+}
+
+// countManagedResources counts the resources defined in the files of the apply attempts by namespace and kind, sorted by
+// namespace and kind. Files that cannot be parsed are not counted.
+func countManagedResources(fs sysutil.FileSystemInterface, attempts []ApplyAttempt) []ResourceCount {
+	counts := map[ResourceCount]int{}
+	for _, a := range attempts {
+		resources, _ := readResources(fs, a.FilePath)
+		for _, r := range resources {
+			counts[ResourceCount{Namespace: r.Metadata.Namespace, Kind: r.Kind}]++
+		}
+	}
+	managed := []ResourceCount{}
+	for c, n := range counts {
+		c.Count = n
+		managed = append(managed, c)
+	}
+	sort.Slice(managed, func(i, j int) bool {
+		if managed[i].Namespace != managed[j].Namespace {
+			return managed[i].Namespace < managed[j].Namespace
+		}
+		return managed[i].Kind < managed[j].Kind
+	})
+	return managed
+}
+
+// readResources returns every resource defined in the file located at path, expanding List resources.
+// The file is parsed as it is, since trimmed lines lose the nesting of the YAML.
+func readResources(fs sysutil.FileSystemInterface, path string) ([]resource, error) {
+	content, err := fs.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	resources := []resource{}
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	for {
+		var r resource
+		if err := decoder.Decode(&r); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if r.Kind == "" {
+			continue
+		}
+		if strings.HasSuffix(r.Kind, "List") {
+			resources = append(resources, r.Items...)
+			continue
+		}
+		resources = append(resources, r)
+	}
+	return resources, nil
+}
+
+// readDocuments returns every YAML document in the file located at path, with maps converted so that they can be encoded as JSON.
+// Empty documents are skipped. The file is parsed as it is, so that nested fields reach the policy, and an error is returned if
+// any document cannot be parsed, so that the file is denied rather than checked in part.
+func readDocuments(fs sysutil.FileSystemInterface, path string) ([]interface{}, error) {
+	content, err := fs.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	documents := []interface{}{}
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	for {
+		var document interface{}
+		if err := decoder.Decode(&document); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if document != nil {
+			documents = append(documents, jsonCompatible(document))
+		}
+	}
+	return documents, nil
+}
+
+// jsonCompatible converts the map[interface{}]interface{} values decoded by yaml.v2 to map[string]interface{}, recursively.
+func jsonCompatible(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			m[fmt.Sprint(key)] = jsonCompatible(value)
+		}
+		return m
+	case []interface{}:
+		for i, value := range v {
+			v[i] = jsonCompatible(value)
+		}
+		return v
+	default:
+		return v
+	}
+}
@@ -0,0 +1,69 @@
+package run
+
+import (
+	"github.com/box/kube-applier/sysutil"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCountManagedResources(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := writeManifests(t, map[string]string{
+		"a/web.yaml": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  namespace: team-a
+  labels:
+    app: web
+spec:
+  template:
+    metadata:
+      namespace: ignored
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+  namespace: team-a
+`,
+		"b/list.yaml": `apiVersion: v1
+kind: List
+items:
+  - apiVersion: v1
+    kind: ConfigMap
+    metadata:
+      name: config
+      namespace: team-b
+      annotations:
+        description: |
+          namespace: ignored
+  - apiVersion: v1
+    kind: ConfigMap
+    metadata:
+      name: other
+      namespace: team-b
+`,
+		"cluster/namespace.yaml": `apiVersion: v1
+kind: Namespace
+metadata:
+  name: team-a
+`,
+		"invalid.yaml": "kind: [Deployment\n",
+	})
+	defer os.RemoveAll(dir)
+
+	attempts := []ApplyAttempt{}
+	for _, name := range []string{"a/web.yaml", "b/list.yaml", "cluster/namespace.yaml", "invalid.yaml", "missing.yaml"} {
+		attempts = append(attempts, ApplyAttempt{FilePath: filepath.Join(dir, name)})
+	}
+	assert.Equal([]ResourceCount{
+		{Namespace: "", Kind: "Namespace", Count: 1},
+		{Namespace: "team-a", Kind: "Deployment", Count: 1},
+		{Namespace: "team-a", Kind: "Service", Count: 1},
+		{Namespace: "team-b", Kind: "ConfigMap", Count: 2},
+	}, countManagedResources(&sysutil.FileSystem{}, attempts))
+}
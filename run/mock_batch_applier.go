@@ -42,3 +42,50 @@ func (_m *MockBatchApplierInterface) Apply(_param0 int, _param1 []string) ([]App
 func (_mr *MockBatchApplierInterfaceMockRecorder) Apply(arg0, arg1 interface{}) *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "Apply", arg0, arg1)
 }
+
+// CheckRollouts mocks base method
+func (_m *MockBatchApplierInterface) CheckRollouts(_param0 int, _param1 []ApplyAttempt) []ApplyAttempt {
+	ret := _m.ctrl.Call(_m, "CheckRollouts", _param0, _param1)
+	ret0, _ := ret[0].([]ApplyAttempt)
+	return ret0
+}
+
+// CheckRollouts indicates an expected call of CheckRollouts
+func (_mr *MockBatchApplierInterfaceMockRecorder) CheckRollouts(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "CheckRollouts", arg0, arg1)
+}
+
+// DryRun mocks base method
+func (_m *MockBatchApplierInterface) DryRun(_param0 int, _param1 []string) ([]ApplyAttempt, []ApplyAttempt) {
+	ret := _m.ctrl.Call(_m, "DryRun", _param0, _param1)
+	ret0, _ := ret[0].([]ApplyAttempt)
+	ret1, _ := ret[1].([]ApplyAttempt)
+	return ret0, ret1
+}
+
+// DryRun indicates an expected call of DryRun
+func (_mr *MockBatchApplierInterfaceMockRecorder) DryRun(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "DryRun", arg0, arg1)
+}
+
+// Label mocks base method
+func (_m *MockBatchApplierInterface) Label(_param0 int, _param1 []ApplyAttempt, _param2 map[string]string) {
+	_m.ctrl.Call(_m, "Label", _param0, _param1, _param2)
+}
+
+// Label indicates an expected call of Label
+func (_mr *MockBatchApplierInterfaceMockRecorder) Label(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Label", arg0, arg1, arg2)
+}
+
+// Validate mocks base method
+func (_m *MockBatchApplierInterface) Validate(_param0 int, _param1 []string) []ApplyAttempt {
+	ret := _m.ctrl.Call(_m, "Validate", _param0, _param1)
+	ret0, _ := ret[0].([]ApplyAttempt)
+	return ret0
+}
+
+// Validate indicates an expected call of Validate
+func (_mr *MockBatchApplierInterfaceMockRecorder) Validate(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Validate", arg0, arg1)
+}
@@ -0,0 +1,81 @@
+package run
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/box/kube-applier/sysutil"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// PolicyInterface allows for mocking out the functionality of Policy when testing the full process of an apply run.
+type PolicyInterface interface {
+	Check(int, []string) (violations []ApplyAttempt)
+}
+
+// Policy checks the files of a run against the policies of an Open Policy Agent server (https://www.openpolicyagent.org)
+// before they are applied, so that policy failures show up in the run rather than as rejections by an admission webhook.
+// URL is the Data API endpoint of a rule that evaluates to a list of violation messages, e.g. "http://opa:8181/v1/data/kubeapplier/deny".
+type Policy struct {
+	URL        string
+	Client     *http.Client
+	FileSystem sysutil.FileSystemInterface
+}
+
+// policyInput is the input document evaluated for each file.
+type policyInput struct {
+	File      string        `json:"file"`
+	Resources []interface{} `json:"resources"`
+}
+
+// Check evaluates the policy for every file in the apply list, and returns an ApplyAttempt for each file that violates it.
+// Files that cannot be checked, because they cannot be parsed or the server cannot be reached, are also returned, so that
+// nothing is applied unchecked.
+func (p *Policy) Check(id int, applyList []string) (violations []ApplyAttempt) {
+	violations = []ApplyAttempt{}
+	for _, path := range applyList {
+		messages, err := p.evaluate(path)
+		if err != nil {
+			log.Printf("RUN %v: Error checking policy for %v: %v", id, path, err)
+			violations = append(violations, ApplyAttempt{path, "", "", fmt.Sprintf("Error: policy check failed: %v", err)})
+			continue
+		}
+		if len(messages) > 0 {
+			log.Printf("RUN %v: %v violates policy: %v", id, path, strings.Join(messages, "; "))
+			violations = append(violations, ApplyAttempt{path, "", "", fmt.Sprintf("Error: policy violation: %v", strings.Join(messages, "; "))})
+		}
+	}
+	return violations
+}
+
+// evaluate queries the policy for the file located at path and returns its violation messages.
+func (p *Policy) evaluate(path string) ([]string, error) {
+	resources, err := readDocuments(p.FileSystem, path)
+	if err != nil {
+		return nil, err
+	}
+	body, err := json.Marshal(struct {
+		Input policyInput `json:"input"`
+	}{policyInput{path, resources}})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.Client.Post(p.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("policy server returned %v", resp.Status)
+	}
+	// The result is missing if the rule is undefined, e.g. because no violation matched.
+	var data struct {
+		Result []string `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, fmt.Errorf("Error decoding policy result: %v", err)
+	}
+	return data.Result, nil
+}
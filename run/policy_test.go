@@ -0,0 +1,141 @@
+package run
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/box/kube-applier/sysutil"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPolicyCheck(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	// Deny every Service, and fail for file4
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Input struct {
+				File      string                   `json:"file"`
+				Resources []map[string]interface{} `json:"resources"`
+			} `json:"input"`
+		}
+		assert.Nil(json.NewDecoder(r.Body).Decode(&body))
+		if body.Input.File == "file4" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		deny := []string{}
+		for _, resource := range body.Input.Resources {
+			if resource["kind"] == "Service" {
+				metadata := resource["metadata"].(map[string]interface{})
+				deny = append(deny, fmt.Sprintf("Service %v is not allowed", metadata["name"]))
+			}
+		}
+		if len(deny) == 0 {
+			w.Write([]byte("{}"))
+			return
+		}
+		json.NewEncoder(w).Encode(map[string][]string{"result": deny})
+	}))
+	defer server.Close()
+
+	fs := sysutil.NewMockFileSystemInterface(mockCtrl)
+	p := &Policy{URL: server.URL, Client: server.Client(), FileSystem: fs}
+	gomock.InOrder(
+		fs.EXPECT().ReadFile("file1").Times(1).Return([]byte(`kind: Deployment
+metadata:
+  name: web
+`), nil),
+		fs.EXPECT().ReadFile("file2").Times(1).Return([]byte(`kind: Service
+metadata:
+  name: web
+---
+kind: Service
+metadata:
+  name: db
+`), nil),
+		fs.EXPECT().ReadFile("file3").Times(1).Return(nil, fmt.Errorf("read error")),
+		fs.EXPECT().ReadFile("file4").Times(1).Return([]byte("kind: ConfigMap\n"), nil),
+	)
+	expected := []ApplyAttempt{
+		{"file2", "", "", "Error: policy violation: Service web is not allowed; Service db is not allowed"},
+		{"file3", "", "", "Error: policy check failed: read error"},
+		{"file4", "", "", "Error: policy check failed: policy server returned 500 Internal Server Error"},
+	}
+	assert.Equal(expected, p.Check(0, []string{"file1", "file2", "file3", "file4"}))
+}
+
+func TestPolicyCheckNestedFields(t *testing.T) {
+	assert := assert.New(t)
+
+	// Deny pod templates without a team label
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Input struct {
+				Resources []struct {
+					Kind string `json:"kind"`
+					Spec struct {
+						Template struct {
+							Metadata struct {
+								Labels map[string]string `json:"labels"`
+							} `json:"metadata"`
+						} `json:"template"`
+					} `json:"spec"`
+				} `json:"resources"`
+			} `json:"input"`
+		}
+		assert.Nil(json.NewDecoder(r.Body).Decode(&body))
+		deny := []string{}
+		for _, resource := range body.Input.Resources {
+			if resource.Kind == "Deployment" && resource.Spec.Template.Metadata.Labels["team"] == "" {
+				deny = append(deny, "pod templates must have a team label")
+			}
+		}
+		json.NewEncoder(w).Encode(map[string][]string{"result": deny})
+	}))
+	defer server.Close()
+
+	dir := writeManifests(t, map[string]string{
+		"labeled.yaml": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    metadata:
+      labels:
+        app: web
+        team: payments
+`,
+		"unlabeled.yaml": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: worker
+  labels:
+    team: payments
+spec:
+  template:
+    metadata:
+      labels:
+        app: worker
+`,
+		"invalid.yaml": "kind: Deployment\nmetadata:\n  name: [web\n",
+	})
+	defer os.RemoveAll(dir)
+	labeled, unlabeled, invalid := filepath.Join(dir, "labeled.yaml"), filepath.Join(dir, "unlabeled.yaml"), filepath.Join(dir, "invalid.yaml")
+
+	// Files that cannot be parsed are denied without asking the server
+	p := &Policy{URL: server.URL, Client: server.Client(), FileSystem: &sysutil.FileSystem{}}
+	violations := p.Check(0, []string{labeled, unlabeled, invalid})
+	assert.Len(violations, 2)
+	assert.Equal(ApplyAttempt{unlabeled, "", "", "Error: policy violation: pod templates must have a team label"}, violations[0])
+	assert.Equal(invalid, violations[1].FilePath)
+	assert.Contains(violations[1].ErrorMessage, "Error: policy check failed: yaml:")
+}
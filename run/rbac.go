@@ -0,0 +1,140 @@
+package run
+
+import (
+	"github.com/box/kube-applier/applylist"
+	"github.com/box/kube-applier/git"
+	"github.com/box/kube-applier/kube"
+	"github.com/box/kube-applier/sysutil"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// applyVerbs are the verbs kubectl apply needs for every object it applies.
+var applyVerbs = []string{"get", "create", "patch"}
+
+// RBACChecker periodically checks whether kube-applier is allowed to apply every kind of object in the repo, in every namespace
+// the objects are in, so that missing permissions show up before a run fails on them. Checks run "kubectl auth can-i" with the
+// same credentials as the runs.
+type RBACChecker struct {
+	KubeClient  kube.ClientInterface
+	ListFactory applylist.FactoryInterface
+	GitUtil     git.GitUtilInterface
+	FileSystem  sysutil.FileSystemInterface
+	Clock       sysutil.ClockInterface
+	Interval    time.Duration
+	mu          sync.Mutex
+	report      *RBACReport
+}
+
+// RBACReport lists the permissions kube-applier is missing to apply the objects in the repo.
+type RBACReport struct {
+	// Commit is the HEAD commit the files were read from.
+	Commit  string    `json:"commit"`
+	Checked time.Time `json:"checked"`
+	// Missing lists the permissions that are missing or could not be checked.
+	Missing []RBACGap `json:"missing"`
+}
+
+// RBACGap is a verb that kube-applier is not allowed to perform on a kind in a namespace, with the files that need it.
+// Namespace is empty for objects without a namespace, which are checked in the default namespace of kubectl's context,
+// or cluster-wide for cluster-scoped kinds.
+type RBACGap struct {
+	Verb      string   `json:"verb"`
+	Kind      string   `json:"kind"`
+	APIGroup  string   `json:"apiGroup"`
+	Namespace string   `json:"namespace"`
+	Files     []string `json:"files"`
+	// Error is set if the permission could not be checked.
+	Error string `json:"error,omitempty"`
+}
+
+// rbacTarget is a kind of object in a namespace that is applied by the repo.
+type rbacTarget struct {
+	kind, group, namespace string
+}
+
+// Start runs a continuous loop that checks the permissions every Interval.
+func (c *RBACChecker) Start() {
+	for {
+		c.check()
+		c.Clock.Sleep(c.Interval)
+	}
+}
+
+// Report returns the most recent report, or nil if no check has completed yet.
+func (c *RBACChecker) Report() *RBACReport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.report
+}
+
+// check computes a new report. If the files cannot be listed, the previous report is kept.
+func (c *RBACChecker) check() {
+	hash, err := c.GitUtil.HeadHash()
+	if err != nil {
+		log.Printf("Error checking RBAC permissions: %v", err)
+		return
+	}
+	rawList, err := c.GitUtil.ListAllFiles()
+	if err != nil {
+		log.Printf("Error checking RBAC permissions: %v", err)
+		return
+	}
+	applyList, _, _, err := c.ListFactory.Create(rawList)
+	if err != nil {
+		log.Printf("Error checking RBAC permissions: %v", err)
+		return
+	}
+
+	files := map[rbacTarget][]string{}
+	for _, path := range applyList {
+		resources, _ := readResources(c.FileSystem, path)
+		for _, r := range resources {
+			t := rbacTarget{r.Kind, apiGroup(r.APIVersion), r.Metadata.Namespace}
+			if n := len(files[t]); n == 0 || files[t][n-1] != path {
+				files[t] = append(files[t], path)
+			}
+		}
+	}
+	targets := []rbacTarget{}
+	for t := range files {
+		targets = append(targets, t)
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		a, b := targets[i], targets[j]
+		if a.namespace != b.namespace {
+			return a.namespace < b.namespace
+		}
+		if a.group != b.group {
+			return a.group < b.group
+		}
+		return a.kind < b.kind
+	})
+
+	report := &RBACReport{Commit: hash, Checked: c.Clock.Now(), Missing: []RBACGap{}}
+	for _, t := range targets {
+		resource := strings.ToLower(t.kind)
+		if t.group != "core" {
+			resource += "." + t.group
+		}
+		for _, verb := range applyVerbs {
+			allowed, err := c.KubeClient.CanI(verb, resource, t.namespace)
+			if allowed {
+				continue
+			}
+			gap := RBACGap{Verb: verb, Kind: t.kind, APIGroup: t.group, Namespace: t.namespace, Files: files[t]}
+			if err != nil {
+				gap.Error = err.Error()
+			}
+			report.Missing = append(report.Missing, gap)
+		}
+	}
+	log.Printf("Checked RBAC permissions for %v kinds at commit %v, %v missing", len(targets), hash, len(report.Missing))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.report = report
+}
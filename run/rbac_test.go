@@ -0,0 +1,118 @@
+package run
+
+import (
+	"fmt"
+	"github.com/box/kube-applier/applylist"
+	"github.com/box/kube-applier/git"
+	"github.com/box/kube-applier/kube"
+	"github.com/box/kube-applier/sysutil"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRBACCheckerCheck(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	kubeClient := kube.NewMockClientInterface(mockCtrl)
+	listFactory := applylist.NewMockFactoryInterface(mockCtrl)
+	gitUtil := git.NewMockGitUtilInterface(mockCtrl)
+	fs := sysutil.NewMockFileSystemInterface(mockCtrl)
+	clock := sysutil.NewMockClockInterface(mockCtrl)
+	c := &RBACChecker{KubeClient: kubeClient, ListFactory: listFactory, GitUtil: gitUtil, FileSystem: fs, Clock: clock}
+	assert.Nil(c.Report())
+
+	fs.EXPECT().ReadFile("a/web.yaml").Return([]byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  namespace: team-a
+---
+apiVersion: v1
+kind: Service
+metadata:
+  namespace: team-a
+`), nil).AnyTimes()
+	fs.EXPECT().ReadFile("a/worker.yaml").Return([]byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  namespace: team-a
+`), nil).AnyTimes()
+	fs.EXPECT().ReadFile("crd.yaml").Return([]byte(`apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+`), nil).AnyTimes()
+	gitUtil.EXPECT().HeadHash().Times(1).Return("hash", nil)
+	gitUtil.EXPECT().ListAllFiles().Times(1).Return([]string{"a/web.yaml", "a/worker.yaml", "crd.yaml"}, nil)
+	listFactory.EXPECT().Create([]string{"a/web.yaml", "a/worker.yaml", "crd.yaml"}).Times(1).Return([]string{"a/web.yaml", "a/worker.yaml", "crd.yaml"}, []string{}, []string{}, nil)
+	clock.EXPECT().Now().Times(1).Return(time.Unix(1, 0))
+	kubeClient.EXPECT().CanI(gomock.Any(), "customresourcedefinition.apiextensions.k8s.io", "").Times(3).Return(false, nil)
+	kubeClient.EXPECT().CanI(gomock.Any(), "deployment.apps", "team-a").Times(3).Return(true, nil)
+	kubeClient.EXPECT().CanI("get", "service", "team-a").Times(1).Return(true, nil)
+	kubeClient.EXPECT().CanI("create", "service", "team-a").Times(1).Return(false, fmt.Errorf("Error: exit status 2"))
+	kubeClient.EXPECT().CanI("patch", "service", "team-a").Times(1).Return(true, nil)
+	c.check()
+	assert.Equal(&RBACReport{"hash", time.Unix(1, 0), []RBACGap{
+		{"get", "CustomResourceDefinition", "apiextensions.k8s.io", "", []string{"crd.yaml"}, ""},
+		{"create", "CustomResourceDefinition", "apiextensions.k8s.io", "", []string{"crd.yaml"}, ""},
+		{"patch", "CustomResourceDefinition", "apiextensions.k8s.io", "", []string{"crd.yaml"}, ""},
+		{"create", "Service", "core", "team-a", []string{"a/web.yaml"}, "Error: exit status 2"},
+	}}, c.Report())
+
+	// The previous report is kept if the files cannot be listed.
+	gitUtil.EXPECT().HeadHash().Times(1).Return("", fmt.Errorf("git error"))
+	c.check()
+	assert.Equal("hash", c.Report().Commit)
+}
+
+func TestRBACCheckerCheckFiles(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	dir := writeManifests(t, map[string]string{
+		"web.yaml": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  namespace: team-a
+spec:
+  template:
+    metadata:
+      namespace: ignored
+---
+apiVersion: v1
+kind: List
+items:
+  - apiVersion: v1
+    kind: Secret
+    metadata:
+      name: web
+      namespace: team-b
+`,
+	})
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "web.yaml")
+
+	kubeClient := kube.NewMockClientInterface(mockCtrl)
+	listFactory := applylist.NewMockFactoryInterface(mockCtrl)
+	gitUtil := git.NewMockGitUtilInterface(mockCtrl)
+	clock := sysutil.NewMockClockInterface(mockCtrl)
+	c := &RBACChecker{KubeClient: kubeClient, ListFactory: listFactory, GitUtil: gitUtil, FileSystem: &sysutil.FileSystem{}, Clock: clock}
+
+	gitUtil.EXPECT().HeadHash().Times(1).Return("hash", nil)
+	gitUtil.EXPECT().ListAllFiles().Times(1).Return([]string{path}, nil)
+	listFactory.EXPECT().Create([]string{path}).Times(1).Return([]string{path}, []string{}, []string{}, nil)
+	clock.EXPECT().Now().Times(1).Return(time.Unix(1, 0))
+	kubeClient.EXPECT().CanI(gomock.Any(), "deployment.apps", "team-a").Times(3).Return(true, nil)
+	kubeClient.EXPECT().CanI(gomock.Any(), "secret", "team-b").Times(3).Return(false, nil)
+	c.check()
+	assert.Equal(&RBACReport{"hash", time.Unix(1, 0), []RBACGap{
+		{"get", "Secret", "core", "team-b", []string{path}, ""},
+		{"create", "Secret", "core", "team-b", []string{path}, ""},
+		{"patch", "Secret", "core", "team-b", []string{path}, ""},
+	}}, c.Report())
+}
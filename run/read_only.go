@@ -0,0 +1,24 @@
+package run
+
+import "sync"
+
+// ReadOnly is a switch that, while enabled, stops all applies without stopping the scheduler, status page or metrics.
+// It is shared between the runner, which checks it before applying, and the webserver, which allows toggling it.
+type ReadOnly struct {
+	mu      sync.RWMutex
+	enabled bool
+}
+
+// Enabled returns true if applies are currently disabled.
+func (r *ReadOnly) Enabled() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.enabled
+}
+
+// Set enables or disables read-only mode.
+func (r *ReadOnly) Set(enabled bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.enabled = enabled
+}
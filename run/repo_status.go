@@ -0,0 +1,56 @@
+package run
+
+import (
+	"sync"
+	"time"
+)
+
+// RepoStatus records what the scheduler last saw when polling the repo, so that external monitors can check that the
+// mirrored repo is up to date without access to the metrics.
+// It is shared between the scheduler, which records each poll, and the webserver, which serves it.
+type RepoStatus struct {
+	mu    sync.RWMutex
+	state RepoState
+}
+
+// RepoState is a snapshot of the RepoStatus.
+type RepoState struct {
+	// Commit is the HEAD commit of the repo as of the last successful poll.
+	Commit string `json:"commit"`
+	// CommitSeen is the time at which the scheduler first saw Commit, i.e. roughly when it was synced.
+	CommitSeen time.Time `json:"commitSeen"`
+	// LastPoll is the time of the last successful poll.
+	LastPoll time.Time `json:"lastPoll"`
+	// LastError is the error of the last poll, or empty if it succeeded.
+	LastError string `json:"lastError"`
+	// StaleSince is the time of the first of the consecutive failed polls up to the last poll, since which runs have applied Commit
+	// without knowing whether it is still HEAD. It is nil if the last poll succeeded.
+	StaleSince *time.Time `json:"staleSince,omitempty"`
+}
+
+// Record updates the status with the result of a poll at the given time.
+func (s *RepoStatus) Record(hash string, now time.Time, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.state.LastError = err.Error()
+		if s.state.StaleSince == nil {
+			s.state.StaleSince = &now
+		}
+		return
+	}
+	if hash != s.state.Commit {
+		s.state.Commit = hash
+		s.state.CommitSeen = now
+	}
+	s.state.LastPoll = now
+	s.state.LastError = ""
+	s.state.StaleSince = nil
+}
+
+// State returns a snapshot of the status.
+func (s *RepoStatus) State() RepoState {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.state
+}
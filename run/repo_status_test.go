@@ -0,0 +1,31 @@
+package run
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestRepoStatusRecord(t *testing.T) {
+	assert := assert.New(t)
+	s := &RepoStatus{}
+	assert.Equal(RepoState{}, s.State())
+
+	s.Record("hash0", time.Unix(10, 0), nil)
+	assert.Equal(RepoState{Commit: "hash0", CommitSeen: time.Unix(10, 0), LastPoll: time.Unix(10, 0)}, s.State())
+
+	// The commit is only seen once, until HEAD changes
+	s.Record("hash0", time.Unix(20, 0), nil)
+	assert.Equal(RepoState{Commit: "hash0", CommitSeen: time.Unix(10, 0), LastPoll: time.Unix(20, 0)}, s.State())
+
+	// A failed poll keeps the last successful state, which is stale from the first failure on
+	s.Record("", time.Unix(30, 0), fmt.Errorf("git error"))
+	stale := time.Unix(30, 0)
+	assert.Equal(RepoState{Commit: "hash0", CommitSeen: time.Unix(10, 0), LastPoll: time.Unix(20, 0), LastError: "git error", StaleSince: &stale}, s.State())
+	s.Record("", time.Unix(35, 0), fmt.Errorf("other error"))
+	assert.Equal(RepoState{Commit: "hash0", CommitSeen: time.Unix(10, 0), LastPoll: time.Unix(20, 0), LastError: "other error", StaleSince: &stale}, s.State())
+
+	s.Record("hash1", time.Unix(40, 0), nil)
+	assert.Equal(RepoState{Commit: "hash1", CommitSeen: time.Unix(40, 0), LastPoll: time.Unix(40, 0)}, s.State())
+}
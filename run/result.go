@@ -27,6 +27,109 @@ type Result struct {
 	Successes     []ApplyAttempt
 	Failures      []ApplyAttempt
 	DiffURLFormat string
+	// PreviousCommitHash is the commit applied by the previous quick run, which CommitHash was diffed against.
+	// It is only set for quick runs.
+	PreviousCommitHash string
+	// ChangedFiles lists up to maxChangedFiles of the files changed since PreviousCommitHash, i.e. the reason for a quick run.
+	// OmittedChangedFiles is the number of changed files left out of the list. Both are only set for quick runs.
+	ChangedFiles        []string
+	OmittedChangedFiles int
+	// ValidationFindings holds the files that failed schema validation, recorded separately from the apply output.
+	ValidationFindings []ApplyAttempt
+	// ResourceActions counts the resources kubectl reported for the applied files by namespace, kind and action. It is computed
+	// before the outputs are truncated, and is not set for runs that skipped applying and dry runs.
+	ResourceActions []ResourceActionCount
+	// IgnoredObjects is the number of objects that were left out of the apply because they are annotated with kube.IgnoreAnnotation.
+	IgnoredObjects int
+	// Skipped holds the files that were not applied because of a skip marker file in their directory or above it,
+	// with the path of the marker as their output. Skipped files are not failures.
+	Skipped []ApplyAttempt
+	// DiffStat summarizes the files changed between the previously applied commit and CommitHash.
+	// It is only set for successful quick runs.
+	DiffStat string
+	// RolloutChecks holds the post-apply rollout status checks for the applied workloads, if enabled.
+	// A check with a non-empty ErrorMessage did not complete its rollout in time.
+	RolloutChecks []ApplyAttempt
+	// ReadOnly is true if the run skipped applying because read-only mode was enabled.
+	ReadOnly bool
+	// Suspended is true if the run skipped applying because the circuit breaker was open after too many consecutive failed runs.
+	Suspended bool
+	// PendingApproval is true if the run skipped applying because the commit was not authored or committed by an allowed author.
+	PendingApproval bool
+	// OutsideApplyWindow is true if the run skipped applying because it started outside of the configured apply window.
+	OutsideApplyWindow bool
+	// DryRun is true if the files were only applied with a server-side dry run, as requested when the run was forced.
+	// Nothing was changed in the cluster.
+	DryRun bool
+	// ManagedResources counts the resources defined in the files that were applied successfully, by namespace and kind.
+	// It is only set for full runs, which apply every file in the repo, and only if the runner can read the files.
+	ManagedResources []ResourceCount
+	// FileHistory summarizes the retained outcomes of every file applied so far, if run history is enabled.
+	FileHistory []FileHistory
+	// Tombstones holds the files deleted from the repo within the tombstone TTL, if tombstones are enabled.
+	// It is nil for runs that skipped applying and dry runs.
+	Tombstones []Tombstone
+	// FailureRunbooks holds the runbooks of the failures that were recognized as a known class of failures, if runbooks are configured.
+	FailureRunbooks []FailureRunbook
+	// PreApplyHook holds the result of the pre-apply hook, if one is configured.
+	// If the hook failed, no files were applied and the hook is also listed in Failures.
+	PreApplyHook *ApplyAttempt
+	// PostApplyHook holds the result of the post-apply hook, if one is configured.
+	// If the hook failed, it is also listed in Failures.
+	PostApplyHook *ApplyAttempt
+	// Reason and CorrelationID are given by the client that forced the run, if any, to trace it back to what triggered it.
+	// They are set by the webserver.
+	Reason        string
+	CorrelationID string
+	// LastSuccessfulRun identifies the most recent run that succeeded, which may be this run.
+	// It is set by the webserver, and is nil until a run has succeeded.
+	LastSuccessfulRun *RunSummary
+}
+
+// ResourceCount is the number of resources of a kind in a namespace. Namespace is empty for resources without one.
+type ResourceCount struct {
+	Namespace string
+	Kind      string
+	Count     int
+}
+
+// RunOptions are one-shot overrides given for a forced run.
+type RunOptions struct {
+	// DryRun applies the files with "kubectl apply --dry-run=server", so that they are checked by the API server without
+	// changing anything.
+	DryRun bool `json:"dryRun,omitempty"`
+}
+
+// RunSummary identifies a completed run and the commit it applied.
+type RunSummary struct {
+	RunID      int
+	CommitHash string
+	Finish     time.Time
+}
+
+// FormattedFinish returns the Finish time in the format "YYYY-MM-DD hh:mm:ss -0000 GMT"
+func (s *RunSummary) FormattedFinish() string {
+	return s.Finish.Truncate(time.Second).String()
+}
+
+// Succeeded returns true if the run applied files without any failures.
+// Runs skipped in read-only mode, by the circuit breaker, pending approval or outside of the apply window did not apply anything
+// and are not considered successful, and neither are dry runs.
+func (r *Result) Succeeded() bool {
+	return len(r.Failures) == 0 && !r.ReadOnly && !r.Suspended && !r.PendingApproval && !r.OutsideApplyWindow && !r.DryRun
+}
+
+// Summary returns the RunSummary identifying this run.
+func (r *Result) Summary() *RunSummary {
+	return &RunSummary{RunID: r.RunID, CommitHash: r.CommitHash, Finish: r.Finish}
+}
+
+// In converts the Start, Finish and tombstone times to the given location, in which they are formatted for display.
+func (r *Result) In(loc *time.Location) {
+	r.Start, r.Finish = r.Start.In(loc), r.Finish.In(loc)
+	for i := range r.Tombstones {
+		r.Tombstones[i].Deleted = r.Tombstones[i].Deleted.In(loc)
+	}
 }
 
 // FormattedStart returns the Start time in the format "YYYY-MM-DD hh:mm:ss -0000 GMT"
@@ -59,9 +162,85 @@ func (r *Result) TotalFiles() int {
 }
 
 // LastCommitLink returns a URL for the most recent commit if the envar $DIFF_URL_FORMAT is specified, otherwise it returns empty string.
+// Instead of "%s", the format may use the "%{to}" and "%{from}" placeholders for the commit hash and the previous commit hash,
+// to link to a compare view of everything a quick run applied. A format using "%{from}" only gives a link for quick runs.
 func (r *Result) LastCommitLink() string {
-	if r.CommitHash == "" || r.DiffURLFormat == "" || !strings.Contains(r.DiffURLFormat, "%s") {
+	if r.CommitHash == "" || r.DiffURLFormat == "" {
 		return ""
 	}
-	return fmt.Sprintf(r.DiffURLFormat, r.CommitHash)
+	if strings.Contains(r.DiffURLFormat, "%s") {
+		return fmt.Sprintf(r.DiffURLFormat, r.CommitHash)
+	}
+	if !strings.Contains(r.DiffURLFormat, "%{to}") {
+		return ""
+	}
+	if strings.Contains(r.DiffURLFormat, "%{from}") && (r.PreviousCommitHash == "" || r.PreviousCommitHash == r.CommitHash) {
+		return ""
+	}
+	return strings.NewReplacer("%{from}", r.PreviousCommitHash, "%{to}", r.CommitHash).Replace(r.DiffURLFormat)
+}
+
+// FailedRolloutChecks returns the number of rollout checks that did not complete successfully.
+func (r *Result) FailedRolloutChecks() int {
+	failed := 0
+	for _, check := range r.RolloutChecks {
+		if check.ErrorMessage != "" {
+			failed++
+		}
+	}
+	return failed
+}
+
+// IsFlapping returns true if the file has been alternating between success and failure across recent runs.
+func (r *Result) IsFlapping(path string) bool {
+	for _, h := range r.FileHistory {
+		if h.FilePath == path {
+			return h.Flapping
+		}
+	}
+	return false
+}
+
+// Runbook returns the runbook for the failure of the file, or nil if there is none.
+func (r *Result) Runbook(path string) *FailureRunbook {
+	for i := range r.FailureRunbooks {
+		if r.FailureRunbooks[i].FilePath == path {
+			return &r.FailureRunbooks[i]
+		}
+	}
+	return nil
+}
+
+// TruncateOutputs limits the output of every apply attempt, validation finding, rollout check and hook to maxLines lines.
+// The first and last lines are kept, with a note of how many lines were omitted in between.
+// A maxLines of 0 or less disables truncation.
+func (r *Result) TruncateOutputs(maxLines int) {
+	if maxLines <= 0 {
+		return
+	}
+	for _, attempts := range [][]ApplyAttempt{r.Successes, r.Failures, r.ValidationFindings, r.RolloutChecks} {
+		for i := range attempts {
+			attempts[i].Output = truncateLines(attempts[i].Output, maxLines)
+		}
+	}
+	for _, hook := range []*ApplyAttempt{r.PreApplyHook, r.PostApplyHook} {
+		if hook != nil {
+			hook.Output = truncateLines(hook.Output, maxLines)
+		}
+	}
+}
+
+// truncateLines keeps the first and last lines of s so that at most maxLines lines remain, replacing the rest with a note.
+func truncateLines(s string, maxLines int) string {
+	lines := strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+	if len(lines) <= maxLines {
+		return s
+	}
+	head := (maxLines + 1) / 2
+	tail := maxLines - head
+	omitted := len(lines) - head - tail
+	truncated := append([]string{}, lines[:head]...)
+	truncated = append(truncated, fmt.Sprintf("... %d lines omitted ...", omitted))
+	truncated = append(truncated, lines[len(lines)-tail:]...)
+	return strings.Join(truncated, "\n") + "\n"
 }
@@ -69,34 +69,147 @@ func TestResultTotalFiles(t *testing.T) {
 }
 
 type lastCommitLinkTestCase struct {
-	DiffURLFormat string
-	CommitHash    string
-	ExpectedLink  string
+	DiffURLFormat      string
+	CommitHash         string
+	PreviousCommitHash string
+	ExpectedLink       string
 }
 
 var lastCommitLinkTestCases = []lastCommitLinkTestCase{
 	// All empty
-	{"", "", ""},
+	{"", "", "", ""},
 	// Empty URL, non-empty hash
-	{"", "hash", ""},
+	{"", "hash", "", ""},
 	// URL missing %s, empty hash
-	{"https://badurl.com/", "", ""},
+	{"https://badurl.com/", "", "", ""},
 	// URL missing %s, non-empty hash
-	{"https://badurl.com/", "hash", ""},
+	{"https://badurl.com/", "hash", "", ""},
 	// %s at end of URL, empty hash
-	{"https://goodurl.com/%s/", "", ""},
+	{"https://goodurl.com/%s/", "", "", ""},
 	// %s at end of URL, non-empty hash
-	{"https://goodurl.com/%s", "hash", "https://goodurl.com/hash"},
+	{"https://goodurl.com/%s", "hash", "", "https://goodurl.com/hash"},
 	// %s in middle of URL, empty hash
-	{"https://goodurl.com/commit/%s/show", "", ""},
+	{"https://goodurl.com/commit/%s/show", "", "", ""},
 	// %s in middle of URL, non-empty hash
-	{"https://goodurl.com/commit/%s/show", "hash", "https://goodurl.com/commit/hash/show"},
+	{"https://goodurl.com/commit/%s/show", "hash", "", "https://goodurl.com/commit/hash/show"},
+	// Compare URL, quick run
+	{"https://goodurl.com/compare/%{from}...%{to}", "hash", "prev", "https://goodurl.com/compare/prev...hash"},
+	// Compare URL, no previous commit
+	{"https://goodurl.com/compare/%{from}...%{to}", "hash", "", ""},
+	// Compare URL, previous commit is the same
+	{"https://goodurl.com/compare/%{from}...%{to}", "hash", "hash", ""},
+	// %{to} only
+	{"https://goodurl.com/tree/%{to}", "hash", "", "https://goodurl.com/tree/hash"},
+	// %{from} only
+	{"https://goodurl.com/tree/%{from}", "hash", "prev", ""},
+}
+
+func TestResultIn(t *testing.T) {
+	assert := assert.New(t)
+
+	location := time.FixedZone("CET", 3600)
+	r := Result{Start: time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC), Finish: time.Date(2018, 1, 2, 3, 5, 5, 0, time.UTC)}
+	r.In(location)
+	assert.Equal("2018-01-02 04:04:05 +0100 CET", r.FormattedStart())
+	assert.Equal("2018-01-02 04:05:05 +0100 CET", r.FormattedFinish())
 }
 
 func TestResultLastCommitLink(t *testing.T) {
 	assert := assert.New(t)
 	for _, tc := range lastCommitLinkTestCases {
-		r := Result{DiffURLFormat: tc.DiffURLFormat, CommitHash: tc.CommitHash}
+		r := Result{DiffURLFormat: tc.DiffURLFormat, CommitHash: tc.CommitHash, PreviousCommitHash: tc.PreviousCommitHash}
 		assert.Equal(tc.ExpectedLink, r.LastCommitLink())
 	}
 }
+
+func TestResultFailedRolloutChecks(t *testing.T) {
+	assert := assert.New(t)
+
+	r := Result{}
+	assert.Equal(0, r.FailedRolloutChecks())
+
+	r = Result{RolloutChecks: []ApplyAttempt{{FilePath: "file1"}, {FilePath: "file2", ErrorMessage: "error"}, {FilePath: "file3", ErrorMessage: "error"}}}
+	assert.Equal(2, r.FailedRolloutChecks())
+}
+
+func TestResultTruncateOutputs(t *testing.T) {
+	assert := assert.New(t)
+
+	output := "line1\nline2\nline3\nline4\nline5\n"
+	newResult := func() Result {
+		return Result{
+			Successes:          []ApplyAttempt{{FilePath: "file1", Output: output}, {FilePath: "file2", Output: "short\n"}},
+			Failures:           []ApplyAttempt{{FilePath: "file3", Output: output}},
+			ValidationFindings: []ApplyAttempt{{FilePath: "file4", Output: output}},
+			RolloutChecks:      []ApplyAttempt{{FilePath: "file5", Output: output}},
+			PreApplyHook:       &ApplyAttempt{FilePath: "hook", Output: output},
+			PostApplyHook:      &ApplyAttempt{FilePath: "hook", Output: output},
+		}
+	}
+
+	// Truncation disabled
+	r := newResult()
+	r.TruncateOutputs(0)
+	assert.Equal(newResult(), r)
+
+	// Output within limit
+	r = newResult()
+	r.TruncateOutputs(5)
+	assert.Equal(newResult(), r)
+
+	// Odd limit keeps the extra line at the head
+	r = newResult()
+	r.TruncateOutputs(3)
+	truncated := "line1\nline2\n... 2 lines omitted ...\nline5\n"
+	assert.Equal(truncated, r.Successes[0].Output)
+	assert.Equal("short\n", r.Successes[1].Output)
+	assert.Equal(truncated, r.Failures[0].Output)
+	assert.Equal(truncated, r.ValidationFindings[0].Output)
+	assert.Equal(truncated, r.RolloutChecks[0].Output)
+	assert.Equal(truncated, r.PreApplyHook.Output)
+	assert.Equal(truncated, r.PostApplyHook.Output)
+
+	// Single line keeps only the head
+	r = newResult()
+	r.TruncateOutputs(1)
+	assert.Equal("line1\n... 4 lines omitted ...\n", r.Successes[0].Output)
+}
+
+func TestResultIsFlapping(t *testing.T) {
+	assert := assert.New(t)
+
+	r := Result{}
+	assert.False(r.IsFlapping("file1"))
+
+	r = Result{FileHistory: []FileHistory{{FilePath: "file1", Flapping: true}, {FilePath: "file2", Flapping: false}}}
+	assert.True(r.IsFlapping("file1"))
+	assert.False(r.IsFlapping("file2"))
+	assert.False(r.IsFlapping("file3"))
+}
+
+func TestResultRunbook(t *testing.T) {
+	assert := assert.New(t)
+
+	r := Result{}
+	assert.Nil(r.Runbook("file1"))
+
+	r = Result{FailureRunbooks: []FailureRunbook{{"file1", "rbac-denied", Runbook{URL: "https://wiki/rbac"}}}}
+	assert.Equal(&r.FailureRunbooks[0], r.Runbook("file1"))
+	assert.Nil(r.Runbook("file2"))
+}
+
+func TestResultSucceeded(t *testing.T) {
+	assert := assert.New(t)
+
+	r := Result{}
+	assert.True(r.Succeeded())
+
+	r = Result{Successes: []ApplyAttempt{{FilePath: "file1"}}}
+	assert.True(r.Succeeded())
+
+	r = Result{Successes: []ApplyAttempt{{FilePath: "file1"}}, Failures: []ApplyAttempt{{FilePath: "file2"}}}
+	assert.False(r.Succeeded())
+
+	r = Result{ReadOnly: true}
+	assert.False(r.Succeeded())
+}
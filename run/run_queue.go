@@ -0,0 +1,133 @@
+package run
+
+import (
+	"github.com/box/kube-applier/sysutil"
+	"sync"
+	"time"
+)
+
+// RunQueue tracks the runs that are queued or in progress, so that operators can see why a commit has not been applied yet.
+// It is shared between the scheduler and the webserver, which queue runs, the runner, which starts and finishes them, and
+// the webserver, which serves its state.
+// If ApplyOrder is set, the state includes the backlog of the runs in progress and of the queued full runs.
+type RunQueue struct {
+	Clock      sysutil.ClockInterface
+	ApplyOrder *ApplyOrder
+	mu         sync.Mutex
+	queued     []QueuedRun
+	running    []QueuedRun
+}
+
+// QueuedRun describes a run that is queued or in progress.
+type QueuedRun struct {
+	RunType RunType `json:"runType"`
+	// RunID is assigned to full runs when they are queued, and to quick runs when they start. It is -1 until assigned.
+	RunID int `json:"runID"`
+	// CommitHash is the commit a quick run was queued for. Full runs apply the HEAD commit when they start.
+	CommitHash string     `json:"commitHash,omitempty"`
+	Queued     time.Time  `json:"queued"`
+	Started    *time.Time `json:"started,omitempty"`
+	// Backlog is the estimated backlog of a run in progress or of a queued full run, if known.
+	Backlog *Backlog `json:"backlog,omitempty"`
+	RunOptions
+}
+
+// RunQueueState is a snapshot of the RunQueue.
+type RunQueueState struct {
+	Queued  []QueuedRun `json:"queued"`
+	Running []QueuedRun `json:"running"`
+}
+
+// QueueFull records that the full run with the given ID was queued with the given options.
+func (q *RunQueue) QueueFull(id int, options RunOptions) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.queued = append(q.queued, QueuedRun{RunType: FullRun, RunID: id, Queued: q.Clock.Now(), RunOptions: options})
+}
+
+// Unqueue forgets the queued full run with the given ID, if it could not be queued after all.
+func (q *RunQueue) Unqueue(id int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.queued = removeRuns(q.queued, func(r QueuedRun) bool { return r.RunType == FullRun && r.RunID == id })
+}
+
+// QueueQuick records that a quick run was queued for the given commit, replacing any quick run that is still queued.
+func (q *RunQueue) QueueQuick(hash string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.queued = removeRuns(q.queued, func(r QueuedRun) bool { return r.RunType == QuickRun })
+	q.queued = append(q.queued, QueuedRun{RunType: QuickRun, RunID: -1, CommitHash: hash, Queued: q.Clock.Now()})
+}
+
+// Start moves a queued run to the runs in progress. Full runs are matched by run ID, and quick runs by commit hash, since
+// a newer quick run may have replaced the one that is starting in the meantime.
+// It returns the started run, including the options it was queued with.
+func (q *RunQueue) Start(runType RunType, id int, hash string) QueuedRun {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	now := q.Clock.Now()
+	run := QueuedRun{RunType: runType, RunID: id, CommitHash: hash, Queued: now, Started: &now}
+	matches := func(r QueuedRun) bool {
+		if runType == FullRun {
+			return r.RunType == FullRun && r.RunID == id
+		}
+		return r.RunType == QuickRun && r.CommitHash == hash
+	}
+	for _, r := range q.queued {
+		if matches(r) {
+			run.Queued, run.RunOptions = r.Queued, r.RunOptions
+		}
+	}
+	q.queued = removeRuns(q.queued, matches)
+	q.running = append(q.running, run)
+	return run
+}
+
+// Finish forgets the run in progress with the given ID.
+func (q *RunQueue) Finish(id int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.running = removeRuns(q.running, func(r QueuedRun) bool { return r.RunID == id })
+}
+
+// State returns a snapshot of the queued runs and the runs in progress, in the order they were queued and started.
+func (q *RunQueue) State() RunQueueState {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	state := RunQueueState{append([]QueuedRun{}, q.queued...), append([]QueuedRun{}, q.running...)}
+	if q.ApplyOrder != nil {
+		for i, r := range state.Queued {
+			if r.RunType == FullRun {
+				state.Queued[i].Backlog = q.ApplyOrder.FullRunBacklog()
+			}
+		}
+		for i, r := range state.Running {
+			state.Running[i].Backlog = q.ApplyOrder.Backlog(r.RunID)
+		}
+	}
+	return state
+}
+
+// DrainSeconds returns the estimated number of seconds until the runs in the state have applied all their files, assuming
+// that they run one after the other.
+func (s RunQueueState) DrainSeconds() float64 {
+	seconds := 0.0
+	for _, r := range append(append([]QueuedRun{}, s.Queued...), s.Running...) {
+		if r.Backlog != nil {
+			seconds += r.Backlog.EstimatedSeconds
+		}
+	}
+	return seconds
+}
+
+// removeRuns returns the runs for which remove returns false.
+func removeRuns(runs []QueuedRun, remove func(QueuedRun) bool) []QueuedRun {
+	kept := []QueuedRun{}
+	for _, r := range runs {
+		if !remove(r) {
+			kept = append(kept, r)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,94 @@
+package run
+
+import (
+	"github.com/box/kube-applier/sysutil"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestRunQueue(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	clock := sysutil.NewMockClockInterface(mockCtrl)
+	q := &RunQueue{Clock: clock}
+	assert.Equal(RunQueueState{[]QueuedRun{}, []QueuedRun{}}, q.State())
+
+	gomock.InOrder(
+		clock.EXPECT().Now().Times(1).Return(time.Unix(1, 0)),
+		clock.EXPECT().Now().Times(1).Return(time.Unix(2, 0)),
+		clock.EXPECT().Now().Times(1).Return(time.Unix(3, 0)),
+		clock.EXPECT().Now().Times(1).Return(time.Unix(4, 0)),
+		clock.EXPECT().Now().Times(1).Return(time.Unix(5, 0)),
+	)
+	q.QueueFull(0, RunOptions{})
+	q.QueueQuick("hash1")
+	// A newer quick run replaces the queued one
+	q.QueueQuick("hash2")
+	assert.Equal(RunQueueState{
+		Queued: []QueuedRun{
+			{RunType: FullRun, RunID: 0, Queued: time.Unix(1, 0)},
+			{RunType: QuickRun, RunID: -1, CommitHash: "hash2", Queued: time.Unix(3, 0)},
+		},
+		Running: []QueuedRun{},
+	}, q.State())
+
+	// A quick run that was replaced while starting leaves the newer one queued
+	q.Start(QuickRun, 1, "hash1")
+	q.Start(FullRun, 0, "")
+	started4, started5 := time.Unix(4, 0), time.Unix(5, 0)
+	assert.Equal(RunQueueState{
+		Queued: []QueuedRun{
+			{RunType: QuickRun, RunID: -1, CommitHash: "hash2", Queued: time.Unix(3, 0)},
+		},
+		Running: []QueuedRun{
+			{RunType: QuickRun, RunID: 1, CommitHash: "hash1", Queued: started4, Started: &started4},
+			{RunType: FullRun, RunID: 0, Queued: time.Unix(1, 0), Started: &started5},
+		},
+	}, q.State())
+
+	q.Finish(1)
+	q.Finish(0)
+	assert.Equal([]QueuedRun{}, q.State().Running)
+
+	// A full run that could not be queued is forgotten
+	clock.EXPECT().Now().Times(1).Return(time.Unix(6, 0))
+	q.QueueFull(2, RunOptions{})
+	q.Unqueue(2)
+	assert.Equal(1, len(q.State().Queued))
+
+	// Full runs start with the options they were queued with
+	clock.EXPECT().Now().Times(2).Return(time.Unix(7, 0))
+	q.QueueFull(3, RunOptions{DryRun: true})
+	assert.Equal(RunOptions{DryRun: true}, q.Start(FullRun, 3, "").RunOptions)
+}
+
+func TestRunQueueBacklog(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	clock := sysutil.NewMockClockInterface(mockCtrl)
+	applyOrder := &ApplyOrder{Clock: clock}
+	q := &RunQueue{Clock: &sysutil.Clock{}, ApplyOrder: applyOrder}
+
+	// a took 10s to apply before, b has not been applied yet
+	gomock.InOrder(
+		clock.EXPECT().Now().Times(1).Return(time.Unix(0, 0)),
+		clock.EXPECT().Now().Times(1).Return(time.Unix(10, 0)),
+	)
+	applyOrder.Start(-1, "/repo/a.yaml")(true)
+	applyOrder.Sort(0, []string{"/repo/a.yaml", "/repo/b.yaml"})
+	q.QueueFull(0, RunOptions{})
+	q.Start(FullRun, 0, "")
+	q.QueueFull(1, RunOptions{})
+	q.QueueQuick("hash")
+	state := q.State()
+	assert.Equal(&Backlog{Files: 2, EstimatedSeconds: 20}, state.Running[0].Backlog)
+	assert.Equal(&Backlog{Files: 1, EstimatedSeconds: 10}, state.Queued[0].Backlog)
+	assert.Nil(state.Queued[1].Backlog)
+	assert.Equal(30.0, state.DrainSeconds())
+}
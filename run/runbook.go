@@ -0,0 +1,104 @@
+package run
+
+import (
+	"fmt"
+	"github.com/box/kube-applier/sysutil"
+	"regexp"
+	"strings"
+)
+
+// failureClass is a known cause of apply failures, recognized by a pattern in the output of the failed command.
+type failureClass struct {
+	name    string
+	pattern *regexp.Regexp
+}
+
+// failureClasses are checked in order, and a failure is assigned the first class that matches.
+var failureClasses = []failureClass{
+	{"rbac-denied", regexp.MustCompile(`(?i)\bis forbidden\b|\bcannot (get|create|patch|delete|list) resource\b`)},
+	{"crd-missing", regexp.MustCompile(`(?i)no matches for kind|ensure CRDs are installed first`)},
+	{"webhook-timeout", regexp.MustCompile(`(?i)failed calling webhook.*(timeout|deadline exceeded)`)},
+}
+
+// Runbook tells operators what to do about a class of failures, with a link to its documentation and/or a short hint.
+type Runbook struct {
+	URL  string
+	Hint string
+}
+
+// Runbooks maps failure class names to their runbook.
+type Runbooks map[string]Runbook
+
+// FailureRunbook is the runbook for a failed file, as shown next to the failure on the status page.
+type FailureRunbook struct {
+	FilePath string
+	Class    string
+	Runbook
+}
+
+// LoadRunbooks reads runbooks from the file located at path, usually mounted from a ConfigMap.
+// Each line holds a failure class, a URL and an optional hint, separated by commas, e.g.
+// "rbac-denied,https://wiki.example.com/kube-applier-rbac,Ask the cluster admins to extend the kube-applier ClusterRole".
+// Either the URL or the hint may be empty. Empty lines and lines starting with # are ignored.
+func LoadRunbooks(path string, fs sysutil.FileSystemInterface) (Runbooks, error) {
+	lines, err := fs.ReadLines(path)
+	if err != nil {
+		return nil, err
+	}
+	runbooks := Runbooks{}
+	for _, line := range lines {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, ",", 3)
+		class := strings.TrimSpace(parts[0])
+		if !knownFailureClass(class) {
+			return nil, fmt.Errorf("Invalid runbook %q, unknown failure class %q", line, class)
+		}
+		runbook := Runbook{}
+		if len(parts) > 1 {
+			runbook.URL = strings.TrimSpace(parts[1])
+		}
+		if len(parts) > 2 {
+			runbook.Hint = strings.TrimSpace(parts[2])
+		}
+		if runbook.URL == "" && runbook.Hint == "" {
+			return nil, fmt.Errorf("Invalid runbook %q, must have a URL or a hint", line)
+		}
+		runbooks[class] = runbook
+	}
+	return runbooks, nil
+}
+
+// Match returns the runbooks of the failures that belong to a class with a runbook, in the order of the failures.
+func (r Runbooks) Match(failures []ApplyAttempt) []FailureRunbook {
+	matched := []FailureRunbook{}
+	for _, failure := range failures {
+		class := classifyFailure(failure)
+		if runbook, ok := r[class]; ok {
+			matched = append(matched, FailureRunbook{failure.FilePath, class, runbook})
+		}
+	}
+	return matched
+}
+
+// classifyFailure returns the name of the class of the failure, or an empty string if it is not a known failure.
+func classifyFailure(failure ApplyAttempt) string {
+	text := failure.Output + "\n" + failure.ErrorMessage
+	for _, c := range failureClasses {
+		if c.pattern.MatchString(text) {
+			return c.name
+		}
+	}
+	return ""
+}
+
+// knownFailureClass returns true if name is the name of a failure class.
+func knownFailureClass(name string) bool {
+	for _, c := range failureClasses {
+		if c.name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package run
+
+import (
+	"fmt"
+	"github.com/box/kube-applier/sysutil"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestLoadRunbooks(t *testing.T) {
+	assert := assert.New(t)
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	fs := sysutil.NewMockFileSystemInterface(mockCtrl)
+
+	gomock.InOrder(
+		fs.EXPECT().ReadLines("runbooks").Times(1).Return([]string{
+			"# comment",
+			"",
+			"rbac-denied, https://wiki/rbac",
+			"crd-missing,,Apply the CRD first, then retry",
+		}, nil),
+		fs.EXPECT().ReadLines("unknown").Times(1).Return([]string{"out-of-memory,https://wiki/oom"}, nil),
+		fs.EXPECT().ReadLines("empty").Times(1).Return([]string{"rbac-denied,,"}, nil),
+		fs.EXPECT().ReadLines("missing").Times(1).Return(nil, fmt.Errorf("read error")),
+	)
+
+	runbooks, err := LoadRunbooks("runbooks", fs)
+	assert.Nil(err)
+	assert.Equal(Runbooks{
+		"rbac-denied": {URL: "https://wiki/rbac"},
+		"crd-missing": {Hint: "Apply the CRD first, then retry"},
+	}, runbooks)
+
+	_, err = LoadRunbooks("unknown", fs)
+	assert.EqualError(err, `Invalid runbook "out-of-memory,https://wiki/oom", unknown failure class "out-of-memory"`)
+	_, err = LoadRunbooks("empty", fs)
+	assert.EqualError(err, `Invalid runbook "rbac-denied,,", must have a URL or a hint`)
+	_, err = LoadRunbooks("missing", fs)
+	assert.EqualError(err, "read error")
+}
+
+func TestRunbooksMatch(t *testing.T) {
+	assert := assert.New(t)
+
+	runbooks := Runbooks{
+		"rbac-denied":     {URL: "https://wiki/rbac"},
+		"webhook-timeout": {Hint: "Check the webhook pods"},
+	}
+	failures := []ApplyAttempt{
+		{FilePath: "file1", Output: `Error from server (Forbidden): deployments.apps "a" is forbidden: User "kube-applier" cannot patch resource "deployments"`},
+		{FilePath: "file2", Output: `error: unable to recognize "file2": no matches for kind "Widget" in version "example.com/v1"`},
+		{FilePath: "file3", Output: `Error from server (InternalError): Internal error occurred: failed calling webhook "validate.example.com": context deadline exceeded`},
+		{FilePath: "file4", Output: "error: some other error", ErrorMessage: "exit status 1"},
+	}
+	assert.Equal([]FailureRunbook{
+		{"file1", "rbac-denied", Runbook{URL: "https://wiki/rbac"}},
+		{"file3", "webhook-timeout", Runbook{Hint: "Check the webhook pods"}},
+	}, runbooks.Match(failures))
+
+	assert.Equal("crd-missing", classifyFailure(failures[1]))
+	assert.Equal("", classifyFailure(failures[3]))
+	assert.Equal([]FailureRunbook{}, runbooks.Match(nil))
+}
@@ -1,37 +1,76 @@
 package run
 
 import (
+	"fmt"
 	"github.com/box/kube-applier/applylist"
 	"github.com/box/kube-applier/git"
+	"github.com/box/kube-applier/kube"
 	"github.com/box/kube-applier/sysutil"
 	"log"
 )
 
+// Maximum number of changed files recorded in the result of a quick run.
+const maxChangedFiles = 50
+
+// minResourcesCheck is listed as the failed "file" of a full run that applied fewer than MinResources resources.
+const minResourcesCheck = "MIN_APPLIED_RESOURCES"
+
 // Runner manages the full process of an apply run, including getting the appropriate files, running apply commands on them, and handling the results.
+// If FileSystem is set, full runs count the resources defined in the files they applied.
 type Runner struct {
-	BatchApplier  BatchApplierInterface
-	ListFactory   applylist.FactoryInterface
-	GitUtil       git.GitUtilInterface
-	Clock         sysutil.ClockInterface
-	DiffURLFormat string
-	LastHash      string
-	QuickRunQueue <-chan string
-	FullRunQueue  <-chan bool
-	RunResults    chan<- Result
-	RunMetrics    chan<- Result
-	Errors        chan<- error
-	RunCount      chan int
+	BatchApplier    BatchApplierInterface
+	ListFactory     applylist.FactoryInterface
+	GitUtil         git.GitUtilInterface
+	FileSystem      sysutil.FileSystemInterface
+	Clock           sysutil.ClockInterface
+	DiffURLFormat   string
+	ValidateMode    ValidateMode
+	SkipMarkers     *SkipMarkers
+	Guardrails      GuardrailsInterface
+	Policy          PolicyInterface
+	PreApplyHook    HookInterface
+	PostApplyHook   HookInterface
+	WaitForRollout  bool
+	OwnershipLabels bool
+	MinResources    int
+	ReadOnly        *ReadOnly
+	CircuitBreaker  *CircuitBreaker
+	AuthorPolicy    *AuthorPolicy
+	ApplyWindow     *ApplyWindow
+	MaxOutputLines  int
+	History         *History
+	Runbooks        Runbooks
+	Tombstones      *Tombstones
+	RunQueue        *RunQueue
+	Cooldown        *Cooldown
+	LastHash        string
+	QuickRunQueue   <-chan string
+	FullRunQueue    <-chan int
+	RunResults      chan<- Result
+	RunMetrics      chan<- Result
+	Errors          chan<- error
+	RunCount        chan int
 }
 
 // StartFullLoop runs a continuous loop that starts a new full run through the repo when a request comes into the queue channel.
+// Full runs are assigned their run ID when they are queued, and their options are read from the RunQueue when they start.
 func (r *Runner) StartFullLoop() {
-	for range r.FullRunQueue {
-		id := <-r.RunCount
-		result, err := r.fullRun(id)
+	for id := range r.FullRunQueue {
+		if r.Cooldown != nil {
+			r.Cooldown.Wait()
+		}
+		options := RunOptions{}
+		if r.RunQueue != nil {
+			options = r.RunQueue.Start(FullRun, id, "").RunOptions
+		}
+		result, err := r.fullRun(id, options)
 		if err != nil {
 			r.Errors <- err
 			return
 		}
+		if r.RunQueue != nil {
+			r.RunQueue.Finish(id)
+		}
 		r.RunResults <- *result
 		r.RunMetrics <- *result
 	}
@@ -46,12 +85,27 @@ func (r *Runner) StartQuickLoop() {
 	}
 	r.LastHash = initHash
 	for hash := range r.QuickRunQueue {
+		if r.Cooldown != nil {
+			r.Cooldown.Wait()
+			// A commit polled while waiting replaces this one, as it would have in the queue.
+			select {
+			case newer := <-r.QuickRunQueue:
+				hash = newer
+			default:
+			}
+		}
 		id := <-r.RunCount
+		if r.RunQueue != nil {
+			r.RunQueue.Start(QuickRun, id, hash)
+		}
 		result, err := r.quickRun(id, hash)
 		if err != nil {
 			r.Errors <- err
 			return
 		}
+		if r.RunQueue != nil {
+			r.RunQueue.Finish(id)
+		}
 		r.RunResults <- *result
 		r.RunMetrics <- *result
 	}
@@ -70,7 +124,7 @@ func (r *Runner) StartRunCounter() {
 
 // fullRun initiates a full apply run, considering all files in the repo as candidates for applying.
 // The current HEAD hash and list of all files in the repo are passed to the "run" helper function.
-func (r *Runner) fullRun(id int) (*Result, error) {
+func (r *Runner) fullRun(id int, options RunOptions) (*Result, error) {
 	hash, err := r.GitUtil.HeadHash()
 	if err != nil {
 		return nil, err
@@ -80,7 +134,7 @@ func (r *Runner) fullRun(id int) (*Result, error) {
 		return nil, err
 	}
 	log.Printf("RUN %v: Starting full run with hash %v", id, hash)
-	result, err := r.run(id, FullRun, rawList, hash)
+	result, err := r.run(id, FullRun, rawList, hash, options)
 	log.Printf("RUN %v: Finished full run.", id)
 	if err != nil {
 		return nil, err
@@ -96,20 +150,54 @@ func (r *Runner) quickRun(id int, hash string) (*Result, error) {
 		return nil, err
 	}
 	log.Printf("RUN %v: Starting quick run with hash %v.", id, hash)
-	result, err := r.run(id, QuickRun, rawList, hash)
+	result, err := r.run(id, QuickRun, rawList, hash, RunOptions{})
 	log.Printf("RUN %v: Finished quick run.", id)
 	if err != nil {
 		return nil, err
 	}
+	result.PreviousCommitHash = r.LastHash
+	result.ChangedFiles = rawList
+	if len(rawList) > maxChangedFiles {
+		result.ChangedFiles = rawList[:maxChangedFiles]
+		result.OmittedChangedFiles = len(rawList) - maxChangedFiles
+	}
+	if result.PendingApproval || result.OutsideApplyWindow || result.ReadOnly {
+		// Keep LastHash, so that the files of the skipped commit are applied by the next quick run that is allowed.
+		return result, nil
+	}
+	// Summarize the files changed by the applied revision, so reviewers can see what a successful run picked up.
+	if len(result.Failures) == 0 {
+		result.DiffStat, err = r.GitUtil.DiffStat(r.LastHash, hash)
+		if err != nil {
+			return nil, err
+		}
+	}
 	// Only update LastHash as part of quick run.
 	// If we updated at end of full run, a long full run might set LastHash back to outdated value.
 	r.LastHash = hash
 	return result, nil
 }
 
+// clearForces drops the forces that are still pending on the gates of a full run, once a full run has used them up.
+func (r *Runner) clearForces() {
+	if r.ApplyWindow != nil {
+		r.ApplyWindow.clearForce()
+	}
+	if r.AuthorPolicy != nil {
+		r.AuthorPolicy.clearForce()
+	}
+	if r.CircuitBreaker != nil {
+		r.CircuitBreaker.clearForce()
+	}
+}
+
 // run takes in a list of candidate files, filters using the whitelist/blacklist, and applies them.
 // run returns a Result with info about the run.
-func (r *Runner) run(id int, runType RunType, rawList []string, hash string) (*Result, error) {
+// A dry run goes through the same checks, but only applies the files with a server-side dry run. Since it changes nothing, it is
+// not held back by read-only mode, the apply window, the author policy or the circuit breaker, and skips the steps that act on
+// applied objects: the rollout checks, ownership labels and the post-apply hook. kubectl does not report dry-run resources in
+// the form counted for MinResources, so that check is skipped too. It is not recorded in the run history or the circuit breaker.
+func (r *Runner) run(id int, runType RunType, rawList []string, hash string, options RunOptions) (*Result, error) {
 	start := r.Clock.Now()
 
 	applyList, blacklist, whitelist, err := r.ListFactory.Create(rawList)
@@ -122,10 +210,235 @@ func (r *Runner) run(id int, runType RunType, rawList []string, hash string) (*R
 		return nil, err
 	}
 
-	successes, failures := r.BatchApplier.Apply(id, applyList)
+	if options.DryRun {
+		log.Printf("RUN %v: Dry run requested, no files will be changed.", id)
+	}
+
+	// skippedResult logs why none of the files are applied and returns the result of the run, on which the caller sets the
+	// reason. A forced run is used up by the next full run even if it is held back, so the forces of the gates after the one
+	// that held it back are cleared here, rather than letting them through a later scheduled run.
+	skippedResult := func(reason string) *Result {
+		log.Printf("RUN %v: %v, skipping apply of %v files.", id, reason, len(applyList))
+		if runType == FullRun && !options.DryRun {
+			r.clearForces()
+		}
+		return &Result{
+			RunID:         id,
+			RunType:       runType,
+			Start:         start,
+			Finish:        r.Clock.Now(),
+			CommitHash:    hash,
+			FullCommit:    commitLog,
+			Blacklist:     blacklist,
+			Whitelist:     whitelist,
+			Successes:     []ApplyAttempt{},
+			Failures:      []ApplyAttempt{},
+			DiffURLFormat: r.DiffURLFormat,
+			DryRun:        options.DryRun,
+		}
+	}
+
+	if !options.DryRun && r.ReadOnly != nil && r.ReadOnly.Enabled() {
+		newRun := skippedResult("Read-only mode is enabled")
+		newRun.ReadOnly = true
+		return newRun, nil
+	}
+
+	if !options.DryRun && r.ApplyWindow != nil && !r.ApplyWindow.Allow(runType, start) {
+		newRun := skippedResult("Outside of the apply window")
+		newRun.OutsideApplyWindow = true
+		return newRun, nil
+	}
+
+	if !options.DryRun && r.AuthorPolicy != nil {
+		// Until a commit is allowed, quick runs check the commits whose files they apply, and full runs only check HEAD.
+		// LastHash is only read here by quick runs, which own it.
+		base := r.AuthorPolicy.AllowedHash()
+		if base == "" && runType == QuickRun {
+			base = r.LastHash
+		}
+		emails, err := r.GitUtil.CommitEmails(base, hash)
+		if err != nil {
+			return nil, err
+		}
+		if !r.AuthorPolicy.Allow(runType, hash, emails) {
+			newRun := skippedResult(fmt.Sprintf("Commits up to %v by %v are not all from an allowed author", hash, emails))
+			newRun.PendingApproval = true
+			return newRun, nil
+		}
+	}
+
+	if !options.DryRun && runType == FullRun && r.CircuitBreaker != nil && !r.CircuitBreaker.Allow() {
+		newRun := skippedResult(fmt.Sprintf("Runs are suspended after %v consecutive failures", r.CircuitBreaker.Threshold))
+		newRun.Suspended = true
+		return newRun, nil
+	}
+
+	files := applyList
+	var skipped []ApplyAttempt
+	if r.SkipMarkers != nil {
+		skipped = r.SkipMarkers.Check(id, applyList)
+		if len(skipped) > 0 {
+			log.Printf("RUN %v: %v files are marked to be skipped and will not be applied.", id, len(skipped))
+			applyList = excludeAttempts(applyList, skipped)
+		}
+	}
+
+	var preApplyHook *ApplyAttempt
+	if r.PreApplyHook != nil {
+		hook := r.PreApplyHook.Run(id, hash)
+		preApplyHook = &hook
+		if hook.ErrorMessage != "" {
+			newRun := skippedResult("Pre-apply hook failed")
+			newRun.Failures = []ApplyAttempt{hook}
+			newRun.PreApplyHook = preApplyHook
+			newRun.Skipped = skipped
+			if !options.DryRun && r.CircuitBreaker != nil {
+				r.CircuitBreaker.Record(false)
+			}
+			newRun.TruncateOutputs(r.MaxOutputLines)
+			return newRun, nil
+		}
+	}
+
+	var violations []ApplyAttempt
+	if r.Guardrails != nil {
+		violations = r.Guardrails.Check(applyList)
+		if len(violations) > 0 {
+			log.Printf("RUN %v: %v files violate the configured guardrails and will not be applied.", id, len(violations))
+			applyList = excludeAttempts(applyList, violations)
+		}
+	}
+	if r.Policy != nil {
+		policyViolations := r.Policy.Check(id, applyList)
+		if len(policyViolations) > 0 {
+			log.Printf("RUN %v: %v files violate the policy and will not be applied.", id, len(policyViolations))
+			applyList = excludeAttempts(applyList, policyViolations)
+			violations = append(violations, policyViolations...)
+		}
+	}
+
+	var findings []ApplyAttempt
+	if r.ValidateMode == ValidateWarn || r.ValidateMode == ValidateStrict {
+		findings = r.BatchApplier.Validate(id, applyList)
+		if r.ValidateMode == ValidateStrict {
+			applyList = excludeAttempts(applyList, findings)
+		}
+	}
+
+	var successes, failures []ApplyAttempt
+	if options.DryRun {
+		successes, failures = r.BatchApplier.DryRun(id, applyList)
+	} else {
+		successes, failures = r.BatchApplier.Apply(id, applyList)
+	}
+	if r.ValidateMode == ValidateStrict {
+		// Files rejected by validation were never applied, so they count towards the failures of the run.
+		failures = append(failures, findings...)
+	}
+	failures = append(failures, violations...)
+
+	// A full run applies every file in the repo, so too few resources means that files went missing, e.g. after a bad merge.
+	if !options.DryRun && runType == FullRun && r.MinResources > 0 {
+		if applied := countResources(successes); applied < r.MinResources {
+			log.Printf("RUN %v: Applied %v resources, fewer than the expected minimum of %v.", id, applied, r.MinResources)
+			failures = append(failures, ApplyAttempt{minResourcesCheck, "", "", fmt.Sprintf("Error: run applied %v resources, fewer than the expected minimum of %v", applied, r.MinResources)})
+		}
+	}
+
+	var rolloutChecks []ApplyAttempt
+	if !options.DryRun && r.WaitForRollout {
+		rolloutChecks = r.BatchApplier.CheckRollouts(id, successes)
+	}
+
+	if !options.DryRun && r.OwnershipLabels && len(successes) > 0 {
+		r.BatchApplier.Label(id, successes, map[string]string{CommitLabel: hash})
+	}
+
+	var postApplyHook *ApplyAttempt
+	if !options.DryRun && r.PostApplyHook != nil {
+		hook := r.PostApplyHook.Run(id, hash)
+		postApplyHook = &hook
+		if hook.ErrorMessage != "" {
+			// A failed verification fails the run, even if every file was applied.
+			log.Printf("RUN %v: Post-apply hook failed.", id)
+			failures = append(failures, hook)
+		}
+	}
 
 	finish := r.Clock.Now()
 
-	newRun := &Result{id, runType, start, finish, hash, commitLog, blacklist, whitelist, successes, failures, r.DiffURLFormat}
+	newRun := &Result{
+		RunID:              id,
+		RunType:            runType,
+		Start:              start,
+		Finish:             finish,
+		CommitHash:         hash,
+		FullCommit:         commitLog,
+		Blacklist:          blacklist,
+		Whitelist:          whitelist,
+		Successes:          successes,
+		Failures:           failures,
+		DiffURLFormat:      r.DiffURLFormat,
+		ValidationFindings: findings,
+		Skipped:            skipped,
+		RolloutChecks:      rolloutChecks,
+		PreApplyHook:       preApplyHook,
+		PostApplyHook:      postApplyHook,
+		DryRun:             options.DryRun,
+	}
+	if !options.DryRun && runType == FullRun && r.FileSystem != nil {
+		newRun.ManagedResources = countManagedResources(r.FileSystem, successes)
+	}
+	if !options.DryRun && r.History != nil {
+		newRun.FileHistory = r.History.Record(successes, failures)
+	}
+	if !options.DryRun && r.Tombstones != nil {
+		newRun.Tombstones = r.Tombstones.Record(id, runType, hash, finish, files, successes, failures)
+	}
+	if !options.DryRun {
+		newRun.ResourceActions = countResourceActions(r.FileSystem, append(append([]ApplyAttempt{}, successes...), failures...))
+	}
+	newRun.IgnoredObjects = countIgnoredObjects(successes) + countIgnoredObjects(failures)
+	if r.Runbooks != nil {
+		newRun.FailureRunbooks = r.Runbooks.Match(failures)
+	}
+	if !options.DryRun && r.CircuitBreaker != nil {
+		r.CircuitBreaker.Record(len(failures) == 0)
+	}
+	newRun.TruncateOutputs(r.MaxOutputLines)
 	return newRun, err
 }
+
+// countIgnoredObjects returns the number of objects that kubectl reported as ignored for the apply attempts.
+func countIgnoredObjects(attempts []ApplyAttempt) int {
+	ignored := 0
+	for _, a := range attempts {
+		ignored += kube.IgnoredObjects(a.Output)
+	}
+	return ignored
+}
+
+// countResources returns the number of resources kubectl reported for the apply attempts.
+func countResources(attempts []ApplyAttempt) int {
+	count := 0
+	for _, a := range attempts {
+		count += len(ParseApplyOutput(a.Output))
+	}
+	return count
+}
+
+// excludeAttempts returns the paths from list that do not have a corresponding ApplyAttempt in attempts.
+func excludeAttempts(list []string, attempts []ApplyAttempt) []string {
+	excluded := make(map[string]struct{})
+	for _, a := range attempts {
+		excluded[a.FilePath] = struct{}{}
+	}
+	filtered := []string{}
+	for _, path := range list {
+		if _, ok := excluded[path]; !ok {
+			filtered = append(filtered, path)
+		}
+	}
+	return filtered
+}
@@ -4,9 +4,13 @@ import (
 	"fmt"
 	"github.com/box/kube-applier/applylist"
 	"github.com/box/kube-applier/git"
+	"github.com/box/kube-applier/kube"
 	"github.com/box/kube-applier/sysutil"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 )
@@ -30,11 +34,22 @@ func TestRunnerStartFullLoop(t *testing.T) {
 
 	errors := make(chan error)
 	quickRunQueue := make(chan string, 1)
-	fullRunQueue := make(chan bool, 1)
+	fullRunQueue := make(chan int, 1)
 	runResults := make(chan Result, 5)
 	runMetrics := make(chan Result, 5)
 	runCount := make(chan int)
-	r := Runner{batchApplier, factory, repo, clock, "", "", quickRunQueue, fullRunQueue, runResults, runMetrics, errors, runCount}
+	r := Runner{
+		BatchApplier:  batchApplier,
+		ListFactory:   factory,
+		GitUtil:       repo,
+		Clock:         clock,
+		QuickRunQueue: quickRunQueue,
+		FullRunQueue:  fullRunQueue,
+		RunResults:    runResults,
+		RunMetrics:    runMetrics,
+		Errors:        errors,
+		RunCount:      runCount,
+	}
 
 	go r.StartRunCounter()
 	go r.StartFullLoop()
@@ -50,19 +65,19 @@ func TestRunnerStartFullLoop(t *testing.T) {
 		clock.EXPECT().Now().Times(1).Return(time.Time{}),
 	)
 	expectedResult := Result{
-		0,
-		FullRun,
-		time.Time{},
-		time.Time{},
-		"hash",
-		"log",
-		[]string{},
-		[]string{},
-		[]ApplyAttempt{},
-		[]ApplyAttempt{},
-		"",
+		RunID:         0,
+		RunType:       FullRun,
+		Start:         time.Time{},
+		Finish:        time.Time{},
+		CommitHash:    "hash",
+		FullCommit:    "log",
+		Blacklist:     []string{},
+		Whitelist:     []string{},
+		Successes:     []ApplyAttempt{},
+		Failures:      []ApplyAttempt{},
+		DiffURLFormat: "",
 	}
-	fullRunQueue <- true
+	fullRunQueue <- 0
 	waitAndAssert(t, testCase{runResults, runMetrics, errors, expectedResult, nil})
 
 	// Apply list and blacklist, empty successes and failures
@@ -76,19 +91,19 @@ func TestRunnerStartFullLoop(t *testing.T) {
 		clock.EXPECT().Now().Times(1).Return(time.Time{}),
 	)
 	expectedResult = Result{
-		1,
-		FullRun,
-		time.Time{},
-		time.Time{},
-		"hash",
-		"log",
-		[]string{"black1", "black2"},
-		[]string{},
-		[]ApplyAttempt{},
-		[]ApplyAttempt{},
-		"",
+		RunID:         1,
+		RunType:       FullRun,
+		Start:         time.Time{},
+		Finish:        time.Time{},
+		CommitHash:    "hash",
+		FullCommit:    "log",
+		Blacklist:     []string{"black1", "black2"},
+		Whitelist:     []string{},
+		Successes:     []ApplyAttempt{},
+		Failures:      []ApplyAttempt{},
+		DiffURLFormat: "",
 	}
-	fullRunQueue <- true
+	fullRunQueue <- 1
 	waitAndAssert(t, testCase{runResults, runMetrics, errors, expectedResult, nil})
 
 	// Apply list and blacklist, successes and failures
@@ -111,19 +126,19 @@ func TestRunnerStartFullLoop(t *testing.T) {
 		clock.EXPECT().Now().Times(1).Return(time.Time{}),
 	)
 	expectedResult = Result{
-		2,
-		FullRun,
-		time.Time{},
-		time.Time{},
-		"hash",
-		"log",
-		[]string{"black1", "black2"},
-		[]string{},
-		successes,
-		failures,
-		"",
+		RunID:         2,
+		RunType:       FullRun,
+		Start:         time.Time{},
+		Finish:        time.Time{},
+		CommitHash:    "hash",
+		FullCommit:    "log",
+		Blacklist:     []string{"black1", "black2"},
+		Whitelist:     []string{},
+		Successes:     successes,
+		Failures:      failures,
+		DiffURLFormat: "",
 	}
-	fullRunQueue <- true
+	fullRunQueue <- 2
 	waitAndAssert(t, testCase{runResults, runMetrics, errors, expectedResult, nil})
 
 	// Apply list, blacklist and whitelist , successes and failures
@@ -146,26 +161,26 @@ func TestRunnerStartFullLoop(t *testing.T) {
 		clock.EXPECT().Now().Times(1).Return(time.Time{}),
 	)
 	expectedResult = Result{
-		3,
-		FullRun,
-		time.Time{},
-		time.Time{},
-		"hash",
-		"log",
-		[]string{"black1", "black2"},
-		[]string{"file1", "file2", "file3", "file4", "file5"},
-		successes,
-		failures,
-		"",
+		RunID:         3,
+		RunType:       FullRun,
+		Start:         time.Time{},
+		Finish:        time.Time{},
+		CommitHash:    "hash",
+		FullCommit:    "log",
+		Blacklist:     []string{"black1", "black2"},
+		Whitelist:     []string{"file1", "file2", "file3", "file4", "file5"},
+		Successes:     successes,
+		Failures:      failures,
+		DiffURLFormat: "",
 	}
-	fullRunQueue <- true
+	fullRunQueue <- 3
 	waitAndAssert(t, testCase{runResults, runMetrics, errors, expectedResult, nil})
 
 	// HeadHash() error
 	gomock.InOrder(
 		repo.EXPECT().HeadHash().Times(1).Return("", fmt.Errorf("hash error")),
 	)
-	fullRunQueue <- true
+	fullRunQueue <- 4
 	waitAndAssert(t, testCase{runResults, runMetrics, errors, Result{}, fmt.Errorf("hash error")})
 
 	// Need to restart, error shuts down goroutine
@@ -176,7 +191,7 @@ func TestRunnerStartFullLoop(t *testing.T) {
 		repo.EXPECT().HeadHash().Times(1).Return("hash", nil),
 		repo.EXPECT().ListAllFiles().Times(1).Return(nil, fmt.Errorf("list error")),
 	)
-	fullRunQueue <- true
+	fullRunQueue <- 5
 	waitAndAssert(t, testCase{runResults, runMetrics, errors, expectedResult, fmt.Errorf("list error")})
 
 	// Need to restart, error shuts down goroutine
@@ -189,7 +204,7 @@ func TestRunnerStartFullLoop(t *testing.T) {
 		clock.EXPECT().Now().Times(1).Return(time.Time{}),
 		factory.EXPECT().Create([]string{}).Times(1).Return(nil, nil, nil, fmt.Errorf("create error")),
 	)
-	fullRunQueue <- true
+	fullRunQueue <- 6
 	waitAndAssert(t, testCase{runResults, runMetrics, errors, expectedResult, fmt.Errorf("create error")})
 
 	// Need to restart, error shuts down goroutine
@@ -203,7 +218,7 @@ func TestRunnerStartFullLoop(t *testing.T) {
 		factory.EXPECT().Create([]string{}).Times(1).Return([]string{}, []string{}, []string{}, nil),
 		repo.EXPECT().CommitLog("hash").Times(1).Return("", fmt.Errorf("log error")),
 	)
-	fullRunQueue <- true
+	fullRunQueue <- 7
 	waitAndAssert(t, testCase{runResults, runMetrics, errors, expectedResult, fmt.Errorf("log error")})
 }
 
@@ -219,11 +234,22 @@ func TestRunnerStartQuickLoop(t *testing.T) {
 
 	errors := make(chan error)
 	quickRunQueue := make(chan string, 1)
-	fullRunQueue := make(chan bool, 1)
+	fullRunQueue := make(chan int, 1)
 	runResults := make(chan Result, 5)
 	runMetrics := make(chan Result, 5)
 	runCount := make(chan int)
-	r := Runner{batchApplier, factory, repo, clock, "", "", quickRunQueue, fullRunQueue, runResults, runMetrics, errors, runCount}
+	r := Runner{
+		BatchApplier:  batchApplier,
+		ListFactory:   factory,
+		GitUtil:       repo,
+		Clock:         clock,
+		QuickRunQueue: quickRunQueue,
+		FullRunQueue:  fullRunQueue,
+		RunResults:    runResults,
+		RunMetrics:    runMetrics,
+		Errors:        errors,
+		RunCount:      runCount,
+	}
 
 	go r.StartRunCounter()
 
@@ -238,19 +264,23 @@ func TestRunnerStartQuickLoop(t *testing.T) {
 		repo.EXPECT().CommitLog("hash0").Times(1).Return("log", nil),
 		batchApplier.EXPECT().Apply(0, []string{}).Times(1).Return([]ApplyAttempt{}, []ApplyAttempt{}),
 		clock.EXPECT().Now().Times(1).Return(time.Time{}),
+		repo.EXPECT().DiffStat("initHash", "hash0").Times(1).Return("stat", nil),
 	)
 	expectedResult := Result{
-		0,
-		QuickRun,
-		time.Time{},
-		time.Time{},
-		"hash0",
-		"log",
-		[]string{},
-		[]string{},
-		[]ApplyAttempt{},
-		[]ApplyAttempt{},
-		"",
+		RunID:              0,
+		RunType:            QuickRun,
+		Start:              time.Time{},
+		Finish:             time.Time{},
+		CommitHash:         "hash0",
+		PreviousCommitHash: "initHash",
+		ChangedFiles:       []string{},
+		FullCommit:         "log",
+		Blacklist:          []string{},
+		Whitelist:          []string{},
+		Successes:          []ApplyAttempt{},
+		Failures:           []ApplyAttempt{},
+		DiffURLFormat:      "",
+		DiffStat:           "stat",
 	}
 	quickRunQueue <- "hash0"
 	waitAndAssert(t, testCase{runResults, runMetrics, errors, expectedResult, nil})
@@ -264,19 +294,23 @@ func TestRunnerStartQuickLoop(t *testing.T) {
 		repo.EXPECT().CommitLog("hash1").Times(1).Return("log", nil),
 		batchApplier.EXPECT().Apply(1, []string{"file1", "file2", "file3"}).Times(1).Return([]ApplyAttempt{}, []ApplyAttempt{}),
 		clock.EXPECT().Now().Times(1).Return(time.Time{}),
+		repo.EXPECT().DiffStat("hash0", "hash1").Times(1).Return("stat", nil),
 	)
 	expectedResult = Result{
-		1,
-		QuickRun,
-		time.Time{},
-		time.Time{},
-		"hash1",
-		"log",
-		[]string{"black1", "black2"},
-		[]string{},
-		[]ApplyAttempt{},
-		[]ApplyAttempt{},
-		"",
+		RunID:              1,
+		RunType:            QuickRun,
+		Start:              time.Time{},
+		Finish:             time.Time{},
+		CommitHash:         "hash1",
+		PreviousCommitHash: "hash0",
+		ChangedFiles:       []string{"file1", "file2", "file3"},
+		FullCommit:         "log",
+		Blacklist:          []string{"black1", "black2"},
+		Whitelist:          []string{},
+		Successes:          []ApplyAttempt{},
+		Failures:           []ApplyAttempt{},
+		DiffURLFormat:      "",
+		DiffStat:           "stat",
 	}
 	quickRunQueue <- "hash1"
 	waitAndAssert(t, testCase{runResults, runMetrics, errors, expectedResult, nil})
@@ -301,17 +335,19 @@ func TestRunnerStartQuickLoop(t *testing.T) {
 		clock.EXPECT().Now().Times(1).Return(time.Time{}),
 	)
 	expectedResult = Result{
-		2,
-		QuickRun,
-		time.Time{},
-		time.Time{},
-		"hash2",
-		"log",
-		[]string{"black1", "black2"},
-		[]string{},
-		successes,
-		failures,
-		"",
+		RunID:              2,
+		RunType:            QuickRun,
+		Start:              time.Time{},
+		Finish:             time.Time{},
+		CommitHash:         "hash2",
+		PreviousCommitHash: "hash1",
+		ChangedFiles:       []string{"file1", "file2", "file3", "file4", "file5"},
+		FullCommit:         "log",
+		Blacklist:          []string{"black1", "black2"},
+		Whitelist:          []string{},
+		Successes:          successes,
+		Failures:           failures,
+		DiffURLFormat:      "",
 	}
 	quickRunQueue <- "hash2"
 	waitAndAssert(t, testCase{runResults, runMetrics, errors, expectedResult, nil})
@@ -336,17 +372,19 @@ func TestRunnerStartQuickLoop(t *testing.T) {
 		clock.EXPECT().Now().Times(1).Return(time.Time{}),
 	)
 	expectedResult = Result{
-		3,
-		QuickRun,
-		time.Time{},
-		time.Time{},
-		"hash3",
-		"log",
-		[]string{"black1", "black2"},
-		[]string{"file1", "file2", "file3", "file4", "file5"},
-		successes,
-		failures,
-		"",
+		RunID:              3,
+		RunType:            QuickRun,
+		Start:              time.Time{},
+		Finish:             time.Time{},
+		CommitHash:         "hash3",
+		PreviousCommitHash: "hash2",
+		ChangedFiles:       []string{"file1", "file2", "file3", "file4", "file5"},
+		FullCommit:         "log",
+		Blacklist:          []string{"black1", "black2"},
+		Whitelist:          []string{"file1", "file2", "file3", "file4", "file5"},
+		Successes:          successes,
+		Failures:           failures,
+		DiffURLFormat:      "",
 	}
 	quickRunQueue <- "hash3"
 	waitAndAssert(t, testCase{runResults, runMetrics, errors, expectedResult, nil})
@@ -387,6 +425,1588 @@ func TestRunnerStartQuickLoop(t *testing.T) {
 	waitAndAssert(t, testCase{runResults, runMetrics, errors, expectedResult, fmt.Errorf("log error")})
 }
 
+func TestRunnerValidateMode(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	clock := sysutil.NewMockClockInterface(mockCtrl)
+	repo := git.NewMockGitUtilInterface(mockCtrl)
+	batchApplier := NewMockBatchApplierInterface(mockCtrl)
+	factory := applylist.NewMockFactoryInterface(mockCtrl)
+
+	errors := make(chan error)
+	fullRunQueue := make(chan int, 1)
+	runResults := make(chan Result, 5)
+	runMetrics := make(chan Result, 5)
+	runCount := make(chan int)
+	r := Runner{
+		BatchApplier: batchApplier,
+		ListFactory:  factory,
+		GitUtil:      repo,
+		Clock:        clock,
+		ValidateMode: ValidateWarn,
+		FullRunQueue: fullRunQueue,
+		RunResults:   runResults,
+		RunMetrics:   runMetrics,
+		Errors:       errors,
+		RunCount:     runCount,
+	}
+
+	go r.StartRunCounter()
+	go r.StartFullLoop()
+
+	findings := []ApplyAttempt{
+		{"file2", "validate2", "output2", "error2"},
+	}
+
+	// Warn mode, findings are recorded but every file is applied
+	successes := []ApplyAttempt{
+		{"file1", "apply1", "cmd1", ""},
+		{"file2", "apply2", "cmd2", ""},
+	}
+	gomock.InOrder(
+		repo.EXPECT().HeadHash().Times(1).Return("hash", nil),
+		repo.EXPECT().ListAllFiles().Times(1).Return([]string{"file1", "file2"}, nil),
+		clock.EXPECT().Now().Times(1).Return(time.Time{}),
+		factory.EXPECT().Create([]string{"file1", "file2"}).Times(1).Return([]string{"file1", "file2"}, []string{}, []string{}, nil),
+		repo.EXPECT().CommitLog("hash").Times(1).Return("log", nil),
+		batchApplier.EXPECT().Validate(0, []string{"file1", "file2"}).Times(1).Return(findings),
+		batchApplier.EXPECT().Apply(0, []string{"file1", "file2"}).Times(1).Return(successes, []ApplyAttempt{}),
+		clock.EXPECT().Now().Times(1).Return(time.Time{}),
+	)
+	expectedResult := Result{
+		RunID:              0,
+		RunType:            FullRun,
+		CommitHash:         "hash",
+		FullCommit:         "log",
+		Blacklist:          []string{},
+		Whitelist:          []string{},
+		Successes:          successes,
+		Failures:           []ApplyAttempt{},
+		ValidationFindings: findings,
+	}
+	fullRunQueue <- 0
+	waitAndAssert(t, testCase{runResults, runMetrics, errors, expectedResult, nil})
+
+	// Strict mode, files with findings are not applied and count as failures
+	r.ValidateMode = ValidateStrict
+	successes = []ApplyAttempt{
+		{"file1", "apply1", "cmd1", ""},
+	}
+	gomock.InOrder(
+		repo.EXPECT().HeadHash().Times(1).Return("hash", nil),
+		repo.EXPECT().ListAllFiles().Times(1).Return([]string{"file1", "file2"}, nil),
+		clock.EXPECT().Now().Times(1).Return(time.Time{}),
+		factory.EXPECT().Create([]string{"file1", "file2"}).Times(1).Return([]string{"file1", "file2"}, []string{}, []string{}, nil),
+		repo.EXPECT().CommitLog("hash").Times(1).Return("log", nil),
+		batchApplier.EXPECT().Validate(1, []string{"file1", "file2"}).Times(1).Return(findings),
+		batchApplier.EXPECT().Apply(1, []string{"file1"}).Times(1).Return(successes, []ApplyAttempt{}),
+		clock.EXPECT().Now().Times(1).Return(time.Time{}),
+	)
+	expectedResult = Result{
+		RunID:              1,
+		RunType:            FullRun,
+		CommitHash:         "hash",
+		FullCommit:         "log",
+		Blacklist:          []string{},
+		Whitelist:          []string{},
+		Successes:          successes,
+		Failures:           findings,
+		ValidationFindings: findings,
+	}
+	fullRunQueue <- 1
+	waitAndAssert(t, testCase{runResults, runMetrics, errors, expectedResult, nil})
+}
+
+func TestRunnerGuardrails(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	clock := sysutil.NewMockClockInterface(mockCtrl)
+	repo := git.NewMockGitUtilInterface(mockCtrl)
+	batchApplier := NewMockBatchApplierInterface(mockCtrl)
+	factory := applylist.NewMockFactoryInterface(mockCtrl)
+	guardrails := NewMockGuardrailsInterface(mockCtrl)
+
+	errors := make(chan error)
+	fullRunQueue := make(chan int, 1)
+	runResults := make(chan Result, 5)
+	runMetrics := make(chan Result, 5)
+	runCount := make(chan int)
+	r := Runner{
+		BatchApplier: batchApplier,
+		ListFactory:  factory,
+		GitUtil:      repo,
+		Clock:        clock,
+		Guardrails:   guardrails,
+		FullRunQueue: fullRunQueue,
+		RunResults:   runResults,
+		RunMetrics:   runMetrics,
+		Errors:       errors,
+		RunCount:     runCount,
+	}
+
+	go r.StartRunCounter()
+	go r.StartFullLoop()
+
+	// Files violating the guardrails are not applied and count as failures
+	violations := []ApplyAttempt{
+		{"file2", "", "", "violation2"},
+	}
+	successes := []ApplyAttempt{
+		{"file1", "apply1", "cmd1", ""},
+	}
+	gomock.InOrder(
+		repo.EXPECT().HeadHash().Times(1).Return("hash", nil),
+		repo.EXPECT().ListAllFiles().Times(1).Return([]string{"file1", "file2"}, nil),
+		clock.EXPECT().Now().Times(1).Return(time.Time{}),
+		factory.EXPECT().Create([]string{"file1", "file2"}).Times(1).Return([]string{"file1", "file2"}, []string{}, []string{}, nil),
+		repo.EXPECT().CommitLog("hash").Times(1).Return("log", nil),
+		guardrails.EXPECT().Check([]string{"file1", "file2"}).Times(1).Return(violations),
+		batchApplier.EXPECT().Apply(0, []string{"file1"}).Times(1).Return(successes, []ApplyAttempt{}),
+		clock.EXPECT().Now().Times(1).Return(time.Time{}),
+	)
+	expectedResult := Result{
+		RunID:      0,
+		RunType:    FullRun,
+		CommitHash: "hash",
+		FullCommit: "log",
+		Blacklist:  []string{},
+		Whitelist:  []string{},
+		Successes:  successes,
+		Failures:   violations,
+	}
+	fullRunQueue <- 0
+	waitAndAssert(t, testCase{runResults, runMetrics, errors, expectedResult, nil})
+}
+
+func TestRunnerPolicy(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	clock := sysutil.NewMockClockInterface(mockCtrl)
+	repo := git.NewMockGitUtilInterface(mockCtrl)
+	batchApplier := NewMockBatchApplierInterface(mockCtrl)
+	factory := applylist.NewMockFactoryInterface(mockCtrl)
+	guardrails := NewMockGuardrailsInterface(mockCtrl)
+	policy := NewMockPolicyInterface(mockCtrl)
+
+	errors := make(chan error)
+	fullRunQueue := make(chan int, 1)
+	runResults := make(chan Result, 5)
+	runMetrics := make(chan Result, 5)
+	runCount := make(chan int)
+	r := Runner{
+		BatchApplier: batchApplier,
+		ListFactory:  factory,
+		GitUtil:      repo,
+		Clock:        clock,
+		Guardrails:   guardrails,
+		Policy:       policy,
+		FullRunQueue: fullRunQueue,
+		RunResults:   runResults,
+		RunMetrics:   runMetrics,
+		Errors:       errors,
+		RunCount:     runCount,
+	}
+
+	go r.StartRunCounter()
+	go r.StartFullLoop()
+
+	// Files violating the guardrails are not checked against the policy, and files violating either are not applied
+	guardrailViolations := []ApplyAttempt{
+		{"file3", "", "", "violation3"},
+	}
+	policyViolations := []ApplyAttempt{
+		{"file2", "", "", "violation2"},
+	}
+	successes := []ApplyAttempt{
+		{"file1", "apply1", "cmd1", ""},
+	}
+	gomock.InOrder(
+		repo.EXPECT().HeadHash().Times(1).Return("hash", nil),
+		repo.EXPECT().ListAllFiles().Times(1).Return([]string{"file1", "file2", "file3"}, nil),
+		clock.EXPECT().Now().Times(1).Return(time.Time{}),
+		factory.EXPECT().Create([]string{"file1", "file2", "file3"}).Times(1).Return([]string{"file1", "file2", "file3"}, []string{}, []string{}, nil),
+		repo.EXPECT().CommitLog("hash").Times(1).Return("log", nil),
+		guardrails.EXPECT().Check([]string{"file1", "file2", "file3"}).Times(1).Return(guardrailViolations),
+		policy.EXPECT().Check(0, []string{"file1", "file2"}).Times(1).Return(policyViolations),
+		batchApplier.EXPECT().Apply(0, []string{"file1"}).Times(1).Return(successes, []ApplyAttempt{}),
+		clock.EXPECT().Now().Times(1).Return(time.Time{}),
+	)
+	expectedResult := Result{
+		RunID:      0,
+		RunType:    FullRun,
+		CommitHash: "hash",
+		FullCommit: "log",
+		Blacklist:  []string{},
+		Whitelist:  []string{},
+		Successes:  successes,
+		Failures:   append(guardrailViolations, policyViolations...),
+	}
+	fullRunQueue <- 0
+	waitAndAssert(t, testCase{runResults, runMetrics, errors, expectedResult, nil})
+}
+
+func TestRunnerReadOnly(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	clock := sysutil.NewMockClockInterface(mockCtrl)
+	repo := git.NewMockGitUtilInterface(mockCtrl)
+	batchApplier := NewMockBatchApplierInterface(mockCtrl)
+	factory := applylist.NewMockFactoryInterface(mockCtrl)
+
+	errors := make(chan error)
+	fullRunQueue := make(chan int, 1)
+	runResults := make(chan Result, 5)
+	runMetrics := make(chan Result, 5)
+	runCount := make(chan int)
+	readOnly := &ReadOnly{}
+	readOnly.Set(true)
+	r := Runner{
+		BatchApplier: batchApplier,
+		ListFactory:  factory,
+		GitUtil:      repo,
+		Clock:        clock,
+		ReadOnly:     readOnly,
+		FullRunQueue: fullRunQueue,
+		RunResults:   runResults,
+		RunMetrics:   runMetrics,
+		Errors:       errors,
+		RunCount:     runCount,
+	}
+
+	go r.StartRunCounter()
+	go r.StartFullLoop()
+
+	// Read-only mode, nothing is applied
+	gomock.InOrder(
+		repo.EXPECT().HeadHash().Times(1).Return("hash", nil),
+		repo.EXPECT().ListAllFiles().Times(1).Return([]string{"file1"}, nil),
+		clock.EXPECT().Now().Times(1).Return(time.Time{}),
+		factory.EXPECT().Create([]string{"file1"}).Times(1).Return([]string{"file1"}, []string{}, []string{}, nil),
+		repo.EXPECT().CommitLog("hash").Times(1).Return("log", nil),
+		clock.EXPECT().Now().Times(1).Return(time.Time{}),
+	)
+	expectedResult := Result{
+		RunID:      0,
+		RunType:    FullRun,
+		CommitHash: "hash",
+		FullCommit: "log",
+		Blacklist:  []string{},
+		Whitelist:  []string{},
+		Successes:  []ApplyAttempt{},
+		Failures:   []ApplyAttempt{},
+		ReadOnly:   true,
+	}
+	fullRunQueue <- 0
+	waitAndAssert(t, testCase{runResults, runMetrics, errors, expectedResult, nil})
+
+	// Read-only mode disabled, files are applied again
+	readOnly.Set(false)
+	successes := []ApplyAttempt{
+		{"file1", "apply1", "cmd1", ""},
+	}
+	gomock.InOrder(
+		repo.EXPECT().HeadHash().Times(1).Return("hash", nil),
+		repo.EXPECT().ListAllFiles().Times(1).Return([]string{"file1"}, nil),
+		clock.EXPECT().Now().Times(1).Return(time.Time{}),
+		factory.EXPECT().Create([]string{"file1"}).Times(1).Return([]string{"file1"}, []string{}, []string{}, nil),
+		repo.EXPECT().CommitLog("hash").Times(1).Return("log", nil),
+		batchApplier.EXPECT().Apply(1, []string{"file1"}).Times(1).Return(successes, []ApplyAttempt{}),
+		clock.EXPECT().Now().Times(1).Return(time.Time{}),
+	)
+	expectedResult = Result{
+		RunID:      1,
+		RunType:    FullRun,
+		CommitHash: "hash",
+		FullCommit: "log",
+		Blacklist:  []string{},
+		Whitelist:  []string{},
+		Successes:  successes,
+		Failures:   []ApplyAttempt{},
+	}
+	fullRunQueue <- 1
+	waitAndAssert(t, testCase{runResults, runMetrics, errors, expectedResult, nil})
+}
+
+func TestRunnerReadOnlyForcedRun(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	clock := sysutil.NewMockClockInterface(mockCtrl)
+	repo := git.NewMockGitUtilInterface(mockCtrl)
+	batchApplier := NewMockBatchApplierInterface(mockCtrl)
+	factory := applylist.NewMockFactoryInterface(mockCtrl)
+
+	errors := make(chan error)
+	fullRunQueue := make(chan int, 1)
+	runResults := make(chan Result, 5)
+	runMetrics := make(chan Result, 5)
+	runCount := make(chan int)
+	readOnly := &ReadOnly{}
+	readOnly.Set(true)
+	breaker := &CircuitBreaker{Threshold: 1}
+	breaker.Record(false)
+	r := Runner{
+		BatchApplier:   batchApplier,
+		ListFactory:    factory,
+		GitUtil:        repo,
+		Clock:          clock,
+		ReadOnly:       readOnly,
+		CircuitBreaker: breaker,
+		FullRunQueue:   fullRunQueue,
+		RunResults:     runResults,
+		RunMetrics:     runMetrics,
+		Errors:         errors,
+		RunCount:       runCount,
+	}
+
+	go r.StartRunCounter()
+	go r.StartFullLoop()
+
+	// The forced run is held back by read-only mode
+	breaker.Force()
+	gomock.InOrder(
+		repo.EXPECT().HeadHash().Times(1).Return("hash", nil),
+		repo.EXPECT().ListAllFiles().Times(1).Return([]string{"file1"}, nil),
+		clock.EXPECT().Now().Times(1).Return(time.Time{}),
+		factory.EXPECT().Create([]string{"file1"}).Times(1).Return([]string{"file1"}, []string{}, []string{}, nil),
+		repo.EXPECT().CommitLog("hash").Times(1).Return("log", nil),
+		clock.EXPECT().Now().Times(1).Return(time.Time{}),
+	)
+	expectedResult := Result{
+		RunID:      0,
+		RunType:    FullRun,
+		CommitHash: "hash",
+		FullCommit: "log",
+		Blacklist:  []string{},
+		Whitelist:  []string{},
+		Successes:  []ApplyAttempt{},
+		Failures:   []ApplyAttempt{},
+		ReadOnly:   true,
+	}
+	fullRunQueue <- 0
+	waitAndAssert(t, testCase{runResults, runMetrics, errors, expectedResult, nil})
+
+	// The force was used up, so the next scheduled run is still suspended
+	readOnly.Set(false)
+	gomock.InOrder(
+		repo.EXPECT().HeadHash().Times(1).Return("hash", nil),
+		repo.EXPECT().ListAllFiles().Times(1).Return([]string{"file1"}, nil),
+		clock.EXPECT().Now().Times(1).Return(time.Time{}),
+		factory.EXPECT().Create([]string{"file1"}).Times(1).Return([]string{"file1"}, []string{}, []string{}, nil),
+		repo.EXPECT().CommitLog("hash").Times(1).Return("log", nil),
+		clock.EXPECT().Now().Times(1).Return(time.Time{}),
+	)
+	expectedResult = Result{
+		RunID:      1,
+		RunType:    FullRun,
+		CommitHash: "hash",
+		FullCommit: "log",
+		Blacklist:  []string{},
+		Whitelist:  []string{},
+		Successes:  []ApplyAttempt{},
+		Failures:   []ApplyAttempt{},
+		Suspended:  true,
+	}
+	fullRunQueue <- 1
+	waitAndAssert(t, testCase{runResults, runMetrics, errors, expectedResult, nil})
+}
+
+func TestRunnerReadOnlyQuickRun(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	clock := sysutil.NewMockClockInterface(mockCtrl)
+	repo := git.NewMockGitUtilInterface(mockCtrl)
+	batchApplier := NewMockBatchApplierInterface(mockCtrl)
+	factory := applylist.NewMockFactoryInterface(mockCtrl)
+
+	errors := make(chan error)
+	quickRunQueue := make(chan string, 1)
+	runResults := make(chan Result, 5)
+	runMetrics := make(chan Result, 5)
+	runCount := make(chan int)
+	readOnly := &ReadOnly{}
+	readOnly.Set(true)
+	r := Runner{
+		BatchApplier:  batchApplier,
+		ListFactory:   factory,
+		GitUtil:       repo,
+		Clock:         clock,
+		ReadOnly:      readOnly,
+		QuickRunQueue: quickRunQueue,
+		RunResults:    runResults,
+		RunMetrics:    runMetrics,
+		Errors:        errors,
+		RunCount:      runCount,
+	}
+
+	go r.StartRunCounter()
+
+	repo.EXPECT().HeadHash().Times(1).Return("initHash", nil)
+	go r.StartQuickLoop()
+
+	// Read-only mode, nothing is applied and LastHash is kept
+	gomock.InOrder(
+		repo.EXPECT().ListDiffFiles("initHash", "hash0").Times(1).Return([]string{"file1"}, nil),
+		clock.EXPECT().Now().Times(1).Return(time.Time{}),
+		factory.EXPECT().Create([]string{"file1"}).Times(1).Return([]string{"file1"}, []string{}, []string{}, nil),
+		repo.EXPECT().CommitLog("hash0").Times(1).Return("log", nil),
+		clock.EXPECT().Now().Times(1).Return(time.Time{}),
+	)
+	expectedResult := Result{
+		RunID:              0,
+		RunType:            QuickRun,
+		CommitHash:         "hash0",
+		PreviousCommitHash: "initHash",
+		ChangedFiles:       []string{"file1"},
+		FullCommit:         "log",
+		Blacklist:          []string{},
+		Whitelist:          []string{},
+		Successes:          []ApplyAttempt{},
+		Failures:           []ApplyAttempt{},
+		ReadOnly:           true,
+	}
+	quickRunQueue <- "hash0"
+	waitAndAssert(t, testCase{runResults, runMetrics, errors, expectedResult, nil})
+	assert.Equal("initHash", r.LastHash)
+
+	// Read-only mode disabled, the files of both commits are applied
+	readOnly.Set(false)
+	successes := []ApplyAttempt{
+		{"file1", "apply1", "cmd1", ""},
+		{"file2", "apply2", "cmd2", ""},
+	}
+	gomock.InOrder(
+		repo.EXPECT().ListDiffFiles("initHash", "hash1").Times(1).Return([]string{"file1", "file2"}, nil),
+		clock.EXPECT().Now().Times(1).Return(time.Time{}),
+		factory.EXPECT().Create([]string{"file1", "file2"}).Times(1).Return([]string{"file1", "file2"}, []string{}, []string{}, nil),
+		repo.EXPECT().CommitLog("hash1").Times(1).Return("log", nil),
+		batchApplier.EXPECT().Apply(1, []string{"file1", "file2"}).Times(1).Return(successes, []ApplyAttempt{}),
+		clock.EXPECT().Now().Times(1).Return(time.Time{}),
+		repo.EXPECT().DiffStat("initHash", "hash1").Times(1).Return("stat", nil),
+	)
+	expectedResult = Result{
+		RunID:              1,
+		RunType:            QuickRun,
+		CommitHash:         "hash1",
+		PreviousCommitHash: "initHash",
+		ChangedFiles:       []string{"file1", "file2"},
+		FullCommit:         "log",
+		Blacklist:          []string{},
+		Whitelist:          []string{},
+		Successes:          successes,
+		Failures:           []ApplyAttempt{},
+		DiffStat:           "stat",
+	}
+	quickRunQueue <- "hash1"
+	waitAndAssert(t, testCase{runResults, runMetrics, errors, expectedResult, nil})
+	assert.Equal("hash1", r.LastHash)
+}
+
+func TestRunnerCircuitBreaker(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	clock := sysutil.NewMockClockInterface(mockCtrl)
+	repo := git.NewMockGitUtilInterface(mockCtrl)
+	batchApplier := NewMockBatchApplierInterface(mockCtrl)
+	factory := applylist.NewMockFactoryInterface(mockCtrl)
+
+	errors := make(chan error)
+	fullRunQueue := make(chan int, 1)
+	runResults := make(chan Result, 5)
+	runMetrics := make(chan Result, 5)
+	runCount := make(chan int)
+	breaker := &CircuitBreaker{Threshold: 1}
+	r := Runner{
+		BatchApplier:   batchApplier,
+		ListFactory:    factory,
+		GitUtil:        repo,
+		Clock:          clock,
+		CircuitBreaker: breaker,
+		FullRunQueue:   fullRunQueue,
+		RunResults:     runResults,
+		RunMetrics:     runMetrics,
+		Errors:         errors,
+		RunCount:       runCount,
+	}
+
+	go r.StartRunCounter()
+	go r.StartFullLoop()
+
+	// Failed run opens the breaker
+	failures := []ApplyAttempt{
+		{"file1", "apply1", "cmd1", "error1"},
+	}
+	gomock.InOrder(
+		repo.EXPECT().HeadHash().Times(1).Return("hash", nil),
+		repo.EXPECT().ListAllFiles().Times(1).Return([]string{"file1"}, nil),
+		clock.EXPECT().Now().Times(1).Return(time.Time{}),
+		factory.EXPECT().Create([]string{"file1"}).Times(1).Return([]string{"file1"}, []string{}, []string{}, nil),
+		repo.EXPECT().CommitLog("hash").Times(1).Return("log", nil),
+		batchApplier.EXPECT().Apply(0, []string{"file1"}).Times(1).Return([]ApplyAttempt{}, failures),
+		clock.EXPECT().Now().Times(1).Return(time.Time{}),
+	)
+	expectedResult := Result{
+		RunID:      0,
+		RunType:    FullRun,
+		CommitHash: "hash",
+		FullCommit: "log",
+		Blacklist:  []string{},
+		Whitelist:  []string{},
+		Successes:  []ApplyAttempt{},
+		Failures:   failures,
+	}
+	fullRunQueue <- 0
+	waitAndAssert(t, testCase{runResults, runMetrics, errors, expectedResult, nil})
+
+	// Next full run is suspended, nothing is applied
+	gomock.InOrder(
+		repo.EXPECT().HeadHash().Times(1).Return("hash", nil),
+		repo.EXPECT().ListAllFiles().Times(1).Return([]string{"file1"}, nil),
+		clock.EXPECT().Now().Times(1).Return(time.Time{}),
+		factory.EXPECT().Create([]string{"file1"}).Times(1).Return([]string{"file1"}, []string{}, []string{}, nil),
+		repo.EXPECT().CommitLog("hash").Times(1).Return("log", nil),
+		clock.EXPECT().Now().Times(1).Return(time.Time{}),
+	)
+	expectedResult = Result{
+		RunID:      1,
+		RunType:    FullRun,
+		CommitHash: "hash",
+		FullCommit: "log",
+		Blacklist:  []string{},
+		Whitelist:  []string{},
+		Successes:  []ApplyAttempt{},
+		Failures:   []ApplyAttempt{},
+		Suspended:  true,
+	}
+	fullRunQueue <- 1
+	waitAndAssert(t, testCase{runResults, runMetrics, errors, expectedResult, nil})
+
+	// Forced run goes ahead, and closes the breaker when it succeeds
+	breaker.Force()
+	successes := []ApplyAttempt{
+		{"file1", "apply1", "cmd1", ""},
+	}
+	gomock.InOrder(
+		repo.EXPECT().HeadHash().Times(1).Return("hash", nil),
+		repo.EXPECT().ListAllFiles().Times(1).Return([]string{"file1"}, nil),
+		clock.EXPECT().Now().Times(1).Return(time.Time{}),
+		factory.EXPECT().Create([]string{"file1"}).Times(1).Return([]string{"file1"}, []string{}, []string{}, nil),
+		repo.EXPECT().CommitLog("hash").Times(1).Return("log", nil),
+		batchApplier.EXPECT().Apply(2, []string{"file1"}).Times(1).Return(successes, []ApplyAttempt{}),
+		clock.EXPECT().Now().Times(1).Return(time.Time{}),
+	)
+	expectedResult = Result{
+		RunID:      2,
+		RunType:    FullRun,
+		CommitHash: "hash",
+		FullCommit: "log",
+		Blacklist:  []string{},
+		Whitelist:  []string{},
+		Successes:  successes,
+		Failures:   []ApplyAttempt{},
+	}
+	fullRunQueue <- 2
+	waitAndAssert(t, testCase{runResults, runMetrics, errors, expectedResult, nil})
+	assert.True(t, breaker.Allow())
+}
+
+func TestRunnerAuthorPolicy(t *testing.T) {
+	assert := assert.New(t)
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	clock := sysutil.NewMockClockInterface(mockCtrl)
+	repo := git.NewMockGitUtilInterface(mockCtrl)
+	batchApplier := NewMockBatchApplierInterface(mockCtrl)
+	factory := applylist.NewMockFactoryInterface(mockCtrl)
+
+	errors := make(chan error)
+	quickRunQueue := make(chan string, 1)
+	runResults := make(chan Result, 5)
+	runMetrics := make(chan Result, 5)
+	runCount := make(chan int)
+	r := Runner{
+		BatchApplier:  batchApplier,
+		ListFactory:   factory,
+		GitUtil:       repo,
+		Clock:         clock,
+		AuthorPolicy:  &AuthorPolicy{AllowedEmails: []string{"allowed@example.com"}},
+		QuickRunQueue: quickRunQueue,
+		RunResults:    runResults,
+		RunMetrics:    runMetrics,
+		Errors:        errors,
+		RunCount:      runCount,
+	}
+
+	go r.StartRunCounter()
+
+	repo.EXPECT().HeadHash().Times(1).Return("initHash", nil)
+	go r.StartQuickLoop()
+
+	// Commit from an allowed author is applied
+	successes := []ApplyAttempt{{"file1", "apply1", "cmd1", ""}}
+	gomock.InOrder(
+		repo.EXPECT().ListDiffFiles("initHash", "hash0").Times(1).Return([]string{"file1"}, nil),
+		clock.EXPECT().Now().Times(1).Return(time.Time{}),
+		factory.EXPECT().Create([]string{"file1"}).Times(1).Return([]string{"file1"}, []string{}, []string{}, nil),
+		repo.EXPECT().CommitLog("hash0").Times(1).Return("log", nil),
+		repo.EXPECT().CommitEmails("initHash", "hash0").Times(1).Return([][]string{{"allowed@example.com", "allowed@example.com"}}, nil),
+		batchApplier.EXPECT().Apply(0, []string{"file1"}).Times(1).Return(successes, []ApplyAttempt{}),
+		clock.EXPECT().Now().Times(1).Return(time.Time{}),
+		repo.EXPECT().DiffStat("initHash", "hash0").Times(1).Return("stat", nil),
+	)
+	expectedResult := Result{
+		RunID:              0,
+		RunType:            QuickRun,
+		CommitHash:         "hash0",
+		PreviousCommitHash: "initHash",
+		ChangedFiles:       []string{"file1"},
+		FullCommit:         "log",
+		Blacklist:          []string{},
+		Whitelist:          []string{},
+		Successes:          successes,
+		Failures:           []ApplyAttempt{},
+		DiffStat:           "stat",
+	}
+	quickRunQueue <- "hash0"
+	waitAndAssert(t, testCase{runResults, runMetrics, errors, expectedResult, nil})
+	assert.Equal("hash0", r.LastHash)
+
+	// Commit from another author is pending, LastHash is kept
+	gomock.InOrder(
+		repo.EXPECT().ListDiffFiles("hash0", "hash1").Times(1).Return([]string{"file2"}, nil),
+		clock.EXPECT().Now().Times(1).Return(time.Time{}),
+		factory.EXPECT().Create([]string{"file2"}).Times(1).Return([]string{"file2"}, []string{}, []string{}, nil),
+		repo.EXPECT().CommitLog("hash1").Times(1).Return("log", nil),
+		repo.EXPECT().CommitEmails("hash0", "hash1").Times(1).Return([][]string{{"other@example.com", "other@example.com"}}, nil),
+		clock.EXPECT().Now().Times(1).Return(time.Time{}),
+	)
+	expectedResult = Result{
+		RunID:              1,
+		RunType:            QuickRun,
+		CommitHash:         "hash1",
+		PreviousCommitHash: "hash0",
+		ChangedFiles:       []string{"file2"},
+		FullCommit:         "log",
+		Blacklist:          []string{},
+		Whitelist:          []string{},
+		Successes:          []ApplyAttempt{},
+		Failures:           []ApplyAttempt{},
+		PendingApproval:    true,
+	}
+	quickRunQueue <- "hash1"
+	waitAndAssert(t, testCase{runResults, runMetrics, errors, expectedResult, nil})
+	assert.Equal("hash0", r.LastHash)
+
+	// A later commit by an allowed committer does not approve the earlier commit, whose files it would apply too
+	gomock.InOrder(
+		repo.EXPECT().ListDiffFiles("hash0", "hash2").Times(1).Return([]string{"file2", "file3"}, nil),
+		clock.EXPECT().Now().Times(1).Return(time.Time{}),
+		factory.EXPECT().Create([]string{"file2", "file3"}).Times(1).Return([]string{"file2", "file3"}, []string{}, []string{}, nil),
+		repo.EXPECT().CommitLog("hash2").Times(1).Return("log", nil),
+		repo.EXPECT().CommitEmails("hash0", "hash2").Times(1).Return([][]string{
+			{"other@example.com", "allowed@example.com"},
+			{"other@example.com", "other@example.com"},
+		}, nil),
+		clock.EXPECT().Now().Times(1).Return(time.Time{}),
+	)
+	expectedResult = Result{
+		RunID:              2,
+		RunType:            QuickRun,
+		CommitHash:         "hash2",
+		PreviousCommitHash: "hash0",
+		ChangedFiles:       []string{"file2", "file3"},
+		FullCommit:         "log",
+		Blacklist:          []string{},
+		Whitelist:          []string{},
+		Successes:          []ApplyAttempt{},
+		Failures:           []ApplyAttempt{},
+		PendingApproval:    true,
+	}
+	quickRunQueue <- "hash2"
+	waitAndAssert(t, testCase{runResults, runMetrics, errors, expectedResult, nil})
+	assert.Equal("hash0", r.LastHash)
+}
+
+func TestRunnerApplyWindow(t *testing.T) {
+	assert := assert.New(t)
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	clock := sysutil.NewMockClockInterface(mockCtrl)
+	repo := git.NewMockGitUtilInterface(mockCtrl)
+	batchApplier := NewMockBatchApplierInterface(mockCtrl)
+	factory := applylist.NewMockFactoryInterface(mockCtrl)
+
+	errors := make(chan error)
+	quickRunQueue := make(chan string, 1)
+	runResults := make(chan Result, 5)
+	runMetrics := make(chan Result, 5)
+	runCount := make(chan int)
+	window, _ := ParseApplyWindow("Mon-Fri 09:00-17:00", time.UTC)
+	r := Runner{
+		BatchApplier:  batchApplier,
+		ListFactory:   factory,
+		GitUtil:       repo,
+		Clock:         clock,
+		ApplyWindow:   window,
+		QuickRunQueue: quickRunQueue,
+		RunResults:    runResults,
+		RunMetrics:    runMetrics,
+		Errors:        errors,
+		RunCount:      runCount,
+	}
+
+	go r.StartRunCounter()
+
+	repo.EXPECT().HeadHash().Times(1).Return("initHash", nil)
+	go r.StartQuickLoop()
+
+	// Outside of the window, nothing is applied and LastHash is kept
+	saturday := time.Date(2020, 1, 11, 12, 0, 0, 0, time.UTC)
+	gomock.InOrder(
+		repo.EXPECT().ListDiffFiles("initHash", "hash0").Times(1).Return([]string{"file1"}, nil),
+		clock.EXPECT().Now().Times(1).Return(saturday),
+		factory.EXPECT().Create([]string{"file1"}).Times(1).Return([]string{"file1"}, []string{}, []string{}, nil),
+		repo.EXPECT().CommitLog("hash0").Times(1).Return("log", nil),
+		clock.EXPECT().Now().Times(1).Return(saturday),
+	)
+	expectedResult := Result{
+		RunID:              0,
+		RunType:            QuickRun,
+		Start:              saturday,
+		Finish:             saturday,
+		CommitHash:         "hash0",
+		PreviousCommitHash: "initHash",
+		ChangedFiles:       []string{"file1"},
+		FullCommit:         "log",
+		Blacklist:          []string{},
+		Whitelist:          []string{},
+		Successes:          []ApplyAttempt{},
+		Failures:           []ApplyAttempt{},
+		OutsideApplyWindow: true,
+	}
+	quickRunQueue <- "hash0"
+	waitAndAssert(t, testCase{runResults, runMetrics, errors, expectedResult, nil})
+	assert.Equal("initHash", r.LastHash)
+
+	// Within the window, the files of both commits are applied
+	monday := time.Date(2020, 1, 13, 12, 0, 0, 0, time.UTC)
+	successes := []ApplyAttempt{
+		{"file1", "apply1", "cmd1", ""},
+		{"file2", "apply2", "cmd2", ""},
+	}
+	gomock.InOrder(
+		repo.EXPECT().ListDiffFiles("initHash", "hash1").Times(1).Return([]string{"file1", "file2"}, nil),
+		clock.EXPECT().Now().Times(1).Return(monday),
+		factory.EXPECT().Create([]string{"file1", "file2"}).Times(1).Return([]string{"file1", "file2"}, []string{}, []string{}, nil),
+		repo.EXPECT().CommitLog("hash1").Times(1).Return("log", nil),
+		batchApplier.EXPECT().Apply(1, []string{"file1", "file2"}).Times(1).Return(successes, []ApplyAttempt{}),
+		clock.EXPECT().Now().Times(1).Return(monday),
+		repo.EXPECT().DiffStat("initHash", "hash1").Times(1).Return("stat", nil),
+	)
+	expectedResult = Result{
+		RunID:              1,
+		RunType:            QuickRun,
+		Start:              monday,
+		Finish:             monday,
+		CommitHash:         "hash1",
+		PreviousCommitHash: "initHash",
+		ChangedFiles:       []string{"file1", "file2"},
+		FullCommit:         "log",
+		Blacklist:          []string{},
+		Whitelist:          []string{},
+		Successes:          successes,
+		Failures:           []ApplyAttempt{},
+		DiffStat:           "stat",
+	}
+	quickRunQueue <- "hash1"
+	waitAndAssert(t, testCase{runResults, runMetrics, errors, expectedResult, nil})
+	assert.Equal("hash1", r.LastHash)
+}
+
+func TestRunnerChangedFilesTruncated(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	clock := sysutil.NewMockClockInterface(mockCtrl)
+	repo := git.NewMockGitUtilInterface(mockCtrl)
+	batchApplier := NewMockBatchApplierInterface(mockCtrl)
+	factory := applylist.NewMockFactoryInterface(mockCtrl)
+
+	errors := make(chan error)
+	quickRunQueue := make(chan string, 1)
+	runResults := make(chan Result, 5)
+	runMetrics := make(chan Result, 5)
+	runCount := make(chan int)
+	r := Runner{
+		BatchApplier:  batchApplier,
+		ListFactory:   factory,
+		GitUtil:       repo,
+		Clock:         clock,
+		QuickRunQueue: quickRunQueue,
+		RunResults:    runResults,
+		RunMetrics:    runMetrics,
+		Errors:        errors,
+		RunCount:      runCount,
+	}
+
+	go r.StartRunCounter()
+
+	repo.EXPECT().HeadHash().Times(1).Return("initHash", nil)
+	go r.StartQuickLoop()
+
+	// Only the first maxChangedFiles changed files are recorded
+	changedFiles := []string{}
+	for i := 0; i < maxChangedFiles+2; i++ {
+		changedFiles = append(changedFiles, fmt.Sprintf("docs/file%d.md", i))
+	}
+	gomock.InOrder(
+		repo.EXPECT().ListDiffFiles("initHash", "hash0").Times(1).Return(changedFiles, nil),
+		clock.EXPECT().Now().Times(1).Return(time.Time{}),
+		factory.EXPECT().Create(changedFiles).Times(1).Return([]string{}, []string{}, []string{}, nil),
+		repo.EXPECT().CommitLog("hash0").Times(1).Return("log", nil),
+		batchApplier.EXPECT().Apply(0, []string{}).Times(1).Return([]ApplyAttempt{}, []ApplyAttempt{}),
+		clock.EXPECT().Now().Times(1).Return(time.Time{}),
+		repo.EXPECT().DiffStat("initHash", "hash0").Times(1).Return("stat", nil),
+	)
+	expectedResult := Result{
+		RunID:               0,
+		RunType:             QuickRun,
+		CommitHash:          "hash0",
+		PreviousCommitHash:  "initHash",
+		ChangedFiles:        changedFiles[:maxChangedFiles],
+		OmittedChangedFiles: 2,
+		FullCommit:          "log",
+		Blacklist:           []string{},
+		Whitelist:           []string{},
+		Successes:           []ApplyAttempt{},
+		Failures:            []ApplyAttempt{},
+		DiffStat:            "stat",
+	}
+	quickRunQueue <- "hash0"
+	waitAndAssert(t, testCase{runResults, runMetrics, errors, expectedResult, nil})
+}
+
+func TestRunnerOwnershipLabels(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	clock := sysutil.NewMockClockInterface(mockCtrl)
+	repo := git.NewMockGitUtilInterface(mockCtrl)
+	batchApplier := NewMockBatchApplierInterface(mockCtrl)
+	factory := applylist.NewMockFactoryInterface(mockCtrl)
+
+	errors := make(chan error)
+	fullRunQueue := make(chan int, 1)
+	runResults := make(chan Result, 5)
+	runMetrics := make(chan Result, 5)
+	runCount := make(chan int)
+	r := Runner{
+		BatchApplier:    batchApplier,
+		ListFactory:     factory,
+		GitUtil:         repo,
+		Clock:           clock,
+		OwnershipLabels: true,
+		FullRunQueue:    fullRunQueue,
+		RunResults:      runResults,
+		RunMetrics:      runMetrics,
+		Errors:          errors,
+		RunCount:        runCount,
+	}
+
+	go r.StartRunCounter()
+	go r.StartFullLoop()
+
+	// Only successfully applied files are labeled
+	successes := []ApplyAttempt{
+		{"file1", "apply1", "cmd1", ""},
+	}
+	failures := []ApplyAttempt{
+		{"file2", "apply2", "cmd2", "error2"},
+	}
+	gomock.InOrder(
+		repo.EXPECT().HeadHash().Times(1).Return("hash", nil),
+		repo.EXPECT().ListAllFiles().Times(1).Return([]string{"file1", "file2"}, nil),
+		clock.EXPECT().Now().Times(1).Return(time.Time{}),
+		factory.EXPECT().Create([]string{"file1", "file2"}).Times(1).Return([]string{"file1", "file2"}, []string{}, []string{}, nil),
+		repo.EXPECT().CommitLog("hash").Times(1).Return("log", nil),
+		batchApplier.EXPECT().Apply(0, []string{"file1", "file2"}).Times(1).Return(successes, failures),
+		batchApplier.EXPECT().Label(0, successes, map[string]string{CommitLabel: "hash"}).Times(1),
+		clock.EXPECT().Now().Times(1).Return(time.Time{}),
+	)
+	expectedResult := Result{
+		RunID:      0,
+		RunType:    FullRun,
+		CommitHash: "hash",
+		FullCommit: "log",
+		Blacklist:  []string{},
+		Whitelist:  []string{},
+		Successes:  successes,
+		Failures:   failures,
+	}
+	fullRunQueue <- 0
+	waitAndAssert(t, testCase{runResults, runMetrics, errors, expectedResult, nil})
+}
+
+func TestRunnerMinResources(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	clock := sysutil.NewMockClockInterface(mockCtrl)
+	repo := git.NewMockGitUtilInterface(mockCtrl)
+	batchApplier := NewMockBatchApplierInterface(mockCtrl)
+	factory := applylist.NewMockFactoryInterface(mockCtrl)
+
+	errors := make(chan error)
+	fullRunQueue := make(chan int, 1)
+	runResults := make(chan Result, 5)
+	runMetrics := make(chan Result, 5)
+	runCount := make(chan int)
+	r := Runner{
+		BatchApplier: batchApplier,
+		ListFactory:  factory,
+		GitUtil:      repo,
+		Clock:        clock,
+		MinResources: 3,
+		FullRunQueue: fullRunQueue,
+		RunResults:   runResults,
+		RunMetrics:   runMetrics,
+		Errors:       errors,
+		RunCount:     runCount,
+	}
+
+	go r.StartRunCounter()
+	go r.StartFullLoop()
+
+	// Only resources reported by kubectl for successfully applied files are counted
+	successes := []ApplyAttempt{
+		{"file1", "apply1", "deployment.apps/web configured\nservice/web unchanged", ""},
+	}
+	failures := []ApplyAttempt{
+		{"file2", "apply2", "configmap/web created", "error2"},
+	}
+	gomock.InOrder(
+		repo.EXPECT().HeadHash().Times(1).Return("hash", nil),
+		repo.EXPECT().ListAllFiles().Times(1).Return([]string{"file1", "file2"}, nil),
+		clock.EXPECT().Now().Times(1).Return(time.Time{}),
+		factory.EXPECT().Create([]string{"file1", "file2"}).Times(1).Return([]string{"file1", "file2"}, []string{}, []string{}, nil),
+		repo.EXPECT().CommitLog("hash").Times(1).Return("log", nil),
+		batchApplier.EXPECT().Apply(0, []string{"file1", "file2"}).Times(1).Return(successes, failures),
+		clock.EXPECT().Now().Times(1).Return(time.Time{}),
+	)
+	expectedResult := Result{
+		RunID:      0,
+		RunType:    FullRun,
+		CommitHash: "hash",
+		FullCommit: "log",
+		Blacklist:  []string{},
+		Whitelist:  []string{},
+		Successes:  successes,
+		Failures: []ApplyAttempt{
+			{"file2", "apply2", "configmap/web created", "error2"},
+			{minResourcesCheck, "", "", "Error: run applied 2 resources, fewer than the expected minimum of 3"},
+		},
+		ResourceActions: []ResourceActionCount{
+			{Kind: "configmap", Action: ActionCreated, Count: 1},
+			{Kind: "deployment.apps", Action: ActionConfigured, Count: 1},
+			{Kind: "service", Action: ActionUnchanged, Count: 1},
+		},
+	}
+	fullRunQueue <- 0
+	waitAndAssert(t, testCase{runResults, runMetrics, errors, expectedResult, nil})
+}
+
+func TestRunnerMinResourcesMaxOutputBytes(t *testing.T) {
+	assert := assert.New(t)
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	clock := sysutil.NewMockClockInterface(mockCtrl)
+	repo := git.NewMockGitUtilInterface(mockCtrl)
+	factory := applylist.NewMockFactoryInterface(mockCtrl)
+
+	// kubectl reports 50 resources, each after a warning, in far more output than MaxOutputBytes
+	dir, err := ioutil.TempDir("", "kubectl")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	kubectl := filepath.Join(dir, "kubectl")
+	script := `#!/bin/sh
+if [ "$1" = version ]; then
+  echo '{"clientVersion": {"major": "1", "minor": "20"}, "serverVersion": {"major": "1", "minor": "20"}}'
+  exit 0
+fi
+for i in $(seq 1 50); do
+  echo "Warning: resource configmaps/web-$i is missing the kubectl.kubernetes.io/last-applied-configuration annotation"
+  echo "configmap/web-$i configured"
+done
+`
+	assert.Nil(ioutil.WriteFile(kubectl, []byte(script), 0755))
+
+	errors := make(chan error)
+	fullRunQueue := make(chan int, 1)
+	runResults := make(chan Result, 5)
+	runMetrics := make(chan Result, 5)
+	runCount := make(chan int)
+	r := Runner{
+		BatchApplier: &BatchApplier{KubeClient: &kube.Client{KubectlPath: kubectl, LogLevel: -1, MaxOutputBytes: 500}},
+		ListFactory:  factory,
+		GitUtil:      repo,
+		Clock:        clock,
+		MinResources: 50,
+		FullRunQueue: fullRunQueue,
+		RunResults:   runResults,
+		RunMetrics:   runMetrics,
+		Errors:       errors,
+		RunCount:     runCount,
+	}
+
+	go r.StartRunCounter()
+	go r.StartFullLoop()
+
+	gomock.InOrder(
+		repo.EXPECT().HeadHash().Times(1).Return("hash", nil),
+		repo.EXPECT().ListAllFiles().Times(1).Return([]string{"file1"}, nil),
+		clock.EXPECT().Now().Times(1).Return(time.Time{}),
+		factory.EXPECT().Create([]string{"file1"}).Times(1).Return([]string{"file1"}, []string{}, []string{}, nil),
+		repo.EXPECT().CommitLog("hash").Times(1).Return("log", nil),
+		clock.EXPECT().Now().Times(1).Return(time.Time{}),
+	)
+	fullRunQueue <- 0
+
+	// The warnings in the middle of the output are omitted, but every resource line is kept and counted
+	select {
+	case result := <-runResults:
+		assert.Len(result.Successes, 1)
+		assert.Contains(result.Successes[0].Output, "bytes omitted, except")
+		assert.Empty(result.Failures)
+		assert.Equal([]ResourceActionCount{{Kind: "configmap", Action: ActionConfigured, Count: 50}}, result.ResourceActions)
+		<-runMetrics
+	case err := <-errors:
+		assert.Nil(err)
+	}
+}
+
+func TestRunnerManagedResources(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	clock := sysutil.NewMockClockInterface(mockCtrl)
+	repo := git.NewMockGitUtilInterface(mockCtrl)
+	batchApplier := NewMockBatchApplierInterface(mockCtrl)
+	factory := applylist.NewMockFactoryInterface(mockCtrl)
+	fs := sysutil.NewMockFileSystemInterface(mockCtrl)
+
+	errors := make(chan error)
+	fullRunQueue := make(chan int, 1)
+	runResults := make(chan Result, 5)
+	runMetrics := make(chan Result, 5)
+	runCount := make(chan int)
+	r := Runner{
+		BatchApplier: batchApplier,
+		ListFactory:  factory,
+		GitUtil:      repo,
+		FileSystem:   fs,
+		Clock:        clock,
+		FullRunQueue: fullRunQueue,
+		RunResults:   runResults,
+		RunMetrics:   runMetrics,
+		Errors:       errors,
+		RunCount:     runCount,
+	}
+
+	go r.StartRunCounter()
+	go r.StartFullLoop()
+
+	// Only the resources of successfully applied files are counted, by namespace and kind
+	successes := []ApplyAttempt{
+		{"file1", "apply1", "output1", ""},
+		{"file2", "apply2", "output2", ""},
+	}
+	failures := []ApplyAttempt{
+		{"file3", "apply3", "output3", "error3"},
+	}
+	fs.EXPECT().ReadFile("file1").Return([]byte(`kind: Deployment
+metadata:
+  namespace: team-b
+---
+kind: Service
+metadata:
+  namespace: team-b
+`), nil)
+	fs.EXPECT().ReadFile("file2").Return([]byte(`kind: Namespace
+---
+kind: Deployment
+metadata:
+  namespace: team-b
+---
+kind: Deployment
+metadata:
+  namespace: team-a
+`), nil)
+	gomock.InOrder(
+		repo.EXPECT().HeadHash().Times(1).Return("hash", nil),
+		repo.EXPECT().ListAllFiles().Times(1).Return([]string{"file1", "file2", "file3"}, nil),
+		clock.EXPECT().Now().Times(1).Return(time.Time{}),
+		factory.EXPECT().Create([]string{"file1", "file2", "file3"}).Times(1).Return([]string{"file1", "file2", "file3"}, []string{}, []string{}, nil),
+		repo.EXPECT().CommitLog("hash").Times(1).Return("log", nil),
+		batchApplier.EXPECT().Apply(0, []string{"file1", "file2", "file3"}).Times(1).Return(successes, failures),
+		clock.EXPECT().Now().Times(1).Return(time.Time{}),
+	)
+	expectedResult := Result{
+		RunID:      0,
+		RunType:    FullRun,
+		CommitHash: "hash",
+		FullCommit: "log",
+		Blacklist:  []string{},
+		Whitelist:  []string{},
+		Successes:  successes,
+		Failures:   failures,
+		ManagedResources: []ResourceCount{
+			{"", "Namespace", 1},
+			{"team-a", "Deployment", 1},
+			{"team-b", "Deployment", 2},
+			{"team-b", "Service", 1},
+		},
+	}
+	fullRunQueue <- 0
+	waitAndAssert(t, testCase{runResults, runMetrics, errors, expectedResult, nil})
+}
+
+func TestRunnerSkipMarkers(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	clock := sysutil.NewMockClockInterface(mockCtrl)
+	repo := git.NewMockGitUtilInterface(mockCtrl)
+	batchApplier := NewMockBatchApplierInterface(mockCtrl)
+	factory := applylist.NewMockFactoryInterface(mockCtrl)
+	fs := sysutil.NewMockFileSystemInterface(mockCtrl)
+
+	errors := make(chan error)
+	fullRunQueue := make(chan int, 1)
+	runResults := make(chan Result, 5)
+	runMetrics := make(chan Result, 5)
+	runCount := make(chan int)
+	r := Runner{
+		BatchApplier: batchApplier,
+		ListFactory:  factory,
+		GitUtil:      repo,
+		SkipMarkers:  &SkipMarkers{RepoPath: "/repo", FileSystem: fs},
+		Clock:        clock,
+		FullRunQueue: fullRunQueue,
+		RunResults:   runResults,
+		RunMetrics:   runMetrics,
+		Errors:       errors,
+		RunCount:     runCount,
+	}
+
+	go r.StartRunCounter()
+	go r.StartFullLoop()
+
+	// Files in a marked directory are left out of the apply and reported as skipped, not as failures
+	successes := []ApplyAttempt{
+		{"/repo/b/file2", "apply2", "output2", ""},
+	}
+	fs.EXPECT().FileExists("/repo/a/.kube-applier-skip").Return(true, nil)
+	fs.EXPECT().FileExists("/repo/b/.kube-applier-skip").Return(false, nil)
+	fs.EXPECT().FileExists("/repo/.kube-applier-skip").Return(false, nil)
+	gomock.InOrder(
+		repo.EXPECT().HeadHash().Times(1).Return("hash", nil),
+		repo.EXPECT().ListAllFiles().Times(1).Return([]string{"/repo/a/file1", "/repo/b/file2"}, nil),
+		clock.EXPECT().Now().Times(1).Return(time.Time{}),
+		factory.EXPECT().Create([]string{"/repo/a/file1", "/repo/b/file2"}).Times(1).Return([]string{"/repo/a/file1", "/repo/b/file2"}, []string{}, []string{}, nil),
+		repo.EXPECT().CommitLog("hash").Times(1).Return("log", nil),
+		batchApplier.EXPECT().Apply(0, []string{"/repo/b/file2"}).Times(1).Return(successes, []ApplyAttempt{}),
+		clock.EXPECT().Now().Times(1).Return(time.Time{}),
+	)
+	expectedResult := Result{
+		RunID:      0,
+		RunType:    FullRun,
+		CommitHash: "hash",
+		FullCommit: "log",
+		Blacklist:  []string{},
+		Whitelist:  []string{},
+		Successes:  successes,
+		Failures:   []ApplyAttempt{},
+		Skipped:    []ApplyAttempt{{FilePath: "/repo/a/file1", Output: "Skipped because of /repo/a/.kube-applier-skip"}},
+	}
+	fullRunQueue <- 0
+	waitAndAssert(t, testCase{runResults, runMetrics, errors, expectedResult, nil})
+}
+
+func TestRunnerTombstones(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	clock := sysutil.NewMockClockInterface(mockCtrl)
+	repo := git.NewMockGitUtilInterface(mockCtrl)
+	batchApplier := NewMockBatchApplierInterface(mockCtrl)
+	factory := applylist.NewMockFactoryInterface(mockCtrl)
+	fs := sysutil.NewMockFileSystemInterface(mockCtrl)
+
+	errors := make(chan error)
+	fullRunQueue := make(chan int, 1)
+	runResults := make(chan Result, 5)
+	runMetrics := make(chan Result, 5)
+	runCount := make(chan int)
+	r := Runner{
+		BatchApplier: batchApplier,
+		ListFactory:  factory,
+		GitUtil:      repo,
+		Tombstones:   &Tombstones{TTL: time.Hour, FileSystem: fs},
+		Clock:        clock,
+		FullRunQueue: fullRunQueue,
+		RunResults:   runResults,
+		RunMetrics:   runMetrics,
+		Errors:       errors,
+		RunCount:     runCount,
+	}
+
+	go r.StartRunCounter()
+	go r.StartFullLoop()
+
+	successes := []ApplyAttempt{
+		{"/repo/file1", "apply1", "output1", ""},
+		{"/repo/file2", "apply2", "output2", ""},
+	}
+	gomock.InOrder(
+		repo.EXPECT().HeadHash().Times(1).Return("hash", nil),
+		repo.EXPECT().ListAllFiles().Times(1).Return([]string{"/repo/file1", "/repo/file2"}, nil),
+		clock.EXPECT().Now().Times(1).Return(time.Time{}),
+		factory.EXPECT().Create([]string{"/repo/file1", "/repo/file2"}).Times(1).Return([]string{"/repo/file1", "/repo/file2"}, []string{}, []string{}, nil),
+		repo.EXPECT().CommitLog("hash").Times(1).Return("log", nil),
+		batchApplier.EXPECT().Apply(0, []string{"/repo/file1", "/repo/file2"}).Times(1).Return(successes, []ApplyAttempt{}),
+		clock.EXPECT().Now().Times(1).Return(time.Time{}),
+	)
+	expectedResult := Result{
+		RunID:      0,
+		RunType:    FullRun,
+		CommitHash: "hash",
+		FullCommit: "log",
+		Blacklist:  []string{},
+		Whitelist:  []string{},
+		Successes:  successes,
+		Failures:   []ApplyAttempt{},
+		Tombstones: []Tombstone{},
+	}
+	fullRunQueue <- 0
+	waitAndAssert(t, testCase{runResults, runMetrics, errors, expectedResult, nil})
+
+	// A file that was applied before and no longer exists gets a tombstone
+	deleted := time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC)
+	gomock.InOrder(
+		repo.EXPECT().HeadHash().Times(1).Return("hash2", nil),
+		repo.EXPECT().ListAllFiles().Times(1).Return([]string{"/repo/file1"}, nil),
+		clock.EXPECT().Now().Times(1).Return(deleted),
+		factory.EXPECT().Create([]string{"/repo/file1"}).Times(1).Return([]string{"/repo/file1"}, []string{}, []string{}, nil),
+		repo.EXPECT().CommitLog("hash2").Times(1).Return("log2", nil),
+		batchApplier.EXPECT().Apply(1, []string{"/repo/file1"}).Times(1).Return(successes[:1], []ApplyAttempt{}),
+		clock.EXPECT().Now().Times(1).Return(deleted),
+		fs.EXPECT().FileExists("/repo/file2").Times(1).Return(false, nil),
+	)
+	expectedResult = Result{
+		RunID:      1,
+		RunType:    FullRun,
+		Start:      deleted,
+		Finish:     deleted,
+		CommitHash: "hash2",
+		FullCommit: "log2",
+		Blacklist:  []string{},
+		Whitelist:  []string{},
+		Successes:  successes[:1],
+		Failures:   []ApplyAttempt{},
+		Tombstones: []Tombstone{{"/repo/file2", deleted, "hash2", true}},
+	}
+	fullRunQueue <- 1
+	waitAndAssert(t, testCase{runResults, runMetrics, errors, expectedResult, nil})
+}
+
+func TestRunnerResourceActionsBeforeTruncation(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	clock := sysutil.NewMockClockInterface(mockCtrl)
+	repo := git.NewMockGitUtilInterface(mockCtrl)
+	batchApplier := NewMockBatchApplierInterface(mockCtrl)
+	factory := applylist.NewMockFactoryInterface(mockCtrl)
+
+	errors := make(chan error)
+	fullRunQueue := make(chan int, 1)
+	runResults := make(chan Result, 5)
+	runMetrics := make(chan Result, 5)
+	runCount := make(chan int)
+	r := Runner{
+		BatchApplier:   batchApplier,
+		ListFactory:    factory,
+		GitUtil:        repo,
+		Clock:          clock,
+		MaxOutputLines: 2,
+		FullRunQueue:   fullRunQueue,
+		RunResults:     runResults,
+		RunMetrics:     runMetrics,
+		Errors:         errors,
+		RunCount:       runCount,
+	}
+
+	go r.StartRunCounter()
+	go r.StartFullLoop()
+
+	// The resources in the middle of the output are counted even though they are truncated
+	output := "configmap/a unchanged\nconfigmap/b configured\nconfigmap/c configured\nconfigmap/d unchanged\n"
+	gomock.InOrder(
+		repo.EXPECT().HeadHash().Times(1).Return("hash", nil),
+		repo.EXPECT().ListAllFiles().Times(1).Return([]string{"file1"}, nil),
+		clock.EXPECT().Now().Times(1).Return(time.Time{}),
+		factory.EXPECT().Create([]string{"file1"}).Times(1).Return([]string{"file1"}, []string{}, []string{}, nil),
+		repo.EXPECT().CommitLog("hash").Times(1).Return("log", nil),
+		batchApplier.EXPECT().Apply(0, []string{"file1"}).Times(1).Return([]ApplyAttempt{{"file1", "apply1", output, ""}}, []ApplyAttempt{}),
+		clock.EXPECT().Now().Times(1).Return(time.Time{}),
+	)
+	expectedResult := Result{
+		RunID:      0,
+		RunType:    FullRun,
+		CommitHash: "hash",
+		FullCommit: "log",
+		Blacklist:  []string{},
+		Whitelist:  []string{},
+		Successes:  []ApplyAttempt{{"file1", "apply1", truncateLines(output, 2), ""}},
+		Failures:   []ApplyAttempt{},
+		ResourceActions: []ResourceActionCount{
+			{Kind: "configmap", Action: ActionConfigured, Count: 2},
+			{Kind: "configmap", Action: ActionUnchanged, Count: 2},
+		},
+	}
+	fullRunQueue <- 0
+	waitAndAssert(t, testCase{runResults, runMetrics, errors, expectedResult, nil})
+}
+
+func TestRunnerDryRun(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	clock := sysutil.NewMockClockInterface(mockCtrl)
+	repo := git.NewMockGitUtilInterface(mockCtrl)
+	batchApplier := NewMockBatchApplierInterface(mockCtrl)
+	factory := applylist.NewMockFactoryInterface(mockCtrl)
+	hook := NewMockHookInterface(mockCtrl)
+
+	errors := make(chan error)
+	fullRunQueue := make(chan int, 1)
+	runResults := make(chan Result, 5)
+	runMetrics := make(chan Result, 5)
+	runCount := make(chan int)
+	readOnly := &ReadOnly{}
+	readOnly.Set(true)
+	circuitBreaker := &CircuitBreaker{Threshold: 1}
+	runQueue := &RunQueue{Clock: &sysutil.Clock{}}
+	r := Runner{
+		BatchApplier:   batchApplier,
+		ListFactory:    factory,
+		GitUtil:        repo,
+		Clock:          clock,
+		PostApplyHook:  hook,
+		WaitForRollout: true,
+		MinResources:   5,
+		ReadOnly:       readOnly,
+		CircuitBreaker: circuitBreaker,
+		History:        &History{Size: 10},
+		RunQueue:       runQueue,
+		FullRunQueue:   fullRunQueue,
+		RunResults:     runResults,
+		RunMetrics:     runMetrics,
+		Errors:         errors,
+		RunCount:       runCount,
+	}
+
+	go r.StartRunCounter()
+	go r.StartFullLoop()
+
+	// A dry run ignores read-only mode and only dry-runs the apply, skipping the rollout checks, the post-apply hook, the
+	// minimum resources check, the run history and the circuit breaker.
+	successes := []ApplyAttempt{{"file1", "dryrun1", "deployment.apps/web configured (server dry run)", ""}}
+	failures := []ApplyAttempt{{"file2", "dryrun2", "admission webhook denied the request", "error2"}}
+	gomock.InOrder(
+		repo.EXPECT().HeadHash().Times(1).Return("hash", nil),
+		repo.EXPECT().ListAllFiles().Times(1).Return([]string{"file1", "file2"}, nil),
+		clock.EXPECT().Now().Times(1).Return(time.Time{}),
+		factory.EXPECT().Create([]string{"file1", "file2"}).Times(1).Return([]string{"file1", "file2"}, []string{}, []string{}, nil),
+		repo.EXPECT().CommitLog("hash").Times(1).Return("log", nil),
+		batchApplier.EXPECT().DryRun(0, []string{"file1", "file2"}).Times(1).Return(successes, failures),
+		clock.EXPECT().Now().Times(1).Return(time.Time{}),
+	)
+	expectedResult := Result{
+		RunID:      0,
+		RunType:    FullRun,
+		CommitHash: "hash",
+		FullCommit: "log",
+		Blacklist:  []string{},
+		Whitelist:  []string{},
+		Successes:  successes,
+		Failures:   failures,
+		DryRun:     true,
+	}
+	runQueue.QueueFull(0, RunOptions{DryRun: true})
+	fullRunQueue <- 0
+	waitAndAssert(t, testCase{runResults, runMetrics, errors, expectedResult, nil})
+	assert.True(circuitBreaker.Allow())
+}
+
+func TestRunnerPreApplyHook(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	clock := sysutil.NewMockClockInterface(mockCtrl)
+	repo := git.NewMockGitUtilInterface(mockCtrl)
+	batchApplier := NewMockBatchApplierInterface(mockCtrl)
+	factory := applylist.NewMockFactoryInterface(mockCtrl)
+	hook := NewMockHookInterface(mockCtrl)
+
+	errors := make(chan error)
+	fullRunQueue := make(chan int, 1)
+	runResults := make(chan Result, 5)
+	runMetrics := make(chan Result, 5)
+	runCount := make(chan int)
+	r := Runner{
+		BatchApplier: batchApplier,
+		ListFactory:  factory,
+		GitUtil:      repo,
+		Clock:        clock,
+		PreApplyHook: hook,
+		FullRunQueue: fullRunQueue,
+		RunResults:   runResults,
+		RunMetrics:   runMetrics,
+		Errors:       errors,
+		RunCount:     runCount,
+	}
+
+	go r.StartRunCounter()
+	go r.StartFullLoop()
+
+	// Successful hook, files are applied
+	hookAttempt := ApplyAttempt{"/repo/hook.sh", "/repo/hook.sh", "ok", ""}
+	successes := []ApplyAttempt{
+		{"file1", "apply1", "cmd1", ""},
+	}
+	gomock.InOrder(
+		repo.EXPECT().HeadHash().Times(1).Return("hash", nil),
+		repo.EXPECT().ListAllFiles().Times(1).Return([]string{"file1"}, nil),
+		clock.EXPECT().Now().Times(1).Return(time.Time{}),
+		factory.EXPECT().Create([]string{"file1"}).Times(1).Return([]string{"file1"}, []string{}, []string{}, nil),
+		repo.EXPECT().CommitLog("hash").Times(1).Return("log", nil),
+		hook.EXPECT().Run(0, "hash").Times(1).Return(hookAttempt),
+		batchApplier.EXPECT().Apply(0, []string{"file1"}).Times(1).Return(successes, []ApplyAttempt{}),
+		clock.EXPECT().Now().Times(1).Return(time.Time{}),
+	)
+	expectedResult := Result{
+		RunID:        0,
+		RunType:      FullRun,
+		CommitHash:   "hash",
+		FullCommit:   "log",
+		Blacklist:    []string{},
+		Whitelist:    []string{},
+		Successes:    successes,
+		Failures:     []ApplyAttempt{},
+		PreApplyHook: &hookAttempt,
+	}
+	fullRunQueue <- 0
+	waitAndAssert(t, testCase{runResults, runMetrics, errors, expectedResult, nil})
+
+	// Failed hook, no files are applied and the hook is reported as a failure
+	failedHook := ApplyAttempt{"/repo/hook.sh", "/repo/hook.sh", "failed", "Error: exit status 1"}
+	gomock.InOrder(
+		repo.EXPECT().HeadHash().Times(1).Return("hash", nil),
+		repo.EXPECT().ListAllFiles().Times(1).Return([]string{"file1"}, nil),
+		clock.EXPECT().Now().Times(1).Return(time.Time{}),
+		factory.EXPECT().Create([]string{"file1"}).Times(1).Return([]string{"file1"}, []string{}, []string{}, nil),
+		repo.EXPECT().CommitLog("hash").Times(1).Return("log", nil),
+		hook.EXPECT().Run(1, "hash").Times(1).Return(failedHook),
+		clock.EXPECT().Now().Times(1).Return(time.Time{}),
+	)
+	expectedResult = Result{
+		RunID:        1,
+		RunType:      FullRun,
+		CommitHash:   "hash",
+		FullCommit:   "log",
+		Blacklist:    []string{},
+		Whitelist:    []string{},
+		Successes:    []ApplyAttempt{},
+		Failures:     []ApplyAttempt{failedHook},
+		PreApplyHook: &failedHook,
+	}
+	fullRunQueue <- 1
+	waitAndAssert(t, testCase{runResults, runMetrics, errors, expectedResult, nil})
+}
+
+func TestRunnerPostApplyHook(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	clock := sysutil.NewMockClockInterface(mockCtrl)
+	repo := git.NewMockGitUtilInterface(mockCtrl)
+	batchApplier := NewMockBatchApplierInterface(mockCtrl)
+	factory := applylist.NewMockFactoryInterface(mockCtrl)
+	hook := NewMockHookInterface(mockCtrl)
+
+	errors := make(chan error)
+	fullRunQueue := make(chan int, 1)
+	runResults := make(chan Result, 5)
+	runMetrics := make(chan Result, 5)
+	runCount := make(chan int)
+	r := Runner{
+		BatchApplier:  batchApplier,
+		ListFactory:   factory,
+		GitUtil:       repo,
+		Clock:         clock,
+		PostApplyHook: hook,
+		FullRunQueue:  fullRunQueue,
+		RunResults:    runResults,
+		RunMetrics:    runMetrics,
+		Errors:        errors,
+		RunCount:      runCount,
+	}
+
+	go r.StartRunCounter()
+	go r.StartFullLoop()
+
+	// Failed hook fails the run even though every file was applied
+	failedHook := ApplyAttempt{"/repo/verify.sh", "/repo/verify.sh", "unhealthy", "Error: exit status 1"}
+	successes := []ApplyAttempt{
+		{"file1", "apply1", "cmd1", ""},
+	}
+	gomock.InOrder(
+		repo.EXPECT().HeadHash().Times(1).Return("hash", nil),
+		repo.EXPECT().ListAllFiles().Times(1).Return([]string{"file1"}, nil),
+		clock.EXPECT().Now().Times(1).Return(time.Time{}),
+		factory.EXPECT().Create([]string{"file1"}).Times(1).Return([]string{"file1"}, []string{}, []string{}, nil),
+		repo.EXPECT().CommitLog("hash").Times(1).Return("log", nil),
+		batchApplier.EXPECT().Apply(0, []string{"file1"}).Times(1).Return(successes, []ApplyAttempt{}),
+		hook.EXPECT().Run(0, "hash").Times(1).Return(failedHook),
+		clock.EXPECT().Now().Times(1).Return(time.Time{}),
+	)
+	expectedResult := Result{
+		RunID:         0,
+		RunType:       FullRun,
+		CommitHash:    "hash",
+		FullCommit:    "log",
+		Blacklist:     []string{},
+		Whitelist:     []string{},
+		Successes:     successes,
+		Failures:      []ApplyAttempt{failedHook},
+		PostApplyHook: &failedHook,
+	}
+	fullRunQueue <- 0
+	waitAndAssert(t, testCase{runResults, runMetrics, errors, expectedResult, nil})
+}
+
 func waitAndAssert(t *testing.T, tc testCase) {
 	assert := assert.New(t)
 
@@ -2,19 +2,43 @@ package run
 
 import (
 	"github.com/box/kube-applier/git"
+	"github.com/box/kube-applier/sysutil"
 	"log"
+	"math/rand"
 	"time"
 )
 
 // Scheduler handles queueing apply runs at a given time interval and upon every new Git commit.
+// Full runs are assigned their run ID from RunCount when they are queued.
+// If Splay is set, the initial full run is delayed by a random duration up to Splay, so that many instances
+// restarting at the same time do not all hit the API server at once. If PollTicker or FullRunTicker is nil, it is started from
+// PollInterval or FullRunInterval after that delay, so that the later runs of these instances are spread out as well.
+// If RepoStatus is set, the result of every poll is recorded in it, and if RunQueue is set, every queued run is recorded in it.
+// If PollBackoffMax is set, polls are spaced out after consecutive failures, starting from PollInterval and doubling up to
+// PollBackoffMax, with jitter. Until polling recovers, runs apply the last good commit; if StaleGracePeriod is set, scheduled full
+// runs are no longer queued once polls have failed for longer than that.
 type Scheduler struct {
 	GitUtil        git.GitUtilInterface
 	PollTicker     <-chan time.Time
 	FullRunTicker  <-chan time.Time
 	QuickRunQueue  chan string
-	FullRunQueue   chan<- bool
+	FullRunQueue   chan<- int
+	RunCount       <-chan int
 	Errors         chan<- error
 	LastCommitHash string
+	Clock          sysutil.ClockInterface
+	Splay          time.Duration
+	RepoStatus     *RepoStatus
+	RunQueue       *RunQueue
+	// PollInterval and FullRunInterval are the intervals of PollTicker and FullRunTicker.
+	PollInterval     time.Duration
+	FullRunInterval  time.Duration
+	PollBackoffMax   time.Duration
+	StaleGracePeriod time.Duration
+	// Number of consecutive failed polls, the time of the first of them and the time before which the repo is not polled
+	failures   int
+	staleSince time.Time
+	nextPoll   time.Time
 }
 
 // Start runs a continuous loop with two tickers for queueing runs.
@@ -27,6 +51,21 @@ func (s *Scheduler) Start() {
 		return
 	}
 	s.LastCommitHash = hash
+	if s.RepoStatus != nil {
+		s.RepoStatus.Record(hash, s.Clock.Now(), nil)
+	}
+
+	if s.Splay > 0 {
+		delay := time.Duration(rand.Int63n(int64(s.Splay)))
+		log.Printf("Delaying initial full run by %v.", delay)
+		s.Clock.Sleep(delay)
+	}
+	if s.PollTicker == nil && s.PollInterval > 0 {
+		s.PollTicker = time.Tick(s.PollInterval)
+	}
+	if s.FullRunTicker == nil && s.FullRunInterval > 0 {
+		s.FullRunTicker = time.Tick(s.FullRunInterval)
+	}
 
 	log.Print("Queueing initial full run.")
 	s.enqueueFull()
@@ -34,11 +73,20 @@ func (s *Scheduler) Start() {
 	for {
 		select {
 		case <-s.PollTicker:
-			s.poll()
-			if err != nil {
-				s.Errors <- err
+			if s.failures > 0 && s.Clock.Now().Before(s.nextPoll) {
+				continue
+			}
+			if err := s.poll(); err != nil {
+				s.pollFailed(err)
+			} else if s.failures > 0 {
+				log.Printf("Polling the repo recovered after %v failed polls.", s.failures)
+				s.failures = 0
 			}
 		case <-s.FullRunTicker:
+			if s.StaleGracePeriod > 0 && s.failures > 0 && s.Clock.Now().Sub(s.staleSince) > s.StaleGracePeriod {
+				log.Printf("Full run interval reached, but the repo has not been polled successfully since %v, not queueing full run.", s.staleSince)
+				continue
+			}
 			log.Printf("Full run interval reached, queueing full run.")
 			s.enqueueFull()
 		}
@@ -49,6 +97,9 @@ func (s *Scheduler) Start() {
 // Any existing queued quick run is dequeued and replaced with the newer hash.
 func (s *Scheduler) poll() error {
 	newCommitHash, err := s.GitUtil.HeadHash()
+	if s.RepoStatus != nil {
+		s.RepoStatus.Record(newCommitHash, s.Clock.Now(), err)
+	}
 	if err != nil {
 		return err
 	}
@@ -63,6 +114,9 @@ func (s *Scheduler) poll() error {
 			log.Printf("Removed quick run queued with hash %v.", oldHash)
 		default:
 		}
+		if s.RunQueue != nil {
+			s.RunQueue.QueueQuick(newCommitHash)
+		}
 		s.QuickRunQueue <- newCommitHash
 		log.Printf("Queued quick run with hash %v.", newCommitHash)
 	}
@@ -70,12 +124,61 @@ func (s *Scheduler) poll() error {
 	return nil
 }
 
+// pollFailed logs a failed poll and, if PollBackoffMax is set, delays the next poll.
+// The delay doubles with every consecutive failure, and is randomized between half of it and all of it, so that many instances
+// polling a repo that is unavailable for all of them do not retry in lockstep.
+func (s *Scheduler) pollFailed(err error) {
+	now := s.Clock.Now()
+	if s.failures == 0 {
+		s.staleSince = now
+	}
+	s.failures++
+	log.Printf("Error polling the repo (%v consecutive failures), runs apply the last good commit %v: %v", s.failures, s.LastCommitHash, err)
+	if s.PollBackoffMax <= 0 || s.PollInterval <= 0 {
+		return
+	}
+	backoff := s.PollInterval
+	for i := 1; i < s.failures && backoff < s.PollBackoffMax; i++ {
+		backoff *= 2
+	}
+	if backoff > s.PollBackoffMax {
+		backoff = s.PollBackoffMax
+	}
+	backoff = backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+	s.nextPoll = now.Add(backoff)
+	log.Printf("Next poll in %v.", backoff)
+}
+
 // enqueueFull pushes a run request to the full run queue.
 func (s *Scheduler) enqueueFull() {
+	if id, ok := EnqueueFullRun(s.FullRunQueue, s.RunCount, s.RunQueue, RunOptions{}); ok {
+		log.Printf("Queued full run %v.", id)
+	} else {
+		log.Print("Full run queue already full.")
+	}
+}
+
+// EnqueueFullRun assigns the next run ID from runCount to a full run and pushes the ID to the queue.
+// It returns false if a full run is already queued, in which case no new run is queued.
+// If runQueue is set, the run is recorded in it with the given options before it is pushed, so that it is recorded before the
+// runner starts it. The options only take effect if runQueue is set, since the runner reads them from it.
+func EnqueueFullRun(queue chan<- int, runCount <-chan int, runQueue *RunQueue, options RunOptions) (id int, ok bool) {
+	// Check before taking an ID so that IDs are not used up while the queue is full.
+	if len(queue) == cap(queue) {
+		return 0, false
+	}
+	id = <-runCount
+	if runQueue != nil {
+		runQueue.QueueFull(id, options)
+	}
 	select {
-	case s.FullRunQueue <- true:
-		log.Print("Queued full run.")
+	case queue <- id:
+		return id, true
 	default:
-		log.Print("Full run queue already full.")
+		// Another full run was queued in the meantime, so this ID is skipped.
+		if runQueue != nil {
+			runQueue.Unqueue(id)
+		}
+		return 0, false
 	}
 }
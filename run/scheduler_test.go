@@ -3,6 +3,7 @@ package run
 import (
 	"fmt"
 	"github.com/box/kube-applier/git"
+	"github.com/box/kube-applier/sysutil"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
 	"testing"
@@ -20,11 +21,19 @@ func TestSchedulerPoll(t *testing.T) {
 	pollTicker := make(chan time.Time)
 	fullRunTicker := make(chan time.Time)
 	quickRunQueue := make(chan string, 1)
-	fullRunQueue := make(chan bool, 1)
+	fullRunQueue := make(chan int, 1)
 	errors := make(chan error, 1)
 	lastCommitHash := ""
 
-	s := &Scheduler{repo, pollTicker, fullRunTicker, quickRunQueue, fullRunQueue, errors, lastCommitHash}
+	s := &Scheduler{
+		GitUtil:        repo,
+		PollTicker:     pollTicker,
+		FullRunTicker:  fullRunTicker,
+		QuickRunQueue:  quickRunQueue,
+		FullRunQueue:   fullRunQueue,
+		Errors:         errors,
+		LastCommitHash: lastCommitHash,
+	}
 
 	// Cases for each call to s.poll()
 	gomock.InOrder(
@@ -94,19 +103,28 @@ func TestSchedulerEnqueueFull(t *testing.T) {
 	pollTicker := make(chan time.Time)
 	fullRunTicker := make(chan time.Time)
 	quickRunQueue := make(chan string, 1)
-	fullRunQueue := make(chan bool, 1)
+	fullRunQueue := make(chan int, 1)
 	errors := make(chan error, 1)
 	lastCommitHash := ""
 
-	s := &Scheduler{repo, pollTicker, fullRunTicker, quickRunQueue, fullRunQueue, errors, lastCommitHash}
+	s := &Scheduler{
+		GitUtil:        repo,
+		PollTicker:     pollTicker,
+		FullRunTicker:  fullRunTicker,
+		QuickRunQueue:  quickRunQueue,
+		FullRunQueue:   fullRunQueue,
+		RunCount:       startTestRunCounter(),
+		Errors:         errors,
+		LastCommitHash: lastCommitHash,
+	}
 
 	// Check queue is empty, queue full run, check queue is not empty.
 	assert.True(checkFullEmpty(fullRunQueue))
 	s.enqueueFull()
 	assert.False(checkFullEmpty(fullRunQueue))
 
-	// Empty queue and check queue is empty.
-	<-fullRunQueue
+	// Empty queue and check the run ID, then check queue is empty.
+	assert.Equal(0, <-fullRunQueue)
 	assert.True(checkFullEmpty(fullRunQueue))
 
 	// Queue full run, check queue is not empty.
@@ -114,15 +132,114 @@ func TestSchedulerEnqueueFull(t *testing.T) {
 	assert.False(checkFullEmpty(fullRunQueue))
 
 	// Queue multiple full runs.
-	// There should still only be one run in the queue.
+	// There should still only be one run in the queue, and no run IDs are used up by the rejected runs.
 	s.enqueueFull()
 	s.enqueueFull()
 	s.enqueueFull()
 
 	// Pop one run and check queue is empty.
-	<-fullRunQueue
+	assert.Equal(1, <-fullRunQueue)
 	assert.True(checkFullEmpty(fullRunQueue))
 
+	s.enqueueFull()
+	assert.Equal(2, <-fullRunQueue)
+
+	// Queued full runs are recorded
+	clock := sysutil.NewMockClockInterface(mockCtrl)
+	clock.EXPECT().Now().Times(1).Return(time.Unix(1, 0))
+	s.RunQueue = &RunQueue{Clock: clock}
+	s.enqueueFull()
+	s.enqueueFull()
+	assert.Equal([]QueuedRun{{RunType: FullRun, RunID: 3, Queued: time.Unix(1, 0)}}, s.RunQueue.State().Queued)
+	assert.Equal(3, <-fullRunQueue)
+}
+
+// TestSchedulerStartSplay tests that the initial full run is queued after sleeping for less than the configured splay.
+func TestSchedulerStartSplay(t *testing.T) {
+	assert := assert.New(t)
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	repo := git.NewMockGitUtilInterface(mockCtrl)
+	clock := sysutil.NewMockClockInterface(mockCtrl)
+	fullRunQueue := make(chan int, 1)
+	errors := make(chan error, 1)
+
+	s := &Scheduler{
+		GitUtil:       repo,
+		PollTicker:    make(chan time.Time),
+		FullRunTicker: make(chan time.Time),
+		QuickRunQueue: make(chan string, 1),
+		FullRunQueue:  fullRunQueue,
+		RunCount:      startTestRunCounter(),
+		Errors:        errors,
+		Clock:         clock,
+		Splay:         time.Minute,
+	}
+
+	var slept time.Duration
+	gomock.InOrder(
+		repo.EXPECT().HeadHash().Times(1).Return("hash0", nil),
+		clock.EXPECT().Sleep(gomock.Any()).Times(1).Do(func(d time.Duration) { slept = d }),
+	)
+
+	go s.Start()
+	<-fullRunQueue
+	assert.True(slept >= 0 && slept < time.Minute)
+	assert.Equal("hash0", s.LastCommitHash)
+}
+
+// TestSchedulerStartSplayTickers tests that tickers that are not given are started after the splay, so that scheduled full runs
+// are offset by it as well.
+func TestSchedulerStartSplayTickers(t *testing.T) {
+	assert := assert.New(t)
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	repo := git.NewMockGitUtilInterface(mockCtrl)
+	clock := sysutil.NewMockClockInterface(mockCtrl)
+	fullRunQueue := make(chan int, 1)
+	errors := make(chan error, 1)
+
+	s := &Scheduler{
+		GitUtil:         repo,
+		QuickRunQueue:   make(chan string, 1),
+		FullRunQueue:    fullRunQueue,
+		RunCount:        startTestRunCounter(),
+		Errors:          errors,
+		Clock:           clock,
+		Splay:           time.Minute,
+		PollInterval:    time.Hour,
+		FullRunInterval: 10 * time.Millisecond,
+	}
+
+	gomock.InOrder(
+		repo.EXPECT().HeadHash().Times(1).Return("hash0", nil),
+		clock.EXPECT().Sleep(gomock.Any()).Times(1).Do(func(time.Duration) {
+			assert.Nil(s.PollTicker)
+			assert.Nil(s.FullRunTicker)
+		}),
+	)
+
+	go s.Start()
+	assert.Equal(0, <-fullRunQueue)
+	select {
+	case id := <-fullRunQueue:
+		assert.Equal(1, id)
+	case <-time.After(time.Second):
+		t.Error("Scheduled full run was not queued")
+	}
+}
+
+// Return a channel that yields increasing run IDs, starting at 0.
+func startTestRunCounter() <-chan int {
+	runCount := make(chan int)
+	go func() {
+		for count := 0; ; count++ {
+			runCount <- count
+		}
+	}()
+	return runCount
 }
 
 // Return true if the queue is empty. If not empty, put the item back and return false.
@@ -138,7 +255,7 @@ func checkQuickEmpty(queue chan string) bool {
 }
 
 // Return true if the queue is empty. If not empty, put the item back and return false.
-func checkFullEmpty(queue chan bool) bool {
+func checkFullEmpty(queue chan int) bool {
 	empty := false
 	select {
 	case val := <-queue:
@@ -148,3 +265,29 @@ func checkFullEmpty(queue chan bool) bool {
 	}
 	return empty
 }
+
+func TestSchedulerPollFailed(t *testing.T) {
+	assert := assert.New(t)
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	clock := sysutil.NewMockClockInterface(mockCtrl)
+	s := &Scheduler{Clock: clock, PollInterval: 10 * time.Second, PollBackoffMax: 60 * time.Second}
+
+	// The delay doubles with every failure, up to PollBackoffMax, and is randomized between half of it and all of it
+	now := time.Unix(1000, 0)
+	clock.EXPECT().Now().AnyTimes().Return(now)
+	for _, max := range []time.Duration{10, 20, 40, 60, 60} {
+		s.pollFailed(fmt.Errorf("git error"))
+		assert.Equal(now, s.staleSince)
+		delay := s.nextPoll.Sub(now)
+		assert.True(delay >= max*time.Second/2 && delay <= max*time.Second, "delay %v is not within %v", delay, max*time.Second)
+	}
+	assert.Equal(5, s.failures)
+
+	// Without PollBackoffMax, polls are not delayed
+	s = &Scheduler{Clock: clock, PollInterval: 10 * time.Second}
+	s.pollFailed(fmt.Errorf("git error"))
+	assert.True(s.nextPoll.IsZero())
+	assert.Equal(1, s.failures)
+}
@@ -0,0 +1,58 @@
+package run
+
+import (
+	"fmt"
+	"github.com/box/kube-applier/sysutil"
+	"log"
+	"path"
+	"strings"
+)
+
+// skipMarkerFile is the name of the marker file that stops kube-applier from applying the files of its directory.
+const skipMarkerFile = ".kube-applier-skip"
+
+// SkipMarkers finds the files to apply that are in a directory with a skip marker file, or below one, so that applying a part
+// of the repo can be stopped with a commit, e.g. in an emergency, without changing the cluster or kube-applier's configuration.
+// A marker in RepoPath itself stops every file from being applied.
+type SkipMarkers struct {
+	RepoPath   string
+	FileSystem sysutil.FileSystemInterface
+}
+
+// Check returns an ApplyAttempt naming the marker for each file in the apply list that must be skipped, in the order of the list.
+// Directories whose marker cannot be checked are logged and treated as unmarked.
+func (s *SkipMarkers) Check(id int, applyList []string) (skipped []ApplyAttempt) {
+	skipped = []ApplyAttempt{}
+	root := path.Clean(s.RepoPath)
+	markers := map[string]string{}
+	for _, file := range applyList {
+		if marker := s.marker(id, root, path.Dir(file), markers); marker != "" {
+			skipped = append(skipped, ApplyAttempt{FilePath: file, Output: fmt.Sprintf("Skipped because of %v", marker)})
+		}
+	}
+	return skipped
+}
+
+// marker returns the path of the marker that applies to dir, or an empty string if there is none.
+// Results are cached in markers by directory, as the files of a run usually share their directories.
+func (s *SkipMarkers) marker(id int, root, dir string, markers map[string]string) string {
+	if marker, ok := markers[dir]; ok {
+		return marker
+	}
+	if dir != root && !strings.HasPrefix(dir, root+"/") {
+		return ""
+	}
+	marker := path.Join(dir, skipMarkerFile)
+	exists, err := s.FileSystem.FileExists(marker)
+	if err != nil {
+		log.Printf("RUN %v: Error checking for skip marker: %v", id, err)
+	}
+	if !exists {
+		marker = ""
+		if dir != root {
+			marker = s.marker(id, root, path.Dir(dir), markers)
+		}
+	}
+	markers[dir] = marker
+	return marker
+}
@@ -0,0 +1,42 @@
+package run
+
+import (
+	"fmt"
+	"github.com/box/kube-applier/sysutil"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSkipMarkersCheck(t *testing.T) {
+	assert := assert.New(t)
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	fs := sysutil.NewMockFileSystemInterface(mockCtrl)
+	s := &SkipMarkers{RepoPath: "/repo/", FileSystem: fs}
+
+	// Every directory is checked once, up to the root of the repo
+	fs.EXPECT().FileExists("/repo/a/.kube-applier-skip").Times(1).Return(true, nil)
+	fs.EXPECT().FileExists("/repo/b/c/.kube-applier-skip").Times(1).Return(false, nil)
+	fs.EXPECT().FileExists("/repo/b/.kube-applier-skip").Times(1).Return(true, nil)
+	fs.EXPECT().FileExists("/repo/d/.kube-applier-skip").Times(1).Return(false, fmt.Errorf("permission denied"))
+	fs.EXPECT().FileExists("/repo/.kube-applier-skip").Times(1).Return(false, nil)
+
+	skipped := s.Check(0, []string{"/repo/a/x.yaml", "/repo/a/y.yaml", "/repo/b/c/z.yaml", "/repo/d/x.yaml", "/repo/x.yaml", "/other/x.yaml"})
+	assert.Equal([]ApplyAttempt{
+		{FilePath: "/repo/a/x.yaml", Output: "Skipped because of /repo/a/.kube-applier-skip"},
+		{FilePath: "/repo/a/y.yaml", Output: "Skipped because of /repo/a/.kube-applier-skip"},
+		{FilePath: "/repo/b/c/z.yaml", Output: "Skipped because of /repo/b/.kube-applier-skip"},
+	}, skipped)
+
+	// A marker at the root of the repo skips every file
+	fs.EXPECT().FileExists("/repo/a/.kube-applier-skip").Times(1).Return(false, nil)
+	fs.EXPECT().FileExists("/repo/.kube-applier-skip").Times(1).Return(true, nil)
+	skipped = s.Check(1, []string{"/repo/a/x.yaml", "/repo/x.yaml"})
+	assert.Equal([]ApplyAttempt{
+		{FilePath: "/repo/a/x.yaml", Output: "Skipped because of /repo/.kube-applier-skip"},
+		{FilePath: "/repo/x.yaml", Output: "Skipped because of /repo/.kube-applier-skip"},
+	}, skipped)
+
+	assert.Equal([]ApplyAttempt{}, s.Check(2, []string{}))
+}
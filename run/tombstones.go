@@ -0,0 +1,93 @@
+package run
+
+import (
+	"github.com/box/kube-applier/sysutil"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Tombstone records a file that was applied before and has since been deleted from the repo. kube-applier does not delete
+// objects from the cluster, so the objects of the file are left behind until they are deleted by hand.
+type Tombstone struct {
+	FilePath string
+	// Deleted is the time at which the deletion was noticed by a full run, and CommitHash the commit it applied.
+	Deleted    time.Time
+	CommitHash string
+	// Succeeded is true if the last apply of the file succeeded.
+	Succeeded bool
+}
+
+// FormattedDeleted returns the Deleted time in the format "YYYY-MM-DD hh:mm:ss -0000 GMT"
+func (t *Tombstone) FormattedDeleted() string {
+	return t.Deleted.Truncate(time.Second).String()
+}
+
+// Tombstones keeps a tombstone for TTL for each file that is deleted from the repo, so that accidental deletions are noticed
+// while the objects they leave behind in the cluster can still be traced back to them. Deletions are only noticed by full runs,
+// as quick runs do not see deleted files. It is shared between the quick and full run loops.
+type Tombstones struct {
+	TTL        time.Duration
+	FileSystem sysutil.FileSystemInterface
+	mu         sync.Mutex
+	// Whether the last apply of each file seen since startup succeeded
+	lastStatus map[string]bool
+	tombstones []Tombstone
+}
+
+// Record updates the last status of the files of a run from its successes and failures, and returns the tombstones that have
+// not expired, most recent first. files is the apply list of the run before any file was left out. On full runs, a file that
+// was applied before and is missing from files gets a tombstone if it no longer exists, while a file that was excluded, e.g. by
+// the blacklist, is forgotten. A file that is added back to the repo loses its tombstone.
+func (t *Tombstones) Record(id int, runType RunType, hash string, now time.Time, files []string, successes, failures []ApplyAttempt) []Tombstone {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.lastStatus == nil {
+		t.lastStatus = map[string]bool{}
+	}
+	listed := map[string]struct{}{}
+	for _, file := range files {
+		listed[file] = struct{}{}
+	}
+
+	kept := []Tombstone{}
+	for _, tombstone := range t.tombstones {
+		if _, ok := listed[tombstone.FilePath]; !ok && now.Sub(tombstone.Deleted) < t.TTL {
+			kept = append(kept, tombstone)
+		}
+	}
+	if runType == FullRun {
+		deleted := []Tombstone{}
+		for file, succeeded := range t.lastStatus {
+			if _, ok := listed[file]; ok {
+				continue
+			}
+			delete(t.lastStatus, file)
+			exists, err := t.FileSystem.FileExists(file)
+			if err != nil {
+				log.Printf("RUN %v: Error checking whether %v was deleted: %v", id, file, err)
+				continue
+			}
+			if !exists {
+				log.Printf("RUN %v: %v was deleted from the repo, its objects are left in the cluster.", id, file)
+				deleted = append(deleted, Tombstone{file, now, hash, succeeded})
+			}
+		}
+		sort.Slice(deleted, func(i, j int) bool { return deleted[i].FilePath < deleted[j].FilePath })
+		kept = append(deleted, kept...)
+	}
+	t.tombstones = kept
+
+	for _, a := range successes {
+		if _, ok := listed[a.FilePath]; ok {
+			t.lastStatus[a.FilePath] = true
+		}
+	}
+	for _, a := range failures {
+		if _, ok := listed[a.FilePath]; ok {
+			t.lastStatus[a.FilePath] = false
+		}
+	}
+	return append([]Tombstone{}, kept...)
+}
@@ -0,0 +1,44 @@
+package run
+
+import (
+	"github.com/box/kube-applier/sysutil"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestTombstonesRecord(t *testing.T) {
+	assert := assert.New(t)
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	fs := sysutil.NewMockFileSystemInterface(mockCtrl)
+	tombstones := &Tombstones{TTL: time.Hour, FileSystem: fs}
+	start := time.Date(2018, 1, 2, 3, 0, 0, 0, time.UTC)
+
+	a := ApplyAttempt{FilePath: "/repo/a.yaml"}
+	b := ApplyAttempt{FilePath: "/repo/b.yaml"}
+	c := ApplyAttempt{FilePath: "/repo/c.yaml"}
+	hook := ApplyAttempt{FilePath: "Pre-apply hook"}
+	assert.Equal([]Tombstone{}, tombstones.Record(0, FullRun, "hash0", start, []string{a.FilePath, b.FilePath, c.FilePath}, []ApplyAttempt{a, b}, []ApplyAttempt{c, hook}))
+
+	// Quick runs do not see deleted files
+	assert.Equal([]Tombstone{}, tombstones.Record(1, QuickRun, "hash1", start.Add(time.Minute), []string{a.FilePath}, []ApplyAttempt{a}, nil))
+
+	// b was blacklisted and is forgotten, c was deleted
+	fs.EXPECT().FileExists(b.FilePath).Times(1).Return(true, nil)
+	fs.EXPECT().FileExists(c.FilePath).Times(1).Return(false, nil)
+	deleted := tombstones.Record(2, FullRun, "hash2", start.Add(2*time.Minute), []string{a.FilePath}, []ApplyAttempt{a}, nil)
+	assert.Equal([]Tombstone{{c.FilePath, start.Add(2 * time.Minute), "hash2", false}}, deleted)
+
+	// Tombstones are kept by quick runs, and a is deleted
+	assert.Equal(deleted, tombstones.Record(3, QuickRun, "hash3", start.Add(3*time.Minute), []string{}, nil, nil))
+	fs.EXPECT().FileExists(a.FilePath).Times(1).Return(false, nil)
+	assert.Equal([]Tombstone{
+		{a.FilePath, start.Add(4 * time.Minute), "hash4", true},
+		{c.FilePath, start.Add(2 * time.Minute), "hash2", false},
+	}, tombstones.Record(4, FullRun, "hash4", start.Add(4*time.Minute), []string{}, nil, nil))
+
+	// c is added back, and a expires
+	assert.Equal([]Tombstone{}, tombstones.Record(5, FullRun, "hash5", start.Add(time.Hour+4*time.Minute), []string{c.FilePath}, []ApplyAttempt{c}, nil))
+}
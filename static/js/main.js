@@ -1,4 +1,5 @@
-// On button click, sends empty POST request to API endpoint for forcing a run and shows a relevant alert when a response is received.
+// On button click, sends a POST request to API endpoint for forcing a run and shows a relevant alert when a response is received.
+// If the dry run checkbox is checked, the run is only a dry run.
 $(document).ready(function() {
     $('#force-button').bind('click', function(){
         // Disable the button and close existing alert
@@ -9,20 +10,145 @@ $(document).ready(function() {
         $.ajax({
             type: 'POST',
             url: url,
-            data: {},
+            data: $('#dry-run-checkbox').is(':checked') ? {dryRun: true} : {},
             dataType: "json",
             success:function(data) {
                 showForceAlert(true, data.message)
                 $('#force-button').prop('disabled', false);
             },
-            error:function() {
-                showForceAlert(false, 'Server error attempting to force a run. See container logs for more info.')
+            error:function(xhr) {
+                if (xhr.responseJSON && xhr.responseJSON.message) {
+                    showForceAlert(false, xhr.responseJSON.message)
+                } else {
+                    showForceAlert(false, 'Server error attempting to force a run. See container logs for more info.')
+                }
                 $('#force-button').prop('disabled', false);
             }
         });
     });
 });
 
+// Reloads the page as soon as a run newer than the displayed one completes, by long-polling the status endpoint.
+$(document).ready(function() {
+    waitForRun($('body').data('run-id'));
+});
+
+function waitForRun(runID) {
+    $.ajax({
+        type: 'GET',
+        url: window.location.href + 'api/v1/status',
+        data: {after: runID},
+        dataType: "json",
+        success:function(data) {
+            if (data.RunID > runID) {
+                window.location.reload();
+            } else {
+                waitForRun(runID);
+            }
+        },
+        error:function() {
+            // Back off, e.g. while the container restarts or if the API requires authentication.
+            setTimeout(function() { waitForRun(runID); }, 30000);
+        }
+    });
+}
+
+// Shows the state of kube-applier itself above the last run. The panel stays hidden if it cannot be fetched.
+$(document).ready(function() {
+    $.ajax({
+        type: 'GET',
+        url: window.location.href + 'api/v1/applier',
+        dataType: "json",
+        success:function(data) {
+            $('#applier-version').text(data.version);
+            $('#applier-config-hash').text(data.configHash);
+            $('#applier-started').text(new Date(data.started).toLocaleString());
+            var repo = data.repoHealthy ? 'healthy' : 'unhealthy';
+            if (data.repo.commit) {
+                repo += ', at commit ' + data.repo.commit;
+            }
+            if (data.repo.staleSince) {
+                repo += ', stale since ' + new Date(data.repo.staleSince).toLocaleString();
+            }
+            if (data.repo.lastError) {
+                repo += ', last poll failed: ' + data.repo.lastError;
+            }
+            $('#applier-repo').text(repo);
+            var queue = data.queued + ' queued, ' + data.running + ' running';
+            if (data.estimatedDrainSeconds > 0) {
+                queue += ', about ' + Math.ceil(data.estimatedDrainSeconds / 60) + ' min left';
+            }
+            $('#applier-queue').text(queue);
+            $('#applier-status').removeAttr('hidden');
+        }
+    });
+});
+
+// Warns about permissions kube-applier is missing to apply the repo, if they are checked.
+$(document).ready(function() {
+    $.ajax({
+        type: 'GET',
+        url: window.location.href + 'api/v1/rbac',
+        dataType: "json",
+        success:function(data) {
+            if (data.missing.length === 0) {
+                return;
+            }
+            $.each(data.missing, function(i, gap) {
+                var where = gap.namespace ? ' in namespace ' + gap.namespace : '';
+                var text = 'Cannot ' + gap.verb + ' ' + gap.kind + (gap.apiGroup !== 'core' ? '.' + gap.apiGroup : '') + where + ' (' + gap.files.join(', ') + ')';
+                if (gap.error) {
+                    text = 'Could not check ' + gap.verb + ' ' + gap.kind + where + ': ' + gap.error;
+                }
+                $('#rbac-missing').append($('<li>').text(text));
+            });
+            $('#rbac-status').removeAttr('hidden');
+        }
+    });
+});
+
+// Shows run times in the time zone selected by the user, which is remembered in a cookie.
+// By default, times are shown as formatted by the server.
+$(document).ready(function() {
+    var timezone = getCookie('timezone');
+    $('#timezone-select').val(timezone);
+    showTimes(timezone);
+    $('#timezone-select').bind('change', function() {
+        timezone = $(this).val();
+        document.cookie = 'timezone=' + encodeURIComponent(timezone) + '; path=/; max-age=31536000';
+        showTimes(timezone);
+    });
+});
+
+function showTimes(timezone) {
+    $('time.run-time').each(function() {
+        var time = $(this);
+        if (time.data('server-time') === undefined) {
+            time.data('server-time', time.text());
+        }
+        if (timezone === '') {
+            time.text(time.data('server-time'));
+            return;
+        }
+        var options = {year: 'numeric', month: '2-digit', day: '2-digit', hour: '2-digit', minute: '2-digit', second: '2-digit', hour12: false, timeZoneName: 'short'};
+        if (timezone !== 'local') {
+            options.timeZone = timezone;
+        }
+        time.text(new Date(time.attr('datetime')).toLocaleString(undefined, options));
+    });
+}
+
+function getCookie(name) {
+    var cookies = document.cookie.split('; ');
+    for (var i = 0; i < cookies.length; i++) {
+        var parts = cookies[i].split('=');
+        if (parts[0] === name) {
+            return decodeURIComponent(parts[1]);
+        }
+    }
+    return '';
+}
+
 // Show a relevant alert message, styled based on the "success" of the associated response.
 function showForceAlert(success, message) {
     alertClass = success ? 'success' : 'warning';
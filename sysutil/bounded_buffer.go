@@ -0,0 +1,99 @@
+package sysutil
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// BoundedBuffer is an io.Writer that keeps at most Max bytes of what is written to it: the first and last Max/2 bytes.
+// The bytes in between are counted and dropped as they are written, so that a command with a huge output cannot exhaust
+// the memory of the container. A Max of 0 or less keeps everything.
+// If Keep is set, the lines in between for which it returns true are kept as well, and the first and last bytes are cut at
+// line boundaries, so that the lines that are parsed from the output are never dropped or cut in half.
+type BoundedBuffer struct {
+	Max     int
+	Keep    func(line []byte) bool
+	head    []byte
+	tail    []byte
+	omitted int
+	// Kept lines and the incomplete line being dropped, if Keep is set
+	kept []byte
+	line []byte
+}
+
+// Write keeps p, or the parts of it that fit within Max. It never fails.
+func (b *BoundedBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if b.Max <= 0 {
+		b.head = append(b.head, p...)
+		return n, nil
+	}
+	if room := b.Max/2 - len(b.head); room > 0 {
+		if room > len(p) {
+			room = len(p)
+		}
+		b.head = append(b.head, p[:room]...)
+		p = p[room:]
+	}
+	tailMax := b.Max - b.Max/2
+	if len(p) >= tailMax {
+		b.drop(b.tail)
+		b.drop(p[:len(p)-tailMax])
+		b.tail = append(b.tail[:0], p[len(p)-tailMax:]...)
+		return n, nil
+	}
+	b.tail = append(b.tail, p...)
+	if excess := len(b.tail) - tailMax; excess > 0 {
+		b.drop(b.tail[:excess])
+		b.tail = b.tail[:copy(b.tail, b.tail[excess:])]
+	}
+	return n, nil
+}
+
+// drop counts the dropped bytes p and, if Keep is set, keeps the complete lines among them that it matches.
+func (b *BoundedBuffer) drop(p []byte) {
+	if len(p) == 0 {
+		return
+	}
+	if b.Keep != nil {
+		if b.omitted == 0 {
+			// The line cut by the end of head is checked in full
+			b.line = append(b.line, b.head[bytes.LastIndexByte(b.head, '\n')+1:]...)
+		}
+		b.line = append(b.line, p...)
+		for i := bytes.IndexByte(b.line, '\n'); i >= 0; i = bytes.IndexByte(b.line, '\n') {
+			if b.Keep(b.line[:i]) {
+				b.kept = append(b.kept, b.line[:i+1]...)
+			}
+			b.line = b.line[:copy(b.line, b.line[i+1:])]
+		}
+	}
+	b.omitted += len(p)
+}
+
+// Omitted returns the number of bytes that were dropped, including the kept lines.
+func (b *BoundedBuffer) Omitted() int {
+	return b.omitted
+}
+
+// String returns the kept output, with a note of how many bytes were omitted in between.
+func (b *BoundedBuffer) String() string {
+	if b.omitted == 0 {
+		return string(b.head) + string(b.tail)
+	}
+	if b.Keep == nil {
+		return fmt.Sprintf("%s\n... %d bytes omitted ...\n%s", b.head, b.omitted, b.tail)
+	}
+	head := b.head[:bytes.LastIndexByte(b.head, '\n')+1]
+	// The line cut by the start of tail is completed from the dropped bytes
+	end := bytes.IndexByte(b.tail, '\n') + 1
+	if end == 0 {
+		end = len(b.tail)
+	}
+	kept := b.kept
+	if line := append(append([]byte{}, b.line...), bytes.TrimSuffix(b.tail[:end], []byte("\n"))...); b.Keep(line) {
+		kept = append(append(append([]byte{}, kept...), line...), '\n')
+	}
+	omitted := b.omitted + len(b.head) - len(head) + end
+	return fmt.Sprintf("%s... %d bytes omitted, except %d kept lines ...\n%s%s", head, omitted, bytes.Count(kept, []byte("\n")), kept, b.tail[end:])
+}
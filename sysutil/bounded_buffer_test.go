@@ -0,0 +1,57 @@
+package sysutil
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestBoundedBuffer(t *testing.T) {
+	assert := assert.New(t)
+
+	// No limit
+	b := &BoundedBuffer{}
+	fmt.Fprint(b, strings.Repeat("a", 100))
+	assert.Equal(strings.Repeat("a", 100), b.String())
+
+	// Within the limit
+	b = &BoundedBuffer{Max: 10}
+	fmt.Fprint(b, "0123")
+	fmt.Fprint(b, "456789")
+	assert.Equal("0123456789", b.String())
+	assert.Equal(0, b.Omitted())
+
+	// The first and last bytes are kept across small writes
+	b = &BoundedBuffer{Max: 10}
+	for i := 0; i < 20; i++ {
+		fmt.Fprint(b, string(rune('a'+i)))
+	}
+	assert.Equal("abcde\n... 10 bytes omitted ...\npqrst", b.String())
+	assert.Equal(10, b.Omitted())
+
+	// A single write larger than the limit
+	b = &BoundedBuffer{Max: 10}
+	n, err := b.Write([]byte("abc"))
+	assert.Equal(3, n)
+	assert.Nil(err)
+	n, err = b.Write([]byte("defghijklmnopqrst"))
+	assert.Equal(17, n)
+	assert.Nil(err)
+	assert.Equal("abcde\n... 10 bytes omitted ...\npqrst", b.String())
+
+	// Kept lines are not dropped, and the first and last bytes are cut at line boundaries
+	keep := func(line []byte) bool { return strings.HasPrefix(string(line), "keep") }
+	b = &BoundedBuffer{Max: 20, Keep: keep}
+	fmt.Fprint(b, "first\nkeep 1\ndrop 1\n")
+	for i := 0; i < 10; i++ {
+		fmt.Fprint(b, "drop\n")
+	}
+	fmt.Fprint(b, "keep 2\ndrop 2\nkeep 3\nlast\n")
+	assert.Equal("first\n... 85 bytes omitted, except 3 kept lines ...\nkeep 1\nkeep 2\nkeep 3\nlast\n", b.String())
+
+	// A kept line without a final newline
+	b = &BoundedBuffer{Max: 8, Keep: keep}
+	fmt.Fprint(b, "a\ndrop\nkeep it")
+	assert.Equal("a\n... 12 bytes omitted, except 1 kept lines ...\nkeep it\n", b.String())
+}
@@ -0,0 +1,136 @@
+package sysutil
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v2"
+)
+
+// configFile holds the values of the config file loaded by LoadConfigFile, by environment variable name.
+var configFile = struct {
+	sync.Mutex
+	path   string
+	values map[string]string
+}{values: map[string]string{}}
+
+var (
+	configKeyPattern = regexp.MustCompile(`^[A-Z][A-Z0-9_]*$`)
+	secretKeyPattern = regexp.MustCompile(`SECRET|TOKEN|PASSWORD`)
+)
+
+// redacted replaces the values of secrets in the effective configuration.
+const redacted = "REDACTED"
+
+// LoadConfigFile loads the YAML config file located at path, which maps the names of the environment variables kube-applier
+// reads to their values, e.g. "POLL_INTERVAL_SECONDS: 10". Lists are joined with commas like the comma-separated variables.
+// Environment variables that are set take precedence over the file, so that a shared file can be overridden per deployment.
+func LoadConfigFile(path string) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("Error reading config file %v: %v", path, err)
+	}
+	raw := map[string]interface{}{}
+	if err := yaml.Unmarshal(content, &raw); err != nil {
+		return fmt.Errorf("Invalid config file %v: %v", path, err)
+	}
+	values := map[string]string{}
+	for key, value := range raw {
+		if !configKeyPattern.MatchString(key) {
+			return fmt.Errorf("Invalid config file %v: key %q must be the name of an environment variable, e.g. POLL_INTERVAL_SECONDS", path, key)
+		}
+		s, err := configString(value)
+		if err != nil {
+			return fmt.Errorf("Invalid config file %v: %v %v", path, key, err)
+		}
+		values[key] = s
+	}
+	configFile.Lock()
+	defer configFile.Unlock()
+	configFile.path, configFile.values = path, values
+	return nil
+}
+
+// configString converts a value of the config file to the string an environment variable would hold.
+func configString(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string, bool, int, float64:
+		return fmt.Sprint(v), nil
+	case []interface{}:
+		elements := make([]string, 0, len(v))
+		for _, e := range v {
+			s, err := configString(e)
+			if err != nil || strings.Contains(s, ",") {
+				return "", fmt.Errorf("must be a list of values without commas")
+			}
+			elements = append(elements, s)
+		}
+		return strings.Join(elements, ","), nil
+	}
+	return "", fmt.Errorf("must be a string, number, boolean or list, not %T", value)
+}
+
+// ConfigValue returns the value of the environment variable, or of the config file if it is not set, without recording it
+// like the GetEnv functions do.
+func ConfigValue(key string) string {
+	if env := os.Getenv(key); env != "" {
+		return env
+	}
+	configFile.Lock()
+	defer configFile.Unlock()
+	return configFile.values[key]
+}
+
+// UnknownConfigKeys returns the sorted keys of the config file that have not been read, which are most likely misspelled.
+// It is only meaningful once all the configuration has been read.
+func UnknownConfigKeys() []string {
+	configFile.Lock()
+	defer configFile.Unlock()
+	readKeys.Lock()
+	defer readKeys.Unlock()
+	unknown := []string{}
+	for key := range configFile.values {
+		if _, ok := readKeys.keys[key]; !ok {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
+
+// EffectiveConfig returns the non-empty values of the environment variables read through this package so far, whether they
+// were set in the environment or in the config file. The values of secrets, i.e. variables whose name contains SECRET,
+// TOKEN or PASSWORD other than paths, and the passwords in URLs are redacted.
+func EffectiveConfig() map[string]string {
+	readKeys.Lock()
+	keys := make([]string, 0, len(readKeys.keys))
+	for key := range readKeys.keys {
+		keys = append(keys, key)
+	}
+	readKeys.Unlock()
+	config := map[string]string{}
+	for _, key := range keys {
+		value := ConfigValue(key)
+		if value == "" {
+			continue
+		}
+		if secretKeyPattern.MatchString(key) && !strings.HasSuffix(key, "_PATH") {
+			value = redacted
+		} else if u, err := url.Parse(value); err == nil && u.User != nil {
+			if _, ok := u.User.Password(); ok {
+				u.User = url.UserPassword(u.User.Username(), redacted)
+				value = u.String()
+			}
+		}
+		config[key] = value
+	}
+	return config
+}
@@ -1,13 +1,48 @@
 package sysutil
 
 import (
+	"crypto/sha256"
+	"fmt"
 	"log"
-	"os"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 )
 
+// readKeys records the environment variables read through this package, so that ConfigHash covers exactly the configuration.
+var readKeys = struct {
+	sync.Mutex
+	keys map[string]struct{}
+}{keys: map[string]struct{}{}}
+
+// getenv returns the value of the environment variable, or of the config file if it is not set, and records that it was read.
+func getenv(key string) string {
+	readKeys.Lock()
+	defer readKeys.Unlock()
+	readKeys.keys[key] = struct{}{}
+	return ConfigValue(key)
+}
+
+// ConfigHash returns a short hash of the names and values of the environment variables read through this package so far,
+// to tell whether two instances run with the same configuration without exposing it.
+func ConfigHash() string {
+	readKeys.Lock()
+	defer readKeys.Unlock()
+	keys := make([]string, 0, len(readKeys.keys))
+	for key := range readKeys.keys {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	hash := sha256.New()
+	for _, key := range keys {
+		fmt.Fprintf(hash, "%s=%s\n", key, ConfigValue(key))
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil))[:12]
+}
+
 func GetRequiredEnvString(key string) string {
-	val := os.Getenv(key)
+	val := getenv(key)
 	if len(val) == 0 {
 		log.Fatalf("Error: Missing environment variable %v", key)
 	}
@@ -24,7 +59,7 @@ func GetRequiredEnvInt(key string) int {
 }
 
 func GetEnvIntOrDefault(key string, def int) int {
-	if env := os.Getenv(key); env != "" {
+	if env := getenv(key); env != "" {
 		val, err := strconv.Atoi(env)
 		if err != nil {
 			log.Printf("Invalid value for %v: using default: %v", key, def)
@@ -36,8 +71,35 @@ func GetEnvIntOrDefault(key string, def int) int {
 }
 
 func GetEnvStringOrDefault(key, def string) string {
-	if env := os.Getenv(key); env != "" {
+	if env := getenv(key); env != "" {
 		return env
 	}
 	return def
 }
+
+func GetEnvBoolOrDefault(key string, def bool) bool {
+	if env := getenv(key); env != "" {
+		val, err := strconv.ParseBool(env)
+		if err != nil {
+			log.Printf("Invalid value for %v: using default: %v", key, def)
+			return def
+		}
+		return val
+	}
+	return def
+}
+
+// GetEnvStringSliceOrDefault splits a comma-separated environment variable into its trimmed, non-empty elements.
+func GetEnvStringSliceOrDefault(key string, def []string) []string {
+	env := getenv(key)
+	if env == "" {
+		return def
+	}
+	result := []string{}
+	for _, s := range strings.Split(env, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			result = append(result, s)
+		}
+	}
+	return result
+}
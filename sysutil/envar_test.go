@@ -0,0 +1,27 @@
+package sysutil
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+func TestConfigHash(t *testing.T) {
+	assert := assert.New(t)
+
+	os.Setenv("KUBE_APPLIER_CONFIG_HASH_TEST", "a")
+	os.Setenv("KUBE_APPLIER_CONFIG_HASH_TEST_UNREAD", "a")
+	defer os.Unsetenv("KUBE_APPLIER_CONFIG_HASH_TEST")
+	defer os.Unsetenv("KUBE_APPLIER_CONFIG_HASH_TEST_UNREAD")
+
+	GetEnvStringOrDefault("KUBE_APPLIER_CONFIG_HASH_TEST", "")
+	hash := ConfigHash()
+	assert.Len(hash, 12)
+
+	// Only variables that were read are covered
+	os.Setenv("KUBE_APPLIER_CONFIG_HASH_TEST_UNREAD", "b")
+	assert.Equal(hash, ConfigHash())
+
+	os.Setenv("KUBE_APPLIER_CONFIG_HASH_TEST", "b")
+	assert.NotEqual(hash, ConfigHash())
+}
@@ -3,6 +3,7 @@ package sysutil
 import (
 	"bufio"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
 	"strings"
@@ -12,6 +13,8 @@ import (
 // FileSystemInterface allows for mocking out the functionality of FileSystem to avoid calls to the actual file system during testing.
 type FileSystemInterface interface {
 	ReadLines(filePath string) ([]string, error)
+	ReadFile(filePath string) ([]byte, error)
+	FileExists(filePath string) (bool, error)
 }
 
 // FileSystem provides utility functions for interacting with the file system.
@@ -36,6 +39,27 @@ func (fs *FileSystem) ReadLines(filePath string) ([]string, error) {
 	return result, nil
 }
 
+// ReadFile returns the contents of the file located at the path as they are, unlike ReadLines, which trims every line.
+// It must be used for YAML manifests, whose indentation is significant.
+func (fs *FileSystem) ReadFile(filePath string) ([]byte, error) {
+	content, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading the file at %v: %v", filePath, err)
+	}
+	return content, nil
+}
+
+// FileExists returns true if there is a file or directory located at the path.
+func (fs *FileSystem) FileExists(filePath string) (bool, error) {
+	if _, err := os.Stat(filePath); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("Error opening the file at %v: %v", filePath, err)
+	}
+	return true, nil
+}
+
 // WaitForDir returns when the specified directory is located in the filesystem, or if there is an error opening the directory once it is found.
 func WaitForDir(path string, clock ClockInterface, interval time.Duration) error {
 	log.Printf("Waiting for directory at %v...", path)
@@ -49,3 +49,25 @@ func (_m *MockFileSystemInterface) ReadLines(_param0 string) ([]string, error) {
 func (_mr *_MockFileSystemInterfaceRecorder) ReadLines(arg0 interface{}) *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "ReadLines", arg0)
 }
+
+func (_m *MockFileSystemInterface) ReadFile(_param0 string) ([]byte, error) {
+	ret := _m.ctrl.Call(_m, "ReadFile", _param0)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockFileSystemInterfaceRecorder) ReadFile(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "ReadFile", arg0)
+}
+
+func (_m *MockFileSystemInterface) FileExists(_param0 string) (bool, error) {
+	ret := _m.ctrl.Call(_m, "FileExists", _param0)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockFileSystemInterfaceRecorder) FileExists(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "FileExists", arg0)
+}
@@ -0,0 +1,64 @@
+package webserver
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/box/kube-applier/run"
+	"log"
+	"net/http"
+)
+
+// webhookSignatureHeader holds the HMAC-SHA256 of the request body, as "sha256=<hex digest>".
+const webhookSignatureHeader = "X-Kube-Applier-Signature"
+
+// Webhook posts the result of every completed run to URL, so that other systems can follow runs without polling the status API.
+// If Secret is set, requests are signed with it, so that the receiver can check that they were sent by kube-applier.
+type Webhook struct {
+	URL    string
+	Secret []byte
+	Client *http.Client
+}
+
+// webhookPayload is the body of a webhook request. Run is the same as the response of the status API.
+type webhookPayload struct {
+	Status string     `json:"status"`
+	Run    run.Result `json:"run"`
+}
+
+// Send posts the result of a run. Deliveries are not retried: a run that could not be delivered is logged, and can still be
+// read from the runs API.
+func (h *Webhook) Send(result run.Result) error {
+	body, err := json.Marshal(webhookPayload{runStatus(&result), result})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", h.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+	if len(h.Secret) > 0 {
+		req.Header.Set(webhookSignatureHeader, "sha256="+sign(h.Secret, body))
+	}
+	resp, err := h.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("Error: webhook returned %v", resp.Status)
+	}
+	log.Printf("RUN %v: Sent result to webhook", result.RunID)
+	return nil
+}
+
+// sign returns the hex-encoded HMAC-SHA256 of body with secret.
+func sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
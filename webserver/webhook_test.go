@@ -0,0 +1,47 @@
+package webserver
+
+import (
+	"encoding/json"
+	"github.com/box/kube-applier/run"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWebhookSend(t *testing.T) {
+	assert := assert.New(t)
+
+	var body []byte
+	var signature string
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = ioutil.ReadAll(r.Body)
+		signature = r.Header.Get(webhookSignatureHeader)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	result := run.Result{RunID: 3, RunType: run.FullRun, CommitHash: "hash", Failures: []run.ApplyAttempt{{FilePath: "file1"}}}
+	webhook := &Webhook{URL: server.URL, Client: server.Client()}
+	assert.Nil(webhook.Send(result))
+	assert.Equal("", signature)
+	var payload struct {
+		Status string     `json:"status"`
+		Run    run.Result `json:"run"`
+	}
+	assert.Nil(json.Unmarshal(body, &payload))
+	assert.Equal("failed", payload.Status)
+	assert.Equal(3, payload.Run.RunID)
+	assert.Equal("hash", payload.Run.CommitHash)
+
+	// Signed with HMAC-SHA256 of the body
+	webhook.Secret = []byte("secret")
+	assert.Nil(webhook.Send(run.Result{RunID: 4}))
+	assert.Equal("sha256="+sign([]byte("secret"), body), signature)
+	assert.Equal("dc46983557fea127b43af721467eb9b3fde2338fe3e14f51952aa8478c13d355", sign([]byte("secret"), []byte("body")))
+
+	status = http.StatusInternalServerError
+	assert.EqualError(webhook.Send(result), "Error: webhook returned 500 Internal Server Error")
+}
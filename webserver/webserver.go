@@ -1,24 +1,87 @@
 package webserver
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
+	"github.com/box/kube-applier/auth"
+	"github.com/box/kube-applier/git"
 	"github.com/box/kube-applier/run"
 	"github.com/box/kube-applier/sysutil"
 	"html/template"
+	"io"
+	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
-const serverTemplatePath = "/templates/status.html"
+const (
+	serverTemplatePath = "/templates/status.html"
 
+	// Number of most recent run results served by the runs endpoint.
+	retainedRuns = 50
+
+	runsPath = "/api/v1/runs/"
+
+	// Maximum time a status request with the "after" parameter waits for a new run result.
+	statusWaitTimeout = 30 * time.Second
+)
+
+// Error codes returned in the "code" field of API error responses.
+const (
+	codeInvalidMethod = "invalid_method"
+	codeQueueFull     = "queue_full"
+	codeInvalidRunID  = "invalid_run_id"
+	codeNotFound      = "not_found"
+	codeDriftFailed   = "drift_failed"
+	codeInvalidOption = "invalid_option"
+)
+
+// WebServer serves the status page, metrics and API.
+// If Authenticator is set, requests to the API endpoints must be authenticated by it, except for GET requests if AllowAnonymousReads is set.
+// If TLSCertPath and TLSKeyPath are set, the webserver serves HTTPS, and verifies client certificates against ClientCAPath if it is set.
+// If ListenAddress is set, the webserver listens on it instead of ListenPort on all interfaces, see listen.
+// If Location is set, run times are shown in it rather than in the time zone of the runner's clock.
+// TemplatePath overrides the path of the status page template, e.g. to serve it from the source tree during development.
+// If Webhook is set, the result of every run is sent to it once it has been annotated for the status API.
 type WebServer struct {
-	ListenPort     int
-	Clock          sysutil.ClockInterface
-	MetricsHandler http.Handler
-	FullRunQueue   chan<- bool
-	RunResults     <-chan run.Result
-	Errors         chan<- error
+	ListenPort          int
+	ListenAddress       string
+	Clock               sysutil.ClockInterface
+	MetricsHandler      http.Handler
+	FullRunQueue        chan<- int
+	RunCount            <-chan int
+	RunResults          <-chan run.Result
+	Errors              chan<- error
+	ReadOnly            *run.ReadOnly
+	CircuitBreaker      *run.CircuitBreaker
+	AuthorPolicy        *run.AuthorPolicy
+	ApplyWindow         *run.ApplyWindow
+	GitUtil             git.GitUtilInterface
+	RepoStatus          *run.RepoStatus
+	RunQueue            *run.RunQueue
+	DriftDetector       *run.DriftDetector
+	RBACChecker         *run.RBACChecker
+	Version             string
+	ConfigHash          string
+	Config              map[string]string
+	Webhook             *Webhook
+	TemplatePath        string
+	Authenticator       auth.Authenticator
+	AllowAnonymousReads bool
+	// ForceRunAllowedUsers, if set, lists the only authenticated users that may force runs.
+	ForceRunAllowedUsers []string
+	TLSCertPath          string
+	TLSKeyPath           string
+	ClientCAPath         string
+	Location             *time.Location
 }
 
 // StatusPageHandler implements the http.Handler interface and serves a status page with info about the most recent applier run.
@@ -29,13 +92,18 @@ type StatusPageHandler struct {
 }
 
 // ServeHTTP populates the status page template with data and serves it when there is a request.
+// If Data is a *LastRun, the template is populated with the most recent run result at the time of the request.
 func (s *StatusPageHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	log.Printf("Applier status request at %s", s.Clock.Now().String())
 	if s.Template == nil {
 		handleTemplateError(w, fmt.Errorf("No template found"), s.Clock)
 		return
 	}
-	if err := s.Template.Execute(w, s.Data); err != nil {
+	data := s.Data
+	if lastRun, ok := data.(*LastRun); ok {
+		data = lastRun.Get()
+	}
+	if err := s.Template.Execute(w, data); err != nil {
 		handleTemplateError(w, err, s.Clock)
 		return
 	}
@@ -50,49 +118,614 @@ func handleTemplateError(w http.ResponseWriter, err error, clock sysutil.ClockIn
 
 // ForceRunHandler implements the http.Handle interface and serves an API endpoint for forcing a new run.
 type ForceRunHandler struct {
-	FullRunQueue chan<- bool
+	FullRunQueue   chan<- int
+	RunCount       <-chan int
+	ForcedRuns     *ForcedRuns
+	CircuitBreaker *run.CircuitBreaker
+	AuthorPolicy   *run.AuthorPolicy
+	ApplyWindow    *run.ApplyWindow
+	RunQueue       *run.RunQueue
+}
+
+// ForcedRuns keeps the reason and correlation ID given for each forced run until the run's result is received.
+type ForcedRuns struct {
+	mu       sync.Mutex
+	requests map[int]forceRunRequest
+}
+
+// forceRunRequest holds the optional fields given by the client that forced a run.
+type forceRunRequest struct {
+	reason        string
+	correlationID string
+}
+
+// add records the reason and correlation ID for the forced run with the given ID.
+func (f *ForcedRuns) add(id int, reason, correlationID string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.requests == nil {
+		f.requests = make(map[int]forceRunRequest)
+	}
+	f.requests[id] = forceRunRequest{reason, correlationID}
+}
+
+// Annotate sets the reason and correlation ID of the result, if it is from a forced run, and forgets them.
+func (f *ForcedRuns) Annotate(result *run.Result) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if request, ok := f.requests[result.RunID]; ok {
+		result.Reason, result.CorrelationID = request.reason, request.correlationID
+		delete(f.requests, result.RunID)
+	}
 }
 
 // ServeHTTP handles requests for forcing a run by attempting to add to the runQueue, and writes a response including the result and a relevant message.
+// If the run is queued, the response includes its run ID, which can be used to poll the runs endpoint for its result.
+// The optional "reason" and "correlationId" form values are logged and stored in the run's result.
+// A forced run goes ahead even if runs are suspended by the circuit breaker or the commit is pending approval, and outside of
+// the apply window if the window allows it.
+// If the optional "dryRun" form value is true, the run only applies the files with a server-side dry run. Dry runs are recorded
+// in the RunQueue, from which the runner reads them, so they are rejected if there is none.
+// If the client accepts plain text, the response is only the message, e.g. for use with "curl --fail" in scripts.
 func (f *ForceRunHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	log.Print("Full run requested by webserver.")
 	var data struct {
 		Result  string `json:"result"`
 		Message string `json:"message"`
+		Code    string `json:"code,omitempty"`
+		RunID   *int   `json:"runID,omitempty"`
 	}
 
+	text := acceptsText(r)
+	setContentType(w, text)
 	switch r.Method {
 	case "POST":
-		select {
-		case f.FullRunQueue <- true:
-			log.Print("Full run queued.")
-		default:
+		var options run.RunOptions
+		if value := r.FormValue("dryRun"); value != "" {
+			var err error
+			if options.DryRun, err = strconv.ParseBool(value); err != nil || (options.DryRun && f.RunQueue == nil) {
+				data.Result = "error"
+				data.Code = codeInvalidOption
+				data.Message = "Error: force rejected, \"dryRun\" must be a boolean."
+				if err == nil {
+					data.Message = "Error: force rejected, dry runs are not supported."
+				}
+				w.WriteHeader(http.StatusBadRequest)
+				log.Print(data.Message)
+				break
+			}
+		}
+		id, ok := run.EnqueueFullRun(f.FullRunQueue, f.RunCount, f.RunQueue, options)
+		if !ok {
+			data.Result = "error"
+			data.Code = codeQueueFull
+			data.Message = "Error: a full run is already queued, retry once it has started."
+			w.WriteHeader(http.StatusConflict)
 			log.Print("Full run queue is already full.")
+			break
+		}
+		reason, correlationID := r.FormValue("reason"), r.FormValue("correlationId")
+		log.Printf("Full run %v queued with reason %q, correlation ID %q and dry run %v.", id, reason, correlationID, options.DryRun)
+		if f.ForcedRuns != nil && (reason != "" || correlationID != "") {
+			f.ForcedRuns.add(id, reason, correlationID)
+		}
+		// Dry runs are not held back by any of these, so they must not use up the force of the next real run.
+		if f.CircuitBreaker != nil && !options.DryRun {
+			f.CircuitBreaker.Force()
+		}
+		if f.AuthorPolicy != nil && !options.DryRun {
+			f.AuthorPolicy.Force()
+		}
+		if f.ApplyWindow != nil && !options.DryRun {
+			f.ApplyWindow.Force()
+		}
+		runName := "Run"
+		if options.DryRun {
+			runName = "Dry run"
 		}
 		data.Result = "success"
-		data.Message = "Run queued, will begin upon completion of current run."
+		data.Message = fmt.Sprintf("%v queued, will begin upon completion of current run.", runName)
+		data.RunID = &id
 		w.WriteHeader(http.StatusOK)
+		if text {
+			fmt.Fprintf(w, "%v %v queued, will begin upon completion of current run.\n", runName, id)
+			return
+		}
 	default:
 		data.Result = "error"
+		data.Code = codeInvalidMethod
 		data.Message = "Error: force rejected, must be a POST request."
 		w.WriteHeader(http.StatusBadRequest)
 		log.Print(data.Message)
 	}
 
+	if text {
+		fmt.Fprintln(w, data.Message)
+		return
+	}
+	json.NewEncoder(w).Encode(data)
+}
+
+// acceptsText returns true if the client asked for a plain-text response with the Accept header.
+func acceptsText(r *http.Request) bool {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		if strings.HasPrefix(strings.TrimSpace(accept), "text/plain") {
+			return true
+		}
+	}
+	return false
+}
+
+// setContentType sets the Content-Type of a plain-text or JSON response.
+func setContentType(w http.ResponseWriter, text bool) {
+	if text {
+		w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
+	} else {
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	}
+}
+
+// RunsHandler implements the http.Handler interface and serves an API endpoint with the result of a recent run, selected by its run ID.
+// Only the most recent retainedRuns results are kept.
+type RunsHandler struct {
+	mu      sync.RWMutex
+	results map[int]run.Result
+	order   []int
+}
+
+// Add stores the result of a completed run, evicting the oldest stored result once retainedRuns results are stored.
+func (h *RunsHandler) Add(result run.Result) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.results == nil {
+		h.results = make(map[int]run.Result)
+	}
+	h.results[result.RunID] = result
+	h.order = append(h.order, result.RunID)
+	if len(h.order) > retainedRuns {
+		delete(h.results, h.order[0])
+		h.order = h.order[1:]
+	}
+}
+
+// ServeHTTP writes the result of the run whose ID follows runsPath in the request path as JSON.
+// Runs that have not completed yet, or are no longer retained, are not found.
+func (h *RunsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	writeError := func(status int, code, message string) {
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(struct {
+			Result  string `json:"result"`
+			Message string `json:"message"`
+			Code    string `json:"code"`
+		}{"error", message, code})
+	}
+
+	if r.Method != "GET" {
+		writeError(http.StatusBadRequest, codeInvalidMethod, "Error: run rejected, must be a GET request.")
+		return
+	}
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, runsPath))
+	if err != nil {
+		writeError(http.StatusBadRequest, codeInvalidRunID, "Error: run ID must be an integer.")
+		return
+	}
+	h.mu.RLock()
+	result, ok := h.results[id]
+	h.mu.RUnlock()
+	if !ok {
+		writeError(http.StatusNotFound, codeNotFound, fmt.Sprintf("Error: run %v has not completed or is no longer retained.", id))
+		return
+	}
+	json.NewEncoder(w).Encode(result)
+}
+
+// LastRun holds the most recent run result, which is replaced by the results loop while the status handlers read it.
+// Results are replaced rather than modified, so that a result returned by Get can be read without holding the lock.
+type LastRun struct {
+	mu     sync.RWMutex
+	result *run.Result
+}
+
+// Get returns the most recent run result, or a result with RunID -1 if no run has completed yet. It must not be modified.
+func (l *LastRun) Get() *run.Result {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.result == nil {
+		return &run.Result{RunID: -1}
+	}
+	return l.result
+}
+
+// Set replaces the most recent run result with result.
+func (l *LastRun) Set(result run.Result) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.result = &result
+}
+
+// StatusHandler implements the http.Handler interface and serves an API endpoint with info about the most recent applier run as JSON.
+// If Updates is set, clients can long-poll for the next run result with the "after" parameter.
+type StatusHandler struct {
+	LastRun *LastRun
+	Updates *StatusUpdates
+	Timeout time.Duration
+}
+
+// StatusUpdates lets status requests wait until the most recent run result is replaced.
+type StatusUpdates struct {
+	mu      sync.Mutex
+	runID   int
+	updated chan struct{}
+}
+
+// wait returns the ID of the most recent run, and a channel that is closed when a newer run completes.
+func (u *StatusUpdates) wait() (int, <-chan struct{}) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.updated == nil {
+		u.updated = make(chan struct{})
+	}
+	return u.runID, u.updated
+}
+
+// notify records the ID of the most recent run and wakes up all requests waiting for it.
+func (u *StatusUpdates) notify(runID int) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.runID = runID
+	if u.updated != nil {
+		close(u.updated)
+		u.updated = nil
+	}
+}
+
+// ServeHTTP writes the most recent run result as JSON, or as a short plain-text summary if the client accepts plain text.
+// If the "after" parameter is set to a run ID and the most recent run is not newer, the response is delayed until a newer run
+// completes or Timeout passes, so that clients such as the status page can refresh as soon as a run completes.
+func (s *StatusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	text := acceptsText(r)
+	setContentType(w, text)
+	writeError := func(status int, code, message string) {
+		w.WriteHeader(status)
+		if text {
+			fmt.Fprintln(w, message)
+			return
+		}
+		json.NewEncoder(w).Encode(struct {
+			Result  string `json:"result"`
+			Message string `json:"message"`
+			Code    string `json:"code,omitempty"`
+		}{"error", message, code})
+	}
+	if r.Method != "GET" {
+		writeError(http.StatusBadRequest, "", "Error: status rejected, must be a GET request.")
+		return
+	}
+	if after := r.FormValue("after"); after != "" && s.Updates != nil {
+		id, err := strconv.Atoi(after)
+		if err != nil {
+			writeError(http.StatusBadRequest, codeInvalidRunID, "Error: \"after\" must be a run ID.")
+			return
+		}
+		if lastID, updated := s.Updates.wait(); lastID <= id {
+			timer := time.NewTimer(s.Timeout)
+			select {
+			case <-updated:
+			case <-timer.C:
+			case <-r.Context().Done():
+			}
+			timer.Stop()
+		}
+	}
+	lastRun := s.LastRun.Get()
+	if text {
+		writeStatusText(w, lastRun)
+		return
+	}
+	json.NewEncoder(w).Encode(lastRun)
+}
+
+// writeStatusText writes a summary of the run result as "key: value" lines, which are easy to grep or cut in scripts.
+// Only failed files are listed individually.
+func writeStatusText(w io.Writer, result *run.Result) {
+	if result.RunID < 0 {
+		fmt.Fprintln(w, "No run has completed yet.")
+		return
+	}
+	fmt.Fprintf(w, "run: %v\n", result.RunID)
+	fmt.Fprintf(w, "type: %v\n", result.RunType)
+	fmt.Fprintf(w, "status: %v\n", runStatus(result))
+	fmt.Fprintf(w, "commit: %v\n", result.CommitHash)
+	fmt.Fprintf(w, "finished: %v\n", result.Finish.UTC().Format(time.RFC3339))
+	fmt.Fprintf(w, "applied: %v\n", len(result.Successes))
+	fmt.Fprintf(w, "failed: %v\n", len(result.Failures))
+	for _, failure := range result.Failures {
+		fmt.Fprintf(w, "failed file: %v\n", failure.FilePath)
+	}
+}
+
+// runStatus returns a one-word description of the outcome of the run.
+func runStatus(result *run.Result) string {
+	switch {
+	case result.DryRun && len(result.Failures) > 0:
+		return "dry-run-failed"
+	case result.DryRun:
+		return "dry-run-succeeded"
+	case result.ReadOnly:
+		return "read-only"
+	case result.Suspended:
+		return "suspended"
+	case result.PendingApproval:
+		return "pending-approval"
+	case result.OutsideApplyWindow:
+		return "outside-apply-window"
+	case len(result.Failures) > 0:
+		return "failed"
+	default:
+		return "succeeded"
+	}
+}
+
+// ReadOnlyHandler implements the http.Handler interface and serves an API endpoint for viewing and toggling read-only mode.
+type ReadOnlyHandler struct {
+	ReadOnly *run.ReadOnly
+}
+
+// ServeHTTP returns the current read-only state for GET requests, and sets it from the "enabled" form value for POST requests.
+func (h *ReadOnlyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var data struct {
+		Result   string `json:"result"`
+		Message  string `json:"message"`
+		ReadOnly bool   `json:"readOnly"`
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	switch r.Method {
+	case "GET":
+		data.Result = "success"
+		w.WriteHeader(http.StatusOK)
+	case "POST":
+		enabled, err := strconv.ParseBool(r.FormValue("enabled"))
+		if err != nil {
+			data.Result = "error"
+			data.Message = "Error: \"enabled\" must be a boolean."
+			w.WriteHeader(http.StatusBadRequest)
+			break
+		}
+		h.ReadOnly.Set(enabled)
+		log.Printf("Read-only mode set to %v by webserver.", enabled)
+		data.Result = "success"
+		if enabled {
+			data.Message = "Read-only mode enabled, runs will not apply any files."
+		} else {
+			data.Message = "Read-only mode disabled, runs will apply files again."
+		}
+		w.WriteHeader(http.StatusOK)
+	default:
+		data.Result = "error"
+		data.Message = "Error: must be a GET or POST request."
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	data.ReadOnly = h.ReadOnly.Enabled()
+	json.NewEncoder(w).Encode(data)
+}
+
+// GitHandler implements the http.Handler interface and serves an API endpoint with the state of the mirrored repo, so that
+// external monitors can check that it is up to date.
+type GitHandler struct {
+	GitUtil    git.GitUtilInterface
+	RepoStatus *run.RepoStatus
+}
+
+// ServeHTTP writes the remote URL and branch of the repo, and what the scheduler last saw when polling it, as JSON.
+// The remote URL and branch are left empty if they cannot be read, since the poll state is still useful without them.
+func (h *GitHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(struct {
+			Result  string `json:"result"`
+			Message string `json:"message"`
+			Code    string `json:"code"`
+		}{"error", "Error: git status rejected, must be a GET request.", codeInvalidMethod})
+		return
+	}
+
+	var data struct {
+		RemoteURL string `json:"remoteURL"`
+		Branch    string `json:"branch"`
+		run.RepoState
+	}
+	var err error
+	if data.RemoteURL, err = h.GitUtil.RemoteURL(); err != nil {
+		log.Printf("Error reading remote URL: %v", err)
+	}
+	if data.Branch, err = h.GitUtil.Branch(); err != nil {
+		log.Printf("Error reading branch: %v", err)
+	}
+	data.RepoState = h.RepoStatus.State()
 	json.NewEncoder(w).Encode(data)
 }
 
+// QueueHandler implements the http.Handler interface and serves an API endpoint listing the runs that are queued or in progress.
+type QueueHandler struct {
+	RunQueue *run.RunQueue
+}
+
+// ServeHTTP writes the queued runs and the runs in progress as JSON.
+func (h *QueueHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(struct {
+			Result  string `json:"result"`
+			Message string `json:"message"`
+			Code    string `json:"code"`
+		}{"error", "Error: queue rejected, must be a GET request.", codeInvalidMethod})
+		return
+	}
+	json.NewEncoder(w).Encode(h.RunQueue.State())
+}
+
+// ApplierHandler implements the http.Handler interface and serves an API endpoint with the state of kube-applier itself: its
+// version and configuration, whether the repo is being polled successfully, and how many runs are queued or in progress.
+// The status page shows it above the last run.
+type ApplierHandler struct {
+	Version    string
+	ConfigHash string
+	Started    time.Time
+	RepoStatus *run.RepoStatus
+	RunQueue   *run.RunQueue
+}
+
+// ServeHTTP writes the state of kube-applier as JSON.
+// The repo is healthy if it has been polled and the last poll succeeded.
+func (h *ApplierHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(struct {
+			Result  string `json:"result"`
+			Message string `json:"message"`
+			Code    string `json:"code"`
+		}{"error", "Error: applier status rejected, must be a GET request.", codeInvalidMethod})
+		return
+	}
+
+	var data struct {
+		Version      string        `json:"version"`
+		ConfigHash   string        `json:"configHash"`
+		Started      time.Time     `json:"started"`
+		RepoHealthy  bool          `json:"repoHealthy"`
+		Repo         run.RepoState `json:"repo"`
+		Queued       int           `json:"queued"`
+		Running      int           `json:"running"`
+		DrainSeconds float64       `json:"estimatedDrainSeconds"`
+	}
+	data.Version, data.ConfigHash, data.Started = h.Version, h.ConfigHash, h.Started
+	if h.RepoStatus != nil {
+		data.Repo = h.RepoStatus.State()
+		data.RepoHealthy = !data.Repo.LastPoll.IsZero() && data.Repo.LastError == ""
+	}
+	if h.RunQueue != nil {
+		state := h.RunQueue.State()
+		data.Queued, data.Running, data.DrainSeconds = len(state.Queued), len(state.Running), state.DrainSeconds()
+	}
+	json.NewEncoder(w).Encode(data)
+}
+
+// ConfigHandler implements the http.Handler interface and serves an API endpoint with the effective configuration of
+// kube-applier, read from the environment and the config file at startup, with secrets redacted.
+type ConfigHandler struct {
+	Config map[string]string
+}
+
+// ServeHTTP writes the configuration as JSON, keyed by environment variable name. Settings left to their default are omitted.
+func (h *ConfigHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(struct {
+			Result  string `json:"result"`
+			Message string `json:"message"`
+			Code    string `json:"code"`
+		}{"error", "Error: config rejected, must be a GET request.", codeInvalidMethod})
+		return
+	}
+	json.NewEncoder(w).Encode(h.Config)
+}
+
+// DriftHandler implements the http.Handler interface and serves an API endpoint reporting the objects in the repo that differ
+// from the live objects in the cluster, optionally only for the namespace given by the "namespace" parameter.
+type DriftHandler struct {
+	DriftDetector *run.DriftDetector
+}
+
+// ServeHTTP writes the drift report as JSON. The report may take as long as a full run to compute if the cached one expired.
+func (h *DriftHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(struct {
+			Result  string `json:"result"`
+			Message string `json:"message"`
+			Code    string `json:"code"`
+		}{"error", "Error: drift report rejected, must be a GET request.", codeInvalidMethod})
+		return
+	}
+
+	report, err := h.DriftDetector.Report(r.URL.Query().Get("namespace"))
+	if err != nil {
+		log.Printf("Error computing drift report: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(struct {
+			Result  string `json:"result"`
+			Message string `json:"message"`
+			Code    string `json:"code"`
+		}{"error", fmt.Sprintf("Error: drift report failed: %v", err), codeDriftFailed})
+		return
+	}
+	json.NewEncoder(w).Encode(report)
+}
+
+// RBACHandler implements the http.Handler interface and serves an API endpoint with the most recent check of the permissions
+// kube-applier needs to apply the repo.
+type RBACHandler struct {
+	RBACChecker *run.RBACChecker
+}
+
+// ServeHTTP writes the RBAC report as JSON, or a not_found error if permissions are not checked or no check has completed yet.
+func (h *RBACHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(struct {
+			Result  string `json:"result"`
+			Message string `json:"message"`
+			Code    string `json:"code"`
+		}{"error", "Error: RBAC report rejected, must be a GET request.", codeInvalidMethod})
+		return
+	}
+
+	var report *run.RBACReport
+	if h.RBACChecker != nil {
+		report = h.RBACChecker.Report()
+	}
+	if report == nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(struct {
+			Result  string `json:"result"`
+			Message string `json:"message"`
+			Code    string `json:"code"`
+		}{"error", "Error: no RBAC report, permissions are not checked or the first check has not completed yet.", codeNotFound})
+		return
+	}
+	json.NewEncoder(w).Encode(report)
+}
+
 // Init starts the webserver using the given port, and sets up handlers for:
 // 1. Status page
 // 2. Metrics
 // 3. Static content
 // 4. Endpoint for forcing a run
+// 5. Endpoint for the most recent run result
+// 6. Endpoint for viewing and toggling read-only mode
+// 7. Endpoint for the result of a recent run by run ID
+// 8. Endpoint for the state of the mirrored repo
+// 9. Endpoint for the runs that are queued or in progress
+// 10. Endpoint for the drift of the repo from the cluster
+// 11. Endpoint for the state of kube-applier itself
+// 12. Endpoint for the permissions kube-applier is missing
 func (ws *WebServer) Start() {
 	log.Println("Launching webserver")
-	lastRun := &run.Result{RunID: -1}
+	lastRun := &LastRun{}
 
-	template, err := sysutil.CreateTemplate(serverTemplatePath)
+	templatePath := serverTemplatePath
+	if ws.TemplatePath != "" {
+		templatePath = ws.TemplatePath
+	}
+	template, err := sysutil.CreateTemplate(templatePath)
 	if err != nil {
 		ws.Errors <- err
 		return
@@ -102,20 +735,117 @@ func (ws *WebServer) Start() {
 	http.Handle("/", statusPageHandler)
 	http.Handle("/metrics", ws.MetricsHandler)
 	http.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("static"))))
-	forceRunHandler := &ForceRunHandler{ws.FullRunQueue}
-	http.Handle("/api/v1/forceRun", forceRunHandler)
+	forcedRuns := &ForcedRuns{}
+	forceRunHandler := &ForceRunHandler{ws.FullRunQueue, ws.RunCount, forcedRuns, ws.CircuitBreaker, ws.AuthorPolicy, ws.ApplyWindow, ws.RunQueue}
+	var forceRun http.Handler = forceRunHandler
+	if len(ws.ForceRunAllowedUsers) > 0 {
+		forceRun = &auth.AllowedUsers{Users: ws.ForceRunAllowedUsers, Handler: forceRunHandler}
+	}
+	http.Handle("/api/v1/forceRun", ws.authenticated(forceRun))
+	runsHandler := &RunsHandler{}
+	http.Handle(runsPath, ws.authenticated(runsHandler))
+	statusUpdates := &StatusUpdates{runID: lastRun.Get().RunID}
+	http.Handle("/api/v1/status", ws.authenticated(&StatusHandler{lastRun, statusUpdates, statusWaitTimeout}))
+	http.Handle("/api/v1/readOnly", ws.authenticated(&ReadOnlyHandler{ws.ReadOnly}))
+	http.Handle("/api/v1/git", ws.authenticated(&GitHandler{ws.GitUtil, ws.RepoStatus}))
+	http.Handle("/api/v1/queue", ws.authenticated(&QueueHandler{ws.RunQueue}))
+	http.Handle("/api/v1/drift", ws.authenticated(&DriftHandler{ws.DriftDetector}))
+	http.Handle("/api/v1/rbac", ws.authenticated(&RBACHandler{ws.RBACChecker}))
+	http.Handle("/api/v1/applier", ws.authenticated(&ApplierHandler{ws.Version, ws.ConfigHash, ws.Clock.Now(), ws.RepoStatus, ws.RunQueue}))
+	http.Handle("/api/v1/config", ws.authenticated(&ConfigHandler{ws.Config}))
 
 	go func() {
+		var lastSuccessfulRun *run.RunSummary
 		for result := range ws.RunResults {
+			if ws.Location != nil {
+				result.In(ws.Location)
+			}
+			forcedRuns.Annotate(&result)
+			runsHandler.Add(result)
+			if ws.Webhook != nil {
+				// Deliver in the background, so that a slow receiver does not hold back the status page.
+				go func(result run.Result) {
+					if err := ws.Webhook.Send(result); err != nil {
+						log.Printf("RUN %v: Error sending result to webhook: %v", result.RunID, err)
+					}
+				}(result)
+			}
+			// The displayed result is replaced with an updated copy, since the handlers may be reading it.
+			current := lastRun.Get()
+			next := *current
+			if result.Succeeded() && (lastSuccessfulRun == nil || result.RunID > lastSuccessfulRun.RunID) {
+				lastSuccessfulRun = result.Summary()
+				next.LastSuccessfulRun = lastSuccessfulRun
+			}
 			// If the new result is from a run that started later than the currently displayed run, update the page.
 			// Otherwise, a run with info from an older commit might replace a newer commit.
-			if result.RunID > lastRun.RunID {
+			if result.RunID > current.RunID {
 				log.Printf("Updating status page with info from Run %v.", result.RunID)
-				*lastRun = result
+				next = result
+				next.LastSuccessfulRun = lastSuccessfulRun
+			}
+			lastRun.Set(next)
+			if next.RunID != current.RunID {
+				statusUpdates.notify(next.RunID)
 			}
 		}
 	}()
 
-	err = http.ListenAndServe(fmt.Sprintf(":%v", ws.ListenPort), nil)
-	ws.Errors <- err
+	listener, err := ws.listen()
+	if err != nil {
+		ws.Errors <- err
+		return
+	}
+	server := &http.Server{}
+	if ws.TLSCertPath == "" {
+		ws.Errors <- server.Serve(listener)
+		return
+	}
+	if ws.ClientCAPath != "" {
+		caCert, err := ioutil.ReadFile(ws.ClientCAPath)
+		if err != nil {
+			ws.Errors <- fmt.Errorf("Error reading client CA file: %v", err)
+			return
+		}
+		clientCAs := x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(caCert) {
+			ws.Errors <- fmt.Errorf("Error: no certificates found in client CA file %v", ws.ClientCAPath)
+			return
+		}
+		// Client certificates are optional at the TLS layer, so that the status page stays reachable from browsers without one.
+		server.TLSConfig = &tls.Config{ClientCAs: clientCAs, ClientAuth: tls.VerifyClientCertIfGiven}
+	}
+	ws.Errors <- server.ServeTLS(listener, ws.TLSCertPath, ws.TLSKeyPath)
+}
+
+// listen opens the listener the webserver serves on. ListenAddress is either "unix:<path>" for a unix socket, or "<host>:<port>"
+// for TCP, where an IPv6 host, e.g. "[::]:8080", only accepts IPv6 connections. Without ListenAddress, the webserver listens
+// on ListenPort on all IPv4 and IPv6 interfaces.
+func (ws *WebServer) listen() (net.Listener, error) {
+	if ws.ListenAddress == "" {
+		return net.Listen("tcp", fmt.Sprintf(":%v", ws.ListenPort))
+	}
+	if path := strings.TrimPrefix(ws.ListenAddress, "unix:"); path != ws.ListenAddress {
+		// Remove the socket left behind by a previous process, which would make listening fail.
+		if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+			os.Remove(path)
+		}
+		return net.Listen("unix", path)
+	}
+	host, _, err := net.SplitHostPort(ws.ListenAddress)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid listen address %q: %v", ws.ListenAddress, err)
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.To4() == nil {
+		return net.Listen("tcp6", ws.ListenAddress)
+	}
+	return net.Listen("tcp", ws.ListenAddress)
+}
+
+// authenticated wraps the handler so that requests must be authenticated, if an Authenticator is configured.
+func (ws *WebServer) authenticated(h http.Handler) http.Handler {
+	if ws.Authenticator == nil {
+		return h
+	}
+	return &auth.Handler{Authenticator: ws.Authenticator, Handler: h, AllowAnonymousReads: ws.AllowAnonymousReads}
 }